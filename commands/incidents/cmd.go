@@ -0,0 +1,119 @@
+// Package incidents provides a CommandProvider that lists and dumps incidents
+// from the local incident store configured for the monitor.
+package incidents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/commands"
+	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+)
+
+func init() {
+	commands.Register("incidents", cmd{})
+}
+
+type cmd struct{}
+
+func (cmd) Summary() string {
+	return "List and dump incidents from the local incident store"
+}
+
+func (cmd) Usage() string {
+	return `
+taskcluster-worker incidents can be used to inspect incidents kept in the local
+incident store, configured with 'monitor.incidents.folder'. This allows for
+incident identifiers to be resolved on workers that cannot reach sentry.
+
+usage:
+  taskcluster-worker incidents list [options] <folder>
+  taskcluster-worker incidents dump [options] <folder> <incidentId>
+
+options:
+  -j --json     Print as JSON.
+  -h --help     Show this screen.
+`
+}
+
+func (cmd) Execute(args map[string]interface{}) bool {
+	folder := args["<folder>"].(string)
+	formatJSON := args["--json"].(bool)
+
+	if args["list"].(bool) {
+		incidents, err := monitoring.ListIncidents(folder)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		if formatJSON {
+			printJSON(incidents)
+			return true
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "INCIDENT ID\tTIME\tLEVEL\tPREFIX\tERROR")
+		for _, incident := range incidents {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				incident.IncidentID, incident.Time.Format(time.RFC3339), incident.Level,
+				incident.Prefix, firstLine(incident.Error),
+			)
+		}
+		w.Flush()
+		return true
+	}
+
+	incidentID := args["<incidentId>"].(string)
+	incident, err := monitoring.LoadIncident(folder, incidentID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if incident == nil {
+		fmt.Fprintf(os.Stderr, "incident '%s' not found in '%s'\n", incidentID, folder)
+		return false
+	}
+	if formatJSON {
+		printJSON(incident)
+		return true
+	}
+	fmt.Printf("incidentId: %s\n", incident.IncidentID)
+	fmt.Printf("time:       %s\n", incident.Time.Format(time.RFC3339Nano))
+	fmt.Printf("level:      %s\n", incident.Level)
+	fmt.Printf("prefix:     %s\n", incident.Prefix)
+	fmt.Printf("version:    %s (%s)\n", incident.Version, incident.Revision)
+	fmt.Printf("message:    %s\n", incident.Message)
+	fmt.Printf("error:      %s\n", incident.Error)
+	if len(incident.Tags) > 0 {
+		fmt.Println("tags:")
+		keys := make([]string, 0, len(incident.Tags))
+		for k := range incident.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  %s: %s\n", k, incident.Tags[k])
+		}
+	}
+	if incident.Details != "" {
+		fmt.Printf("details:\n%s\n", incident.Details)
+	}
+	fmt.Printf("stack:\n%s\n", incident.Stack)
+	return true
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("Internal error, failed to serialize, error: %s", err))
+	}
+	fmt.Println(string(data))
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
@@ -3,6 +3,7 @@ package qemubuild
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -29,7 +30,16 @@ func buildImage(
 	boot, cdrom string,
 	linuxBootOptions vm.LinuxBootOptions,
 	size int,
+	saveState bool,
 ) error {
+	// Saved state refers to the devices attached during the build, tasks don't
+	// have these attached, so the state couldn't be resumed.
+	if saveState && (boot != "" || cdrom != "" || linuxBootOptions.Kernel != "" || linuxBootOptions.Initrd != "") {
+		err := errors.New("--save-state cannot be combined with --boot, --cdrom, --kernel or --initrd")
+		monitor.Error(err)
+		return err
+	}
+
 	// Find absolute outputFile
 	outputFile, err := filepath.Abs(outputFile)
 	if err != nil {
@@ -87,7 +97,15 @@ func buildImage(
 
 	// Setup logService so that logs can be posted to meta-service at:
 	// http://169.254.169.254/engine/v1/log
-	net.SetHandler(&logService{Destination: os.Stdout})
+	var handler http.Handler = &logService{Destination: os.Stdout}
+	var guestReady <-chan struct{}
+	if saveState {
+		// Detect when guest-tools start polling, so we can save the state
+		s := newStateService(handler)
+		handler = s
+		guestReady = s.Ready
+	}
+	net.SetHandler(handler)
 
 	// Create virtual machine
 	monitor.Info("Creating virtual machine")
@@ -114,13 +132,26 @@ func buildImage(
 	interrupted := make(chan os.Signal, 1)
 	signal.Notify(interrupted, os.Interrupt)
 
-	// Wait for virtual machine to be done, or we get interrupted
+	// Wait for virtual machine to be done, guest-tools to be ready if saving
+	// state, or we get interrupted
 	select {
 	case <-interrupted:
 		machine.Kill()
 		err = errors.New("SIGINT received, aborting virtual machine")
+	case <-guestReady:
+		monitor.Info("Guest-tools are polling, saving virtual machine state")
+		err = machine.SaveState(img.StateFile())
+		if err == nil {
+			// State can only be resumed with the exact same machine definition
+			img.SetMachine(machine.Machine())
+		} else {
+			machine.Kill()
+		}
 	case <-machine.Done:
 		err = machine.Error
+		if err == nil && saveState {
+			err = errors.New("virtual machine terminated before guest-tools started polling")
+		}
 	}
 	<-machine.Done
 	signal.Stop(interrupted)
@@ -48,9 +48,21 @@ func TestBuildImage(t *testing.T) {
 
 	err = buildImage(
 		monitor, inputImageFile, outputFile,
-		true, vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1,
+		true, vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1, false,
 	)
 	if err != nil {
 		panic(err)
 	}
 }
+
+func TestBuildImageSaveStateWithBoot(t *testing.T) {
+	monitor := mocks.NewMockMonitor(true)
+
+	err := buildImage(
+		monitor, "machine.json", "result.tar.zst",
+		false, 0, "boot.iso", "", vm.LinuxBootOptions{}, 1, true,
+	)
+	if err == nil {
+		t.Fatal("expected --save-state with --boot to be rejected")
+	}
+}
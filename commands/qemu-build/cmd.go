@@ -19,6 +19,12 @@ taskcluster-worker qemu-build takes a machine definition as JSON or an existing
 image and two ISO files to mounted as CDs and creates a virtual machine that
 will be saved to disk when terminated.
 
+If --save-state is given the virtual machine state will be saved, when the
+guest-tools start polling the meta-data service. The image will then include
+the saved state and tasks will resume the virtual machine, instead of booting.
+As tasks don't have boot media attached, --save-state cannot be combined with
+--boot, --cdrom, --kernel or --initrd.
+
 usage:
   taskcluster-worker qemu-build [options] from-new <machine.json> <result.tar.zst>
   taskcluster-worker qemu-build [options] from-image <image.tar.zst> <result.tar.zst>
@@ -31,6 +37,7 @@ options:
      --kernel <image>   Multi-boot option -kernel for QEMU.
      --append <cmdline> Multi-boot option -append for QEMU.
      --initrd <file>    Multi-boot option -initrd for QEMU.
+     --save-state       Save virtual machine state when guest-tools start.
   -h --help             Show this screen.
 `
 }
@@ -51,6 +58,7 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 			monitor.Panic("Couldn't parse --vnc, error: ", err)
 		}
 	}
+	saveState, _ := arguments["--save-state"].(bool)
 	boot, _ := arguments["--boot"].(string)
 	cdrom, _ := arguments["--cdrom"].(string)
 	size, err := strconv.ParseInt(arguments["--size"].(string), 10, 32)
@@ -77,6 +85,6 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 		monitor, inputFile, outputFile,
 		fromImage, int(vncPort),
 		boot, cdrom, linuxBootOptions,
-		int(size),
+		int(size), saveState,
 	) == nil
 }
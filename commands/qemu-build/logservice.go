@@ -3,6 +3,7 @@ package qemubuild
 import (
 	"io"
 	"net/http"
+	"sync"
 )
 
 // logService is a minimalistic implementation of metadata service that allows
@@ -30,3 +31,35 @@ func (l *logService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusForbidden)
 }
+
+// stateService wraps a handler and closes Ready when the guest-tools request
+// the task to execute. This happens when the guest has booted and guest-tools
+// have started, which is when we want to save the virtual machine state.
+//
+// Requests for the task are answered with an error, guest-tools will retry
+// and when resumed from the saved state the request will be retried against
+// the meta-data service of the task.
+type stateService struct {
+	handler http.Handler
+	ready   chan struct{}
+	once    sync.Once
+	Ready   <-chan struct{}
+}
+
+func newStateService(handler http.Handler) *stateService {
+	ready := make(chan struct{})
+	return &stateService{
+		handler: handler,
+		ready:   ready,
+		Ready:   ready,
+	}
+}
+
+func (s *stateService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/engine/v1/execute" || r.URL.Path == "/engine/v1/poll" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		s.once.Do(func() { close(s.ready) })
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
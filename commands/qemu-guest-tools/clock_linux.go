@@ -0,0 +1,32 @@
+package qemuguesttools
+
+import (
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// maxClockSkew is the maximum clock skew tolerated before the guest clock is
+// set from the meta-data service.
+const maxClockSkew = 30 * time.Second
+
+// syncClock sets the system clock from the Date header of a response from the
+// meta-data service, if the clock is off by more than maxClockSkew. This is
+// necessary when the virtual machine is resumed from saved state, as the
+// guest clock will be at the time the state was saved.
+func (g *guestTools) syncClock(header http.Header) {
+	now, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return // Ignore responses without a valid Date header
+	}
+	skew := time.Since(now)
+	if skew < maxClockSkew && skew > -maxClockSkew {
+		return
+	}
+	tv := syscall.NsecToTimeval(now.UnixNano())
+	if err = syscall.Settimeofday(&tv); err != nil {
+		g.monitor.Errorf("Failed to set system clock, skew: %s, error: %s", skew, err)
+		return
+	}
+	g.monitor.Infof("Set system clock to %s, skew was: %s", now.UTC(), skew)
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package qemuguesttools
+
+import "net/http"
+
+// syncClock is only supported on linux guests
+func (g *guestTools) syncClock(header http.Header) {}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -89,6 +90,7 @@ func (g *guestTools) Run() {
 			goto retry
 		}
 		g.monitor.Printf("Received task: %+v\n", task)
+		g.syncClock(res.Header)
 		break
 	retry:
 		time.Sleep(200 * time.Millisecond)
@@ -126,6 +128,14 @@ func (g *guestTools) Run() {
 		}
 	}
 
+	// Mount volumes, if any
+	err = g.mountVolumes(task.Mounts)
+	if err != nil {
+		g.monitor.Error("Failed to mount volumes, error: ", err)
+		fmt.Fprintf(taskLog, "[qemu-guest-tools] %s\n", err)
+		goto resolved
+	}
+
 	// Execute the task
 	proc, err = system.StartProcess(system.ProcessOptions{
 		Arguments:     append(g.config.Entrypoint, task.Command...),
@@ -154,6 +164,12 @@ func (g *guestTools) Run() {
 		close(done)
 	}
 
+	// Unmount volumes, flushing data written to the host
+	if err = g.unmountVolumes(task.Mounts); err != nil {
+		fmt.Fprintf(taskLog, "[qemu-guest-tools] %s\n", err)
+		result = "failed"
+	}
+
 resolved:
 	// Close/flush the task log
 	err = taskLog.Close()
@@ -0,0 +1,84 @@
+package qemuguesttools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
+)
+
+// deviceWaitTimeout is the maximum time to wait for the block device of a
+// volume to show up, udev may be a little slow to create the links.
+const deviceWaitTimeout = 30 * time.Second
+
+// mountVolumes mounts the volumes given by the meta-data service, volumes are
+// identified by the serial number of the virtio block device.
+//
+// If an error is returned, volumes mounted have already been unmounted.
+func (g *guestTools) mountVolumes(mounts []metaservice.Mount) error {
+	for i, m := range mounts {
+		if err := g.mountVolume(m); err != nil {
+			g.unmountVolumes(mounts[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// mountVolume mounts a single volume
+func (g *guestTools) mountVolume(m metaservice.Mount) error {
+	device := filepath.Join("/dev/disk/by-id", "virtio-"+m.Serial)
+
+	// Wait for the device to show up
+	deadline := time.Now().Add(deviceWaitTimeout)
+	for {
+		if _, err := os.Stat(device); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("block device for volume at '%s' didn't show up", m.MountPoint)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// Create mount-point and mount the volume
+	if err := os.MkdirAll(m.MountPoint, 0777); err != nil {
+		return fmt.Errorf("failed to create mount-point '%s', error: %s", m.MountPoint, err)
+	}
+	options := "rw"
+	if m.ReadOnly {
+		options = "ro"
+	}
+	out, err := exec.Command("mount", "-t", "ext4", "-o", options, device, m.MountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to mount volume at '%s', error: %s, output: %s", m.MountPoint, err, string(out))
+	}
+	g.monitor.Infof("mounted volume %s at %s (%s)", m.Serial, m.MountPoint, options)
+
+	// Ensure the task user can write to writable volumes
+	if !m.ReadOnly {
+		if err := os.Chmod(m.MountPoint, 0777); err != nil {
+			g.unmountVolumes([]metaservice.Mount{m})
+			return fmt.Errorf("failed to chmod volume at '%s', error: %s", m.MountPoint, err)
+		}
+	}
+	return nil
+}
+
+// unmountVolumes unmounts the volumes given, in reverse order. This ensures
+// that all data written to the volumes is flushed to the host.
+func (g *guestTools) unmountVolumes(mounts []metaservice.Mount) error {
+	var failed error
+	for i := len(mounts) - 1; i >= 0; i-- {
+		m := mounts[i]
+		out, err := exec.Command("umount", m.MountPoint).CombinedOutput()
+		if err != nil {
+			g.monitor.Errorf("failed to unmount volume at %s, error: %s, output: %s", m.MountPoint, err, string(out))
+			failed = fmt.Errorf("failed to unmount volume at '%s'", m.MountPoint)
+		}
+	}
+	return failed
+}
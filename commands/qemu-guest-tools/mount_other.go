@@ -0,0 +1,22 @@
+// +build !linux
+
+package qemuguesttools
+
+import (
+	"errors"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
+)
+
+// mountVolumes is only supported on linux guests
+func (g *guestTools) mountVolumes(mounts []metaservice.Mount) error {
+	if len(mounts) > 0 {
+		return errors.New("volumes are not supported by qemu-guest-tools on this platform")
+	}
+	return nil
+}
+
+// unmountVolumes is only supported on linux guests
+func (g *guestTools) unmountVolumes(mounts []metaservice.Mount) error {
+	return nil
+}
@@ -0,0 +1,151 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const (
+	archiveModeFull = "full"
+	archiveModeDiff = "diff"
+)
+
+// whiteoutPrefix is the prefix used for files in a layer diff to indicate
+// that the file was deleted, this follows the docker/OCI image conventions.
+const whiteoutPrefix = ".wh."
+
+func (r *resultSet) ArchiveSandbox() (ioext.ReadSeekCloser, error) {
+	// Create temporary file that we write the tar-stream to
+	tmpfile, err := r.storage.NewFile()
+	if err != nil {
+		r.monitor.ReportError(err, "failed to create temporary file for archiving the sandbox")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	if r.archiveMode == archiveModeDiff {
+		err = r.exportDiff(tmpfile)
+	} else {
+		err = r.exportContainer(tmpfile)
+	}
+	if err != nil {
+		tmpfile.Close()
+		r.monitor.ReportError(err, "failed to archive the sandbox")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	// Seek start of temp file
+	if _, err = tmpfile.Seek(0, io.SeekStart); err != nil {
+		tmpfile.Close()
+		r.monitor.ReportError(err, "failed to seek to start of temporary file, after archiving the sandbox")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	return tmpfile, nil
+}
+
+// exportContainer writes the entire container filesystem as a tar-stream to w
+func (r *resultSet) exportContainer(w io.Writer) error {
+	debug("exportContainer() calling docker.ExportContainer(%s)", r.containerID)
+	err := r.docker.ExportContainer(docker.ExportContainerOptions{
+		ID:                r.containerID,
+		OutputStream:      w,
+		InactivityTimeout: 5 * time.Second,
+		Context:           r.context,
+	})
+	if err != nil {
+		return errors.Wrap(err, "docker.ExportContainer failed")
+	}
+	return nil
+}
+
+// exportDiff writes a tar-stream to w containing the files that was added or
+// modified in the container, relative to the image. Files that have been
+// deleted are represented by whiteout files, as in docker image layers.
+func (r *resultSet) exportDiff(w io.Writer) error {
+	changes, err := r.docker.ContainerChanges(r.containerID)
+	if err != nil {
+		return errors.Wrap(err, "docker.ContainerChanges failed")
+	}
+
+	// Find paths that should be included, and paths that have been deleted
+	included := make(map[string]bool)
+	var deleted []string
+	for _, change := range changes {
+		p := path.Clean("/" + change.Path)
+		if change.Kind == docker.ChangeDelete {
+			deleted = append(deleted, p)
+		} else {
+			included[p] = true
+		}
+	}
+
+	// Read tar stream while we export from docker
+	stream, streamWriter := io.Pipe()
+	tw := tar.NewWriter(w)
+
+	var eerr, rerr error
+	util.Parallel(func() {
+		defer stream.Close() // always close the reader, so writers abort instead of hanging
+		reader := tar.NewReader(stream)
+		for {
+			var hdr *tar.Header
+			hdr, rerr = reader.Next()
+			if rerr == io.EOF {
+				rerr = nil // EOF is not an error
+				return
+			}
+			if rerr != nil {
+				rerr = errors.Wrap(rerr, "failed to read tar-stream from docker")
+				return
+			}
+			// Skip entries that haven't changed
+			if !included[path.Clean("/"+hdr.Name)] {
+				continue
+			}
+			if rerr = tw.WriteHeader(hdr); rerr != nil {
+				rerr = errors.Wrap(rerr, "failed to write tar header")
+				return
+			}
+			if _, rerr = io.Copy(tw, reader); rerr != nil {
+				rerr = errors.Wrap(rerr, "failed to copy file from tar-stream")
+				return
+			}
+		}
+	}, func() {
+		eerr = r.exportContainer(streamWriter)
+		streamWriter.CloseWithError(eerr)
+	})
+	if rerr != nil {
+		return rerr
+	}
+	if eerr != nil {
+		return eerr
+	}
+
+	// Write whiteout files for deleted paths
+	for _, p := range deleted {
+		dir, name := path.Split(p)
+		err = tw.WriteHeader(&tar.Header{
+			Name:     strings.TrimPrefix(path.Join(dir, whiteoutPrefix+name), "/"),
+			Typeflag: tar.TypeReg,
+			Mode:     0600,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to write whiteout file")
+		}
+	}
+
+	return errors.Wrap(tw.Close(), "failed to close tar-stream")
+}
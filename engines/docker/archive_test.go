@@ -0,0 +1,98 @@
+// +build linux,docker
+
+package dockerengine
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+// archiveSandbox runs payload with given archiveSandboxMode, and returns the
+// files found in the tar-stream from ArchiveSandbox()
+func archiveSandbox(t *testing.T, mode string, command []string) map[string]string {
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+
+	env := &runtime.Environment{
+		GarbageCollector: &gc.GarbageCollector{},
+		TemporaryStorage: storage,
+		Monitor:          mocks.NewMockMonitor(true),
+		ProvisionerID:    "test-provisioner",
+		WorkerType:       "test-worker-type",
+	}
+	e, err := engineProvider{}.NewEngine(engines.EngineOptions{
+		Environment: env,
+		Monitor:     env.Monitor,
+		Config: map[string]interface{}{
+			"privileged":         "never",
+			"archiveSandboxMode": mode,
+		},
+	})
+	require.NoError(t, err)
+	defer e.Dispose()
+
+	ctx, control, err := runtime.NewTaskContext(filepath.Join(storage.Path(), "log"), runtime.TaskInfo{})
+	require.NoError(t, err)
+	defer control.Dispose()
+
+	sb, err := e.NewSandboxBuilder(engines.SandboxOptions{
+		TaskContext: ctx,
+		Payload: map[string]interface{}{
+			"image":   dockerImageName,
+			"command": command,
+		},
+		Monitor: env.Monitor,
+	})
+	require.NoError(t, err)
+	s, err := sb.StartSandbox()
+	require.NoError(t, err)
+	rs, err := s.WaitForResult()
+	require.NoError(t, err)
+	defer rs.Dispose()
+	require.True(t, rs.Success())
+
+	archive, err := rs.ArchiveSandbox()
+	require.NoError(t, err)
+	defer archive.Close()
+
+	files := make(map[string]string)
+	reader := tar.NewReader(archive)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+	return files
+}
+
+func TestArchiveSandbox(t *testing.T) {
+	command := []string{"sh", "-ec", "echo 'hello-world' > /hello.txt; rm /etc/motd"}
+
+	t.Run("full", func(t *testing.T) {
+		files := archiveSandbox(t, archiveModeFull, command)
+		require.Equal(t, "hello-world\n", files["hello.txt"])
+		require.Contains(t, files, "bin/sh")
+		require.NotContains(t, files, "etc/motd")
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		files := archiveSandbox(t, archiveModeDiff, command)
+		require.Equal(t, "hello-world\n", files["hello.txt"])
+		require.NotContains(t, files, "bin/sh")
+		require.Contains(t, files, "etc/.wh.motd")
+	})
+}
@@ -0,0 +1,118 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines/docker/imagecache"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// committedImageName is the name given to committed images in the tar-ball
+// uploaded, the image is renamed when loaded by a later task.
+const committedImageName = "taskcluster/committed-image"
+
+type commitImageType struct {
+	Artifact string    `json:"artifact"`
+	Expires  time.Time `json:"expires"`
+}
+
+var commitImageSchema = schematypes.Object{
+	Title: "Commit Image",
+	Description: util.Markdown(`
+		Commit the task container as a docker image, when the task has finished
+		successfully. The image is uploaded as a zstd compressed tar-ball to the
+		given artifact. Later tasks can use the image by referencing the artifact
+		in 'task.payload.image'.
+
+		If committing or uploading the image fails the task will be resolved
+		failed.
+	`),
+	Properties: schematypes.Properties{
+		"artifact": schematypes.String{
+			Title: "Artifact Name",
+			Description: util.Markdown(`
+				Name of the artifact the docker image should be uploaded to, by
+				convention this should end in '.tar.zst'.
+			`),
+			Pattern: `^([\x20-\x2e\x30-\x7e][\x20-\x7e]*)[\x20-\x2e\x30-\x7e]$`,
+		},
+		"expires": schematypes.DateTime{
+			Title:       "Expiration Date",
+			Description: "Expiration of the artifact, defaults to 'task.expires'.",
+		},
+	},
+	Required: []string{"artifact"},
+}
+
+// commitImage commits the container as an image and uploads it as an artifact,
+// returns false if this failed.
+func (s *sandbox) commitImage() bool {
+	s.taskCtx.Log(fmt.Sprintf("Committing task container as docker image to artifact: '%s'", s.commit.Artifact))
+
+	// Commit the container with a temporary name, this must be lower case
+	repository := "committed-image/" + strings.ToLower(slugid.Nice())
+	_, err := s.docker.CommitContainer(docker.CommitContainerOptions{
+		Container:  s.containerID,
+		Repository: repository,
+		Tag:        "latest",
+	})
+	if err != nil {
+		incidentID := s.monitor.ReportError(err, "docker.CommitContainer failed")
+		s.taskCtx.LogError("internal error committing task container as image, incidentId:", incidentID)
+		return false
+	}
+	defer func() {
+		if rerr := s.docker.RemoveImage(repository); rerr != nil {
+			s.monitor.ReportWarning(rerr, "failed to remove committed image")
+		}
+	}()
+
+	// Create temporary file for the compressed tar-ball
+	tmpfile, err := s.storage.NewFile()
+	if err != nil {
+		incidentID := s.monitor.ReportError(err, "failed to create temporary file for committed image")
+		s.taskCtx.LogError("internal error committing task container as image, incidentId:", incidentID)
+		return false
+	}
+
+	// Save the image to the temporary file
+	err = imagecache.SaveImage(s.taskCtx, s.docker, repository, committedImageName, tmpfile)
+	if err != nil {
+		tmpfile.Close()
+		if e, ok := runtime.IsMalformedPayloadError(err); ok {
+			s.taskCtx.LogError("failed to save committed image, error: ", e.Error())
+			return false
+		}
+		incidentID := s.monitor.ReportError(err, "failed to save committed image")
+		s.taskCtx.LogError("internal error saving committed image, incidentId:", incidentID)
+		return false
+	}
+
+	// Upload the image, this will close tmpfile
+	expires := s.commit.Expires
+	if expires.IsZero() {
+		expires = s.taskCtx.TaskInfo.Expires
+	}
+	err = s.taskCtx.UploadS3Artifact(runtime.S3Artifact{
+		Name:     s.commit.Artifact,
+		Mimetype: "application/octet-stream",
+		Expires:  expires,
+		Stream:   tmpfile,
+	})
+	if err != nil {
+		s.monitor.ReportWarning(err, "failed to upload committed image")
+		s.taskCtx.LogError("failed to upload committed image to artifact: '", s.commit.Artifact, "', error: ", err)
+		return false
+	}
+
+	s.taskCtx.Log(fmt.Sprintf("Uploaded committed docker image to artifact: '%s'", s.commit.Artifact))
+	return true
+}
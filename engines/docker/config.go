@@ -8,8 +8,11 @@ import (
 )
 
 type configType struct {
-	DockerSocket string `json:"dockerSocket"`
-	Privileged   string `json:"privileged"`
+	DockerSocket       string     `json:"dockerSocket"`
+	Privileged         string     `json:"privileged"`
+	DefaultLimits      limitsType `json:"defaultLimits"`
+	MaxLimits          limitsType `json:"maxLimits"`
+	ArchiveSandboxMode string     `json:"archiveSandboxMode"`
 }
 
 const (
@@ -49,6 +52,28 @@ var configSchema = schematypes.Object{
 				privilegedNever,
 			},
 		},
+		"defaultLimits": defaultLimitsSchema,
+		"maxLimits":     maxLimitsSchema,
+		"archiveSandboxMode": schematypes.StringEnum{
+			Title: "Sandbox Archive Mode",
+			Description: util.Markdown(`
+				Determines what is included when the sandbox is archived, this can
+				be used by plugins to export the state of task containers.
+
+				This option can take one of 2 values:
+				 * 'full', archive the entire container filesystem (default).
+				 * 'diff', archive only files added or modified by the task
+				   relative to the docker image. Files deleted by the task are
+				   represented by whiteout files ('.wh.<name>') as in docker image layers.
+
+				In either case the contents of volumes attached to the container
+				are not included.
+			`),
+			Options: []string{
+				archiveModeFull,
+				archiveModeDiff,
+			},
+		},
 	},
 	Required: []string{
 		"privileged",
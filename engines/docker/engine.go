@@ -42,6 +42,11 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 	var c configType
 	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
 
+	// Check that default limits doesn't exceed maximum limits
+	if err := validateConfig(c.DefaultLimits, c.MaxLimits); err != nil {
+		return nil, err
+	}
+
 	if c.DockerSocket == "" {
 		c.DockerSocket = "unix:///var/run/docker.sock" // default docker socket
 	}
@@ -65,9 +70,11 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 }
 
 type payloadType struct {
-	Image      interface{} `json:"image"`
-	Command    []string    `json:"command"`
-	Privileged bool        `json:"privileged"`
+	Image      interface{}     `json:"image"`
+	Command    []string        `json:"command"`
+	Privileged bool            `json:"privileged"`
+	Limits     limitsType      `json:"limits"`
+	Commit     commitImageType `json:"commitImage"`
 }
 
 func (e *engine) PayloadSchema() schematypes.Object {
@@ -79,6 +86,8 @@ func (e *engine) PayloadSchema() schematypes.Object {
 				Description: "Command to run inside the container.",
 				Items:       schematypes.String{},
 			},
+			"limits":      payloadLimitsSchema,
+			"commitImage": commitImageSchema,
 		},
 		Required: []string{
 			"image",
@@ -128,6 +137,12 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 		p.Privileged = true
 	}
 
+	// Apply default limits and check that maximum limits are respected
+	p.Limits = p.Limits.WithDefaults(e.config.DefaultLimits).WithDefaults(e.config.MaxLimits)
+	if err := p.Limits.Validate(e.config.MaxLimits); err != nil {
+		return nil, err
+	}
+
 	return newSandboxBuilder(&p, e, e.Environment.Monitor, options.TaskContext), nil
 }
 
@@ -160,3 +160,20 @@ func TestVolumes(t *testing.T) {
 
 	c.Test()
 }
+
+func TestShell(t *testing.T) {
+	c := enginetest.ShellTestCase{
+		EngineProvider: provider,
+		Command:        "echo '[hello-world]'; (>&2 echo '[hello-error]');",
+		Stdout:         "[hello-world]\n",
+		Stderr:         "[hello-error]\n",
+		BadCommand:     "exit 1;\n",
+		SleepCommand:   "sleep 30;\n",
+		Payload: `{
+			"command": ["sh", "-c", "sleep 10 && true"],
+			"image": "` + dockerImageName + `"
+		}`, // sleep in payload, sandbox doesn't terminate before shell is started
+	}
+
+	c.Test()
+}
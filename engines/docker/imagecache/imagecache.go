@@ -19,6 +19,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
@@ -79,11 +80,19 @@ func (ic *ImageCache) constructor(ctx caching.Context, opts interface{}) (cachin
 
 	// Pull from docker
 	if options.reference == nil {
-		return ic.dockerPullFromRegistry(ctx, options.Image)
+		span := tracing.FromContext(ctx).StartSpan("image.pull", nil)
+		defer span.End()
+		img, err := ic.dockerPullFromRegistry(ctx, options.Image)
+		span.SetError(err)
+		return img, err
 	}
 
 	// Load from reference
-	return ic.dockerLoadFromReference(cachingContextWithQueue{ctx, options.queue}, options.reference)
+	span := tracing.FromContext(ctx).StartSpan("image.load", nil)
+	defer span.End()
+	img, err := ic.dockerLoadFromReference(cachingContextWithQueue{ctx, options.queue}, options.reference)
+	span.SetError(err)
+	return img, err
 }
 
 // ImageHandle wraps caching.Handle such that we don't need to do any casting
@@ -99,6 +108,9 @@ func (ic *ImageCache) Require(ctx *runtime.TaskContext, imagePayload interface{}
 	// Caller must ensure that imagePayload matches the schema
 	schematypes.MustValidate(ic.ImageSchema(), imagePayload)
 
+	span := ctx.Span().StartSpan("image.fetch", nil)
+	defer span.End()
+
 	// create image options for the constructor
 	// the options structure will contain the data necessary to create the image
 	// and if the properties are JSON serialized they can be used to hash the object
@@ -134,6 +146,7 @@ func (ic *ImageCache) Require(ctx *runtime.TaskContext, imagePayload interface{}
 
 	handle, err := ic.cache.Require(taskContextWithProgress{ctx, prefix}, options)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 	return &ImageHandle{
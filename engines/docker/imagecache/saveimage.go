@@ -0,0 +1,72 @@
+// +build linux
+
+package imagecache
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/DataDog/zstd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const dockerExportImageInactivityTimeout = 5 * 60 * time.Second
+
+// SaveImage writes the docker image given by imageID to w as a zstd compressed
+// tar-ball in the `docker save` format. The image will be renamed to imageName
+// on-the-fly, such that the image doesn't carry the name it was given locally.
+//
+// The tar-ball written is the format that ImageCache loads images from, when
+// images are referenced by artifact, index or URL.
+func SaveImage(ctx context.Context, client *docker.Client, imageID, imageName string, w io.Writer) error {
+	// Create zstd writer for the compressed tar-stream
+	zw := zstd.NewWriter(w)
+
+	var rerr, derr error
+	ir, iw := io.Pipe() // create an image pipe for the image being saved
+
+	// ensure we cancel the docker export call
+	c, cancel := context.WithCancel(ctx)
+	defer cancel()
+	util.Parallel(func() {
+		defer func() {
+			if rerr == nil {
+				// tar-stream may be followed by padding we haven't read yet
+				_, rerr = io.Copy(ioutil.Discard, ir)
+			}
+			ir.CloseWithError(rerr) // ensure we don't deadlock the write side in case of error
+			if rerr != nil {
+				cancel() // cancel early if there was an error
+			}
+		}()
+		rerr = renameDockerImageTarStream(imageName, ir, zw)
+	}, func() {
+		defer func() {
+			iw.CloseWithError(derr) // always close the image writer pipe
+		}()
+		derr = client.ExportImage(docker.ExportImageOptions{
+			Name:              imageID,
+			OutputStream:      iw,
+			InactivityTimeout: dockerExportImageInactivityTimeout,
+			Context:           c,
+		})
+	})
+	// An error exporting the image is more interesting than an error renaming
+	// the tar-stream, as the later is likely caused by the former.
+	if derr != nil {
+		zw.Close()
+		return errors.Wrap(derr, "failed to export docker image")
+	}
+	if rerr != nil {
+		zw.Close()
+		return errors.Wrap(rerr, "failed to rename exported docker image")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "failed to close zstd stream")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// +build linux,docker
+
+package imagecache
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/DataDog/zstd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveImage(t *testing.T) {
+	// Skip if we don't have a docker socket
+	info, err := os.Stat(dockerSocket)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		t.Skip("didn't find docker socket at:", dockerSocket)
+	}
+
+	// Create docker client
+	client, err := docker.NewClient("unix://" + dockerSocket)
+	require.NoError(t, err, "failed to create docker client")
+
+	debug("### Pull Image")
+	err = client.PullImage(docker.PullImageOptions{
+		Repository: testImage,
+	}, docker.AuthConfiguration{})
+	require.NoError(t, err)
+
+	debug("### Save Image")
+	b := bytes.NewBuffer(nil)
+	err = SaveImage(context.Background(), client, testImage, "test/saved-image", b)
+	require.NoError(t, err)
+
+	debug("### Check that the image was renamed")
+	zr := zstd.NewReader(b)
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		var manifest []manifestEntry
+		require.NoError(t, json.Unmarshal(data, &manifest))
+		require.Len(t, manifest, 1)
+		require.Equal(t, []string{"test/saved-image:latest"}, manifest[0].RepoTags)
+		found = true
+	}
+	require.True(t, found, "expected manifest.json in saved image")
+}
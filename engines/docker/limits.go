@@ -0,0 +1,197 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"fmt"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// dockerCPUPeriod is the CFS period used when limiting the number of CPUs a
+// container can use, this is the docker default of 100ms.
+const dockerCPUPeriod = 100000
+
+// limitsType holds resource limits for a task container, zero values
+// indicate that no limit is imposed.
+type limitsType struct {
+	Memory    int     `json:"memory,omitempty"`
+	CPUs      float64 `json:"cpus,omitempty"`
+	CPUShares int     `json:"cpuShares,omitempty"`
+	Pids      int     `json:"pids,omitempty"`
+}
+
+func newLimitsSchema(title, description string) schematypes.Object {
+	return schematypes.Object{
+		Title:       title,
+		Description: description,
+		Properties: schematypes.Properties{
+			"memory": schematypes.Integer{
+				Title: "Memory Limit",
+				Description: util.Markdown(`
+					Maximum memory the task container can use in MiB, if the task
+					container exceeds this limit it will be killed by the OOM killer.
+				`),
+				Minimum: 4,           // docker requires at-least 4 MiB
+				Maximum: 1024 * 1024, // 1 TiB
+			},
+			"cpus": schematypes.Number{
+				Title: "CPU Limit",
+				Description: util.Markdown(`
+					Number of CPUs the task container can use, this may be a fraction.
+					For example '1.5' allows the task container to use at most one and a
+					half CPU worth of CPU time.
+				`),
+				Minimum: 0.01,
+				Maximum: 1024,
+			},
+			"cpuShares": schematypes.Integer{
+				Title: "CPU Shares",
+				Description: util.Markdown(`
+					Relative weight of the task container when competing for CPU time
+					with other containers. Docker defaults to '1024'.
+				`),
+				Minimum: 2,
+				Maximum: 262144,
+			},
+			"pids": schematypes.Integer{
+				Title: "Process Limit",
+				Description: util.Markdown(`
+					Maximum number of processes and threads that can exist
+					in the task container at the same time.
+				`),
+				Minimum: 1,
+				Maximum: 4 * 1024 * 1024,
+			},
+		},
+	}
+}
+
+var defaultLimitsSchema = newLimitsSchema("Default Limits", util.Markdown(`
+	Resource limits imposed on task containers, if not specified in
+	'task.payload.limits'. If a default limit is not given, the
+	maximum limit will be used as default.
+`))
+
+var maxLimitsSchema = newLimitsSchema("Maximum Limits", util.Markdown(`
+	Maximum resource limits that can be requested in 'task.payload.limits'.
+	Tasks requesting limits higher than these will be resolved
+	'malformed-payload'. If a maximum limit is not given, tasks may request
+	any limit they like.
+`))
+
+var payloadLimitsSchema = newLimitsSchema("Resource Limits", util.Markdown(`
+	Resource limits for the task container, limits not specified will be given
+	default values from the worker configuration. Tasks may not request limits
+	higher than what the worker configuration allows.
+`))
+
+// WithDefaults returns limits where all zero values have been replaced by
+// values from defaults.
+func (l limitsType) WithDefaults(defaults limitsType) limitsType {
+	if l.Memory == 0 {
+		l.Memory = defaults.Memory
+	}
+	if l.CPUs == 0 {
+		l.CPUs = defaults.CPUs
+	}
+	if l.CPUShares == 0 {
+		l.CPUShares = defaults.CPUShares
+	}
+	if l.Pids == 0 {
+		l.Pids = defaults.Pids
+	}
+	return l
+}
+
+// exceeds returns the properties of l that exceed the maximum limits given,
+// zero values in maximum are considered unbounded.
+func (l limitsType) exceeds(maximum limitsType) []string {
+	var props []string
+	if maximum.Memory != 0 && l.Memory > maximum.Memory {
+		props = append(props, "memory")
+	}
+	if maximum.CPUs != 0 && l.CPUs > maximum.CPUs {
+		props = append(props, "cpus")
+	}
+	if maximum.CPUShares != 0 && l.CPUShares > maximum.CPUShares {
+		props = append(props, "cpuShares")
+	}
+	if maximum.Pids != 0 && l.Pids > maximum.Pids {
+		props = append(props, "pids")
+	}
+	return props
+}
+
+// Validate returns a MalformedPayloadError if l exceeds the maximum limits
+// given, zero values in maximum are considered unbounded.
+func (l limitsType) Validate(maximum limitsType) error {
+	var errs []*runtime.MalformedPayloadError
+	for _, prop := range l.exceeds(maximum) {
+		var msg string
+		switch prop {
+		case "memory":
+			msg = fmt.Sprintf(
+				"task.payload.limits.memory = %d MiB exceeds the maximum allowed memory limit of %d MiB",
+				l.Memory, maximum.Memory,
+			)
+		case "cpus":
+			msg = fmt.Sprintf(
+				"task.payload.limits.cpus = %g exceeds the maximum allowed CPU limit of %g",
+				l.CPUs, maximum.CPUs,
+			)
+		case "cpuShares":
+			msg = fmt.Sprintf(
+				"task.payload.limits.cpuShares = %d exceeds the maximum allowed CPU shares of %d",
+				l.CPUShares, maximum.CPUShares,
+			)
+		case "pids":
+			msg = fmt.Sprintf(
+				"task.payload.limits.pids = %d exceeds the maximum allowed process limit of %d",
+				l.Pids, maximum.Pids,
+			)
+		}
+		errs = append(errs, runtime.NewMalformedPayloadError(msg))
+	}
+	if len(errs) > 0 {
+		return runtime.MergeMalformedPayload(errs...)
+	}
+	return nil
+}
+
+// validateConfig returns an error if defaults exceeds the maximum limits in
+// the engine configuration.
+func validateConfig(defaults, maximum limitsType) error {
+	props := defaults.exceeds(maximum)
+	if len(props) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(props))
+	for i, prop := range props {
+		msgs[i] = fmt.Sprintf("defaultLimits.%s exceeds maxLimits.%s", prop, prop)
+	}
+	return fmt.Errorf("invalid docker engine config: %s", strings.Join(msgs, ", "))
+}
+
+// ApplyHostConfig sets the limits on the given docker.HostConfig
+func (l limitsType) ApplyHostConfig(hc *docker.HostConfig) {
+	if l.Memory != 0 {
+		hc.Memory = int64(l.Memory) * 1024 * 1024
+		// Setting MemorySwap equal to Memory prevents the container from using swap
+		hc.MemorySwap = hc.Memory
+	}
+	if l.CPUs != 0 {
+		hc.CPUPeriod = dockerCPUPeriod
+		hc.CPUQuota = int64(l.CPUs * dockerCPUPeriod)
+	}
+	if l.CPUShares != 0 {
+		hc.CPUShares = int64(l.CPUShares)
+	}
+	if l.Pids != 0 {
+		hc.PidsLimit = int64(l.Pids)
+	}
+}
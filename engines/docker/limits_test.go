@@ -0,0 +1,53 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsWithDefaults(t *testing.T) {
+	defaults := limitsType{Memory: 512, CPUs: 1, CPUShares: 1024, Pids: 100}
+	maximum := limitsType{Memory: 1024, CPUs: 2, CPUShares: 2048, Pids: 200}
+
+	l := limitsType{Memory: 256}.WithDefaults(defaults).WithDefaults(maximum)
+	assert.Equal(t, limitsType{Memory: 256, CPUs: 1, CPUShares: 1024, Pids: 100}, l)
+
+	l = limitsType{}.WithDefaults(limitsType{}).WithDefaults(maximum)
+	assert.Equal(t, maximum, l)
+}
+
+func TestLimitsValidate(t *testing.T) {
+	maximum := limitsType{Memory: 1024, CPUs: 2}
+
+	assert.NoError(t, limitsType{Memory: 1024, CPUs: 1.5, Pids: 5000}.Validate(maximum))
+	assert.Error(t, limitsType{Memory: 1025}.Validate(maximum))
+	assert.Error(t, limitsType{CPUs: 2.5}.Validate(maximum))
+	assert.NoError(t, limitsType{Memory: 4096, CPUs: 32}.Validate(limitsType{}))
+}
+
+func TestLimitsValidateConfig(t *testing.T) {
+	maximum := limitsType{Memory: 1024, CPUs: 2}
+
+	assert.NoError(t, validateConfig(limitsType{Memory: 512}, maximum))
+	err := validateConfig(limitsType{Memory: 2048, CPUs: 4}, maximum)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "defaultLimits.memory exceeds maxLimits.memory")
+	assert.Contains(t, err.Error(), "defaultLimits.cpus exceeds maxLimits.cpus")
+	assert.NotContains(t, err.Error(), "task.payload")
+}
+
+func TestLimitsApplyHostConfig(t *testing.T) {
+	hc := &docker.HostConfig{}
+	limitsType{Memory: 512, CPUs: 1.5, Pids: 100}.ApplyHostConfig(hc)
+	require.Equal(t, int64(512*1024*1024), hc.Memory)
+	require.Equal(t, hc.Memory, hc.MemorySwap)
+	require.Equal(t, int64(150000), hc.CPUQuota)
+	require.Equal(t, int64(dockerCPUPeriod), hc.CPUPeriod)
+	require.Equal(t, int64(0), hc.CPUShares)
+	require.Equal(t, int64(100), hc.PidsLimit)
+}
@@ -38,6 +38,7 @@ const maxConcurrentFileHandlerCalls = 5
 type resultSet struct {
 	engines.ResultSetBase
 	success       bool
+	usage         engines.ResourceUsage
 	containerID   string
 	docker        *docker.Client
 	monitor       runtime.Monitor
@@ -45,12 +46,17 @@ type resultSet struct {
 	context       *runtime.TaskContext
 	networkHandle *network.Handle
 	imageHandle   *imagecache.ImageHandle
+	archiveMode   string
 }
 
 func (r *resultSet) Success() bool {
 	return r.success
 }
 
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	return r.usage, nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
 	// We'll treat paths ending with a slash as paths to folders
 	if strings.HasSuffix(path, "/") {
@@ -5,6 +5,7 @@ package dockerengine
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -32,6 +33,14 @@ type sandbox struct {
 	taskCtx       *runtime.TaskContext
 	networkHandle *network.Handle
 	imageHandle   *imagecache.ImageHandle
+	privileged    bool
+	limits        limitsType
+	archiveMode   string
+	commit        commitImageType
+	stats         *statsCollector
+	sessions      atomics.WaitGroup
+	mShells       sync.Mutex
+	shells        []*shell
 }
 
 func newSandbox(sb *sandboxBuilder) (*sandbox, error) {
@@ -52,6 +61,16 @@ func newSandbox(sb *sandboxBuilder) (*sandbox, error) {
 		return nil, errors.Wrap(err, "docker.CreateNetwork failed")
 	}
 
+	// Create host config with resource limits
+	hostConfig := &docker.HostConfig{
+		Privileged: sb.payload.Privileged,
+		// gateway IP is also the host machine that we're listening for requests
+		// to the proxies added to proxyMux above..
+		ExtraHosts: []string{fmt.Sprintf("taskcluster:%s", networkHandle.Gateway())},
+		Mounts:     sb.mounts,
+	}
+	sb.payload.Limits.ApplyHostConfig(hostConfig)
+
 	// Create the container
 	container, err := sb.e.docker.CreateContainer(docker.CreateContainerOptions{
 		Config: &docker.Config{
@@ -64,13 +83,7 @@ func newSandbox(sb *sandboxBuilder) (*sandbox, error) {
 				"taskId": sb.taskCtx.TaskID,
 			},
 		},
-		HostConfig: &docker.HostConfig{
-			Privileged: sb.payload.Privileged,
-			// gateway IP is also the host machine that we're listening for requests
-			// to the proxies added to proxyMux above..
-			ExtraHosts: []string{fmt.Sprintf("taskcluster:%s", networkHandle.Gateway())},
-			Mounts:     sb.mounts,
-		},
+		HostConfig: hostConfig,
 		NetworkingConfig: &docker.NetworkingConfig{
 			EndpointsConfig: map[string]*docker.EndpointConfig{
 				networkHandle.NetworkID(): {},
@@ -97,6 +110,10 @@ func newSandbox(sb *sandboxBuilder) (*sandbox, error) {
 		taskCtx:       sb.taskCtx,
 		networkHandle: networkHandle,
 		imageHandle:   imageHandle,
+		privileged:    sb.payload.Privileged,
+		limits:        sb.payload.Limits,
+		archiveMode:   sb.e.config.ArchiveSandboxMode,
+		commit:        sb.payload.Commit,
 		monitor: monitor.WithTags(map[string]string{
 			"containerId": container.ID,
 			"networkId":   networkHandle.NetworkID(),
@@ -125,6 +142,9 @@ func newSandbox(sb *sandboxBuilder) (*sandbox, error) {
 		return nil, errors.Wrap(err, "docker.StartContainer failed")
 	}
 
+	// Collect stats, so we can report resource usage
+	s.stats = newStatsCollector(s.docker, s.containerID)
+
 	go s.wait()
 
 	return s, nil
@@ -137,6 +157,11 @@ func (s *sandbox) WaitForResult() (engines.ResultSet, error) {
 
 func (s *sandbox) wait() {
 	exitCode, err := s.docker.WaitContainer(s.containerID)
+
+	// Wait for all shells to finish and prevent new shells from being created
+	s.sessions.WaitAndDrain()
+	debug("All shells terminated for containerId: %s", s.containerID)
+
 	s.resolve.Do(func() {
 		if err != nil {
 			incidentID := s.monitor.ReportError(err, "docker.WaitContainer failed")
@@ -145,37 +170,69 @@ func (s *sandbox) wait() {
 			s.abortErr = engines.ErrSandboxTerminated
 			return
 		}
-		s.resultSet = &resultSet{
-			success:       exitCode == 0,
-			containerID:   s.containerID,
-			docker:        s.docker,
-			monitor:       s.monitor.WithTag("struct", "resultSet"),
-			storage:       s.storage,
-			context:       s.taskCtx,
-			networkHandle: s.networkHandle,
-			imageHandle:   s.imageHandle,
+		if exitCode != 0 {
+			s.reportOOMKilled()
 		}
+
+		// Commit the container as an image, if requested and task was successful.
+		// This is done while resolving, such that Abort() waits for the commit to
+		// finish before the container and storage is disposed.
+		success := exitCode == 0
+		if success && s.commit.Artifact != "" {
+			success = s.commitImage()
+		}
+		s.resultSet = s.newResultSet(success)
 		s.abortErr = engines.ErrSandboxTerminated
 	})
 }
 
+// newResultSet creates a resultSet, transferring resources held by sandbox
+func (s *sandbox) newResultSet(success bool) *resultSet {
+	return &resultSet{
+		success:       success,
+		usage:         s.stats.Stop(),
+		containerID:   s.containerID,
+		docker:        s.docker,
+		monitor:       s.monitor.WithTag("struct", "resultSet"),
+		storage:       s.storage,
+		context:       s.taskCtx,
+		networkHandle: s.networkHandle,
+		imageHandle:   s.imageHandle,
+		archiveMode:   s.archiveMode,
+	}
+}
+
+// reportOOMKilled writes a message to the task log, if the container was
+// killed by the OOM killer.
+func (s *sandbox) reportOOMKilled() {
+	container, err := s.docker.InspectContainer(s.containerID)
+	if err != nil {
+		s.monitor.ReportWarning(err, "docker.InspectContainer failed, can't determine if task was OOM killed")
+		return
+	}
+	if !container.State.OOMKilled {
+		return
+	}
+	s.monitor.Count("oom-killed", 1)
+	if s.limits.Memory != 0 {
+		s.taskCtx.LogError(fmt.Sprintf(
+			"Task container was killed by the OOM killer, because it exceeded the memory limit of %d MiB",
+			s.limits.Memory,
+		))
+	} else {
+		s.taskCtx.LogError("Task container was killed by the OOM killer, because the host ran out of memory")
+	}
+}
+
 func (s *sandbox) Kill() error {
 	s.resolve.Do(func() {
 		debug("Sandbox.Kill() for containerId: %s", s.containerID)
+		s.abortShells()
 		s.resultErr = s.attemptGracefulTermination()
 
 		// Create resultSet
 		if s.resultErr == nil {
-			s.resultSet = &resultSet{
-				success:       false,
-				containerID:   s.containerID,
-				docker:        s.docker,
-				monitor:       s.monitor.WithTag("struct", "resultSet"),
-				storage:       s.storage,
-				context:       s.taskCtx,
-				networkHandle: s.networkHandle,
-				imageHandle:   s.imageHandle,
-			}
+			s.resultSet = s.newResultSet(false)
 			s.abortErr = engines.ErrSandboxTerminated
 		} else {
 			s.dispose()
@@ -188,6 +245,7 @@ func (s *sandbox) Kill() error {
 func (s *sandbox) Abort() error {
 	s.resolve.Do(func() {
 		debug("Sandbox.Abort() for containerId: %s", s.containerID)
+		s.abortShells()
 		s.attemptGracefulTermination()
 		s.abortErr = s.dispose()
 		s.resultErr = engines.ErrSandboxAborted
@@ -196,6 +254,76 @@ func (s *sandbox) Abort() error {
 	return s.abortErr
 }
 
+func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
+	s.mShells.Lock()
+	defer s.mShells.Unlock()
+
+	// Increment shell counter, if draining we don't allow new shells
+	if s.sessions.Add(1) != nil {
+		return nil, engines.ErrSandboxTerminated
+	}
+
+	debug("NewShell with: %v in containerId: %s", command, s.containerID)
+	S, err := newShell(s, command, tty)
+	if err == engines.ErrSandboxTerminated {
+		s.sessions.Done()
+		return nil, err
+	}
+	if err != nil {
+		s.monitor.ReportWarning(err, "failed to start shell")
+		s.sessions.Done()
+		return nil, runtime.NewMalformedPayloadError(
+			"Unable to spawn command: ", command, " error: ", err,
+		)
+	}
+
+	// Add shells to list
+	s.shells = append(s.shells, S)
+
+	// Wait for the S to be done and decrement WaitGroup
+	go func() {
+		result, _ := S.Wait()
+		debug("Shell finished with: %v", result)
+
+		s.mShells.Lock()
+		defer s.mShells.Unlock()
+
+		// remove S from s.shells
+		shells := make([]*shell, 0, len(s.shells))
+		for _, s2 := range s.shells {
+			if s2 != S {
+				shells = append(shells, s2)
+			}
+		}
+		s.shells = shells
+
+		// Mark as done
+		s.sessions.Done()
+	}()
+
+	return S, nil
+}
+
+// abortShells prevents new shells and aborts all existing shells
+func (s *sandbox) abortShells() {
+	s.mShells.Lock()
+
+	// Prevent new shells
+	s.sessions.Drain()
+
+	// Abort all shells
+	for _, S := range s.shells {
+		go S.Abort()
+	}
+	s.shells = nil
+
+	// can't hold lock while waiting for session to finish
+	s.mShells.Unlock()
+
+	// Wait for all shells to be done
+	s.sessions.Wait()
+}
+
 // attemptGracefulTermination will attempt a graceful termination of the
 // container and ignore ContainerNotRunning errors.
 func (s *sandbox) attemptGracefulTermination() error {
@@ -250,6 +378,9 @@ func (s *sandbox) attemptGracefulTermination() error {
 func (s *sandbox) dispose() error {
 	hasErr := false
 
+	// Stop collecting stats
+	s.stats.Stop()
+
 	// Remove the container
 	err := s.docker.RemoveContainer(docker.RemoveContainerOptions{
 		ID:            s.containerID,
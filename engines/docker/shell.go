@@ -0,0 +1,287 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// dockerExecKillTimeout is the maximum time we wait for the exec instance
+// used to kill a shell.
+const dockerExecKillTimeout = 30 * time.Second
+
+// dockerExecPollInterval is the interval between inspecting an exec instance
+// while waiting for it to stop running.
+const dockerExecPollInterval = 100 * time.Millisecond
+
+// dockerExecPollAttempts is the number of times we inspect an exec instance
+// before giving up waiting for it to stop running.
+const dockerExecPollAttempts = 50
+
+// shellWrapper is a script that records the PID of the shell in a pid-file
+// given as $0, and then replaces itself with the command given as arguments.
+// This allows us to kill the shell later, as docker has no API for killing
+// an exec instance.
+const shellWrapper = `echo $$ > "$0" && exec "$@"`
+
+// shellKiller is a script that kills the process (group) whose PID is stored
+// in the pid-file given as $0. It exits 3, if the pid-file doesn't exist yet.
+const shellKiller = `test -f "$0" || exit 3; PID=$(cat "$0"); kill -9 -"$PID" 2> /dev/null || kill -9 "$PID"; rm -f "$0"`
+
+type shell struct {
+	docker      *docker.Client
+	monitor     runtime.Monitor
+	containerID string
+	execID      string
+	pidFile     string
+	tty         bool
+	stdin       io.WriteCloser
+	stdout      io.ReadCloser
+	stderr      io.ReadCloser
+	pipeout     *io.PipeWriter
+	pipeerr     *io.PipeWriter
+	closeWaiter docker.CloseWaiter
+	resolve     atomics.Once // Guarding result, resultErr and abortErr
+	result      bool
+	resultErr   error
+	abortErr    error
+	aborted     atomics.Bool
+}
+
+func newShell(s *sandbox, command []string, tty bool) (*shell, error) {
+	// If no command is given we default to 'sh'
+	if len(command) == 0 {
+		command = []string{"sh"}
+	}
+
+	// Setup some pipes
+	pipein, stdin := io.Pipe()
+	stdout, pipeout := io.Pipe()
+	var stderr io.ReadCloser
+	var pipeerr *io.PipeWriter
+	if !tty {
+		stderr, pipeerr = io.Pipe()
+	} else {
+		// If doing a TTY we merge stderr and stdout, so stderr just becomes an
+		// empty stream as far as client is aware
+		stderr = ioutil.NopCloser(bytes.NewBuffer(nil))
+	}
+
+	// Create an exec instance wrapping the command, so that we can kill it
+	pidFile := fmt.Sprintf("/tmp/.taskcluster-shell-%s.pid", slugid.Nice())
+	exec, err := s.docker.CreateExec(docker.CreateExecOptions{
+		Container:    s.containerID,
+		Cmd:          append([]string{"sh", "-c", shellWrapper, pidFile}, command...),
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          tty,
+		Privileged:   s.privileged,
+	})
+	if err != nil {
+		if e, ok := err.(*docker.Error); ok && e.Status == http.StatusConflict {
+			return nil, engines.ErrSandboxTerminated
+		}
+		return nil, errors.Wrap(err, "docker.CreateExec failed")
+	}
+
+	S := &shell{
+		docker:      s.docker,
+		monitor:     s.monitor.WithTag("execId", exec.ID),
+		containerID: s.containerID,
+		execID:      exec.ID,
+		pidFile:     pidFile,
+		tty:         tty,
+		stdin:       stdin,
+		stdout:      stdout,
+		stderr:      stderr,
+		pipeout:     pipeout,
+		pipeerr:     pipeerr,
+	}
+
+	// Start the exec instance, docker will merge stderr into stdout for TTYs
+	opts := docker.StartExecOptions{
+		InputStream:  pipein,
+		OutputStream: pipeout,
+		Tty:          tty,
+		RawTerminal:  tty,
+	}
+	if pipeerr != nil {
+		opts.ErrorStream = pipeerr
+	}
+	S.closeWaiter, err = s.docker.StartExecNonBlocking(exec.ID, opts)
+	if err != nil {
+		S.closePipes()
+		return nil, errors.Wrap(err, "docker.StartExecNonBlocking failed")
+	}
+
+	go S.waitForResult()
+
+	return S, nil
+}
+
+func (s *shell) closePipes() {
+	s.pipeout.Close()
+	if s.pipeerr != nil {
+		s.pipeerr.Close()
+	}
+}
+
+func (s *shell) waitForResult() {
+	// wait for the attached streams to end
+	werr := s.closeWaiter.Wait()
+	s.closePipes()
+	debug("shell streams ended, execId: %s", s.execID)
+
+	// Don't bother inspecting the exec instance, if we've been aborted
+	if s.aborted.Get() {
+		return
+	}
+
+	exitCode, err := waitForExec(s.docker, s.execID)
+
+	s.resolve.Do(func() {
+		if err != nil {
+			s.monitor.ReportError(err, "failed to inspect docker exec instance for shell")
+			s.resultErr = runtime.ErrNonFatalInternalError
+		} else if werr != nil {
+			debug("streams for shell with execId: %s ended with error: %s", s.execID, werr)
+		}
+		s.result = err == nil && exitCode == 0
+		s.abortErr = engines.ErrShellTerminated
+	})
+}
+
+func (s *shell) StdinPipe() io.WriteCloser {
+	return s.stdin
+}
+
+func (s *shell) StdoutPipe() io.ReadCloser {
+	return s.stdout
+}
+
+func (s *shell) StderrPipe() io.ReadCloser {
+	return s.stderr
+}
+
+func (s *shell) SetSize(columns, rows uint16) error {
+	// Best effort check if we've terminated
+	if s.aborted.Get() {
+		return engines.ErrShellAborted
+	}
+	if s.resolve.IsDone() {
+		return engines.ErrShellTerminated
+	}
+	// Feature not supported if not tty
+	if !s.tty {
+		return engines.ErrFeatureNotSupported
+	}
+	err := s.docker.ResizeExecTTY(s.execID, int(rows), int(columns))
+	if err != nil {
+		// If the shell terminated while we were resizing, this is not an error
+		if s.resolve.IsDone() {
+			return engines.ErrShellTerminated
+		}
+		s.monitor.ReportWarning(err, "docker.ResizeExecTTY failed")
+	}
+	return nil
+}
+
+func (s *shell) Abort() error {
+	s.resolve.Do(func() {
+		s.aborted.Set(true)
+		s.kill()
+		s.resultErr = engines.ErrShellAborted
+	})
+	s.resolve.Wait()
+	return s.abortErr
+}
+
+func (s *shell) Wait() (bool, error) {
+	s.resolve.Wait()
+	return s.result, s.resultErr
+}
+
+// kill the process running in the exec instance and close all streams
+func (s *shell) kill() {
+	defer s.closeWaiter.Close()
+	defer s.closePipes()
+
+	// The wrapper may not have written the pid-file yet, so we try a few times
+	for attempt := 0; attempt < dockerExecPollAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(dockerExecPollInterval)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dockerExecKillTimeout)
+		exec, err := s.docker.CreateExec(docker.CreateExecOptions{
+			Container: s.containerID,
+			Cmd:       []string{"sh", "-c", shellKiller, s.pidFile},
+			Context:   ctx,
+		})
+		if err == nil {
+			err = s.docker.StartExec(exec.ID, docker.StartExecOptions{
+				Detach:  true,
+				Context: ctx,
+			})
+		}
+		cancel()
+		if e, ok := err.(*docker.Error); ok && e.Status == http.StatusConflict {
+			return // container isn't running, so neither is the shell
+		}
+		if err != nil {
+			s.monitor.ReportError(err, "failed to create docker exec instance for killing shell")
+			return
+		}
+
+		exitCode, err := waitForExec(s.docker, exec.ID)
+		if err != nil {
+			s.monitor.ReportError(err, "failed to inspect docker exec instance for killing shell")
+			return
+		}
+		if exitCode != 3 {
+			return
+		}
+		// If the shell has finished, there is no pid-file to wait for
+		if ei, ierr := s.docker.InspectExec(s.execID); ierr == nil && !ei.Running {
+			return
+		}
+	}
+	s.monitor.Warn("gave up waiting for pid-file from shell, execId: ", s.execID)
+}
+
+// waitForExec waits for an exec instance to stop running and returns the
+// exit code.
+func waitForExec(client *docker.Client, execID string) (int, error) {
+	// docker may report the exec instance as running for a short while after
+	// the attached streams have been closed.
+	for attempt := 0; attempt < dockerExecPollAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(dockerExecPollInterval)
+		}
+		ei, err := client.InspectExec(execID)
+		if err != nil {
+			return -1, errors.Wrap(err, "docker.InspectExec failed")
+		}
+		if !ei.Running {
+			return ei.ExitCode, nil
+		}
+	}
+	return -1, fmt.Errorf(
+		"docker exec instance: %s is still running after %s",
+		execID, dockerExecPollInterval*dockerExecPollAttempts,
+	)
+}
@@ -0,0 +1,113 @@
+// +build linux
+
+package dockerengine
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+// statsCollector streams stats for a container and keeps track of resource
+// usage, docker stats are cumulative so we just keep the latest values.
+type statsCollector struct {
+	m       sync.Mutex
+	usage   engines.ResourceUsage
+	stop    chan bool
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// newStatsCollector starts collecting stats for containerID, the collector
+// must be stopped with Stop() to release the stats stream.
+func newStatsCollector(client *docker.Client, containerID string) *statsCollector {
+	c := &statsCollector{
+		usage:   engines.NewResourceUsage(),
+		stop:    make(chan bool),
+		stopped: make(chan struct{}),
+	}
+	stats := make(chan *docker.Stats)
+	go func() {
+		// Stats closes the stats channel when it returns
+		err := client.Stats(docker.StatsOptions{
+			ID:     containerID,
+			Stats:  stats,
+			Stream: true,
+			Done:   c.stop,
+		})
+		if err != nil {
+			debug("docker.Stats(%s) failed, error: %s", containerID, err)
+		}
+	}()
+	go func() {
+		defer close(c.stopped)
+		for s := range stats {
+			c.update(s)
+		}
+	}()
+	return c
+}
+
+func (c *statsCollector) update(s *docker.Stats) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// Stats are sometimes empty when the container is exiting, so we never let
+	// values decrease.
+	if cpu := time.Duration(s.CPUStats.CPUUsage.TotalUsage); cpu > c.usage.CPUTime {
+		c.usage.CPUTime = cpu
+	}
+	peak := s.MemoryStats.MaxUsage
+	if s.MemoryStats.Usage > peak {
+		peak = s.MemoryStats.Usage
+	}
+	if int64(peak) > c.usage.PeakMemory {
+		c.usage.PeakMemory = int64(peak)
+	}
+
+	var read, write int64
+	for _, entry := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += int64(entry.Value)
+		case "write":
+			write += int64(entry.Value)
+		}
+	}
+	if len(s.BlkioStats.IOServiceBytesRecursive) > 0 {
+		if read > c.usage.DiskReadBytes {
+			c.usage.DiskReadBytes = read
+		}
+		if write > c.usage.DiskWriteBytes {
+			c.usage.DiskWriteBytes = write
+		}
+	}
+
+	var rx, tx int64
+	for _, network := range s.Networks {
+		rx += int64(network.RxBytes)
+		tx += int64(network.TxBytes)
+	}
+	if len(s.Networks) > 0 {
+		if rx > c.usage.NetworkRxBytes {
+			c.usage.NetworkRxBytes = rx
+		}
+		if tx > c.usage.NetworkTxBytes {
+			c.usage.NetworkTxBytes = tx
+		}
+	}
+}
+
+// Stop stops collecting stats and returns the resource usage collected, this
+// may be called more than once.
+func (c *statsCollector) Stop() engines.ResourceUsage {
+	c.once.Do(func() { close(c.stop) })
+	<-c.stopped
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.usage
+}
@@ -380,3 +380,13 @@ func (s *sandbox) Success() bool {
 	// No need to lock access as result is immutable
 	return s.result
 }
+
+func (s *sandbox) ResourceUsage() (engines.ResourceUsage, error) {
+	// Report fixed values, leaving network usage unavailable
+	usage := engines.NewResourceUsage()
+	usage.CPUTime = 250 * time.Millisecond
+	usage.PeakMemory = 64 * 1024 * 1024
+	usage.DiskReadBytes = 4096
+	usage.DiskWriteBytes = 8192
+	return usage, nil
+}
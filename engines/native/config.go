@@ -2,12 +2,87 @@ package nativeengine
 
 import (
 	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type config struct {
-	Groups     []string `json:"groups,omitempty"`
-	CreateUser bool     `json:"createUser"`
+	Groups     []string      `json:"groups,omitempty"`
+	CreateUser bool          `json:"createUser"`
+	CGroups    *cgroupConfig `json:"cgroups,omitempty"`
+}
+
+// cgroupConfig holds the parent cgroup and resource limits for tasks, zero
+// limits indicate that no limit is imposed.
+type cgroupConfig struct {
+	Parent string  `json:"parent"`
+	Memory int     `json:"memory,omitempty"`
+	CPUs   float64 `json:"cpus,omitempty"`
+	Pids   int     `json:"pids,omitempty"`
+}
+
+// Limits returns the limits as system.CGroupLimits
+func (c *cgroupConfig) Limits() system.CGroupLimits {
+	return system.CGroupLimits{
+		Memory: int64(c.Memory) * 1024 * 1024,
+		CPUs:   c.CPUs,
+		Pids:   c.Pids,
+	}
+}
+
+var cgroupConfigSchema = schematypes.Object{
+	Title: "CGroup Configuration",
+	Description: util.Markdown(`
+		Run each task in its own cgroup with the given resource limits, this
+		is only supported on Linux with cgroup v2.
+
+		When a task is resolved or aborted all processes in the cgroup are
+		killed, including processes that have been daemonized. Peak memory and
+		CPU time used by the task is reported in the task log.
+	`),
+	Properties: schematypes.Properties{
+		"parent": schematypes.String{
+			Title: "Parent CGroup",
+			Description: util.Markdown(`
+				Absolute path to the cgroup v2 folder in which a cgroup is created
+				for each task, for example '/sys/fs/cgroup/taskcluster-worker/tasks'.
+
+				The folder will be created if missing, and it must be writable by
+				the worker. It cannot contain any processes, hence, the worker
+				itself must not be running in this cgroup.
+			`),
+			Pattern: "^/.+$",
+		},
+		"memory": schematypes.Integer{
+			Title: "Memory Limit",
+			Description: util.Markdown(`
+				Maximum memory a task can use in MiB, if the task exceeds this
+				limit processes will be killed by the OOM killer.
+			`),
+			Minimum: 4,
+			Maximum: 1024 * 1024, // 1 TiB
+		},
+		"cpus": schematypes.Number{
+			Title: "CPU Limit",
+			Description: util.Markdown(`
+				Number of CPUs a task can use, this may be a fraction. For example
+				'1.5' allows the task to use at most one and a half CPU worth of
+				CPU time.
+			`),
+			Minimum: 0.01,
+			Maximum: 1024,
+		},
+		"pids": schematypes.Integer{
+			Title: "Process Limit",
+			Description: util.Markdown(`
+				Maximum number of processes and threads that can exist in the task
+				cgroup at the same time.
+			`),
+			Minimum: 1,
+			Maximum: 4 * 1024 * 1024,
+		},
+	},
+	Required: []string{"parent"},
 }
 
 var configSchema = schematypes.Object{
@@ -41,6 +116,7 @@ var configSchema = schematypes.Object{
 				will run with the same user as the worker does.
 			`),
 		},
+		"cgroups": cgroupConfigSchema,
 	},
 	Required: []string{
 		"createUser",
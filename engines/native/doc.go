@@ -4,6 +4,11 @@
 // Platform specific methods such as run sub-process under a difference user,
 // add/remove users and management of user permissions are all implemented in
 // the system/ sub-package.
+//
+// Proxies attached to the sandbox are exposed on a per-task HTTP server on the
+// loopback device, the URL is given to the task in the environment variable
+// TASKCLUSTER_PROXY_URL, such that <name>/<path> can be appended to reach the
+// proxy attached as <name>.
 package nativeengine
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
@@ -2,11 +2,13 @@ package nativeengine
 
 import (
 	"fmt"
+	"net/http"
 
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/engines/native/system"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
 )
 
 type engineProvider struct {
@@ -19,6 +21,7 @@ type engine struct {
 	monitor     runtime.Monitor
 	config      config
 	groups      []*system.Group
+	mountCache  *caching.Cache
 }
 
 func init() {
@@ -46,12 +49,25 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 		groups = append(groups, group)
 	}
 
-	return &engine{
+	// Setup parent cgroup for tasks
+	if c.CGroups != nil {
+		if err := system.EnableCGroupControllers(c.CGroups.Parent); err != nil {
+			return nil, fmt.Errorf(
+				"unable to setup parent cgroup: %s from engine config, error: %s",
+				c.CGroups.Parent, err,
+			)
+		}
+	}
+
+	e := &engine{
 		environment: *options.Environment,
 		monitor:     options.Monitor,
 		config:      c,
 		groups:      groups,
-	}, nil
+	}
+	// Cache of fetched payload mounts, shared as contents are copied for each task
+	e.mountCache = caching.New(e.newMountContent, true, options.Environment.GarbageCollector, options.Monitor.WithPrefix("mount-cache"))
+	return e, nil
 }
 
 func (e *engine) PayloadSchema() schematypes.Object {
@@ -67,7 +83,27 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 		payload: p,
 		context: options.TaskContext,
 		env:     make(map[string]string),
+		proxies: make(map[string]http.Handler),
 		monitor: options.Monitor,
 	}
 	return b, nil
 }
+
+func (e *engine) VolumeSchema() schematypes.Schema {
+	return volumeSchema
+}
+
+func (e *engine) NewVolumeBuilder(options interface{}) (engines.VolumeBuilder, error) {
+	var opts volumeOptions
+	schematypes.MustValidateAndMap(e.VolumeSchema(), options, &opts)
+
+	return newVolumeBuilder(e)
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	vb, err := e.NewVolumeBuilder(options)
+	if err != nil {
+		return nil, err
+	}
+	return vb.BuildVolume()
+}
@@ -87,15 +87,12 @@ func TestEnvironmentVariables(t *testing.T) {
 	c.Test()
 }
 
-/*
-
 func TestAttachProxy(t *testing.T) {
-
 	c := enginetest.ProxyTestCase{
 		EngineProvider: provider,
 		ProxyName:      "test-proxy",
 		PingProxyPayload: `{
-			"command": ["sh", "-ec", "echo 'Pinging'; STATUS=$(curl -s -o /tmp/output -w '%{http_code}' http://taskcluster/test-proxy/v1/ping); cat /tmp/output; test $STATUS -eq 200;"]
+			"command": ["sh", "-ec", "echo 'Pinging'; STATUS=$(curl -s -o output.txt -w '%{http_code}' \"$TASKCLUSTER_PROXY_URL/test-proxy/v1/ping\"); cat output.txt; test $STATUS -eq 200;"]
 		}`,
 	}
 
@@ -105,7 +102,6 @@ func TestAttachProxy(t *testing.T) {
 	c.TestParallelPings()
 	c.Test()
 }
-*/
 
 func TestArtifacts(t *testing.T) {
 	c := enginetest.ArtifactTestCase{
@@ -164,6 +160,21 @@ func TestKill(t *testing.T) {
 	c.Test()
 }
 
+func TestVolumes(t *testing.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "caches/my-volume/",
+		WriteVolumePayload: `{
+			"command": ["sh", "-c", "echo 'hello-cache-volume' > caches/my-volume/cache-file.txt"]
+		}`,
+		CheckVolumePayload: `{
+			"command": ["sh", "-c", "cat caches/my-volume/cache-file.txt | grep 'hello-cache-volume'"]
+		}`,
+	}
+
+	c.Test()
+}
+
 func TestContext(t *testing.T) {
 	s := httptest.NewServer(http.FileServer(http.Dir("testdata/")))
 	defer s.Close()
@@ -203,4 +214,30 @@ func TestContext(t *testing.T) {
 		c.TestCommand()
 		c.Test()
 	})
+
+	t.Run("Mounts", func(t *testing.T) {
+		c := enginetest.ShellTestCase{
+			EngineProvider: provider,
+			Command:        "sub/folder/test.sh && bin/test.sh;\n",
+			Stdout:         "Test\nTest\n",
+			Stderr:         "",
+			BadCommand:     "exit 1;\n",
+			SleepCommand:   "sleep 30;\n",
+			Payload: `{
+				"command": ["sh", "-c", "sleep 1 && true"],
+				"mounts": [{
+					"content": "` + s.URL + `/folder.tar.gz",
+					"format": "tar.gz",
+					"path": "sub/"
+				}, {
+					"content": "` + s.URL + `/folder/test.sh",
+					"format": "file",
+					"path": "bin/test.sh"
+				}]
+			}`, // sleep in payload, sandbox doesn't terminate before shell is started
+		}
+
+		c.TestCommand()
+		c.Test()
+	})
 }
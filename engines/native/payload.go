@@ -6,8 +6,61 @@ import (
 )
 
 type payload struct {
-	Command []string `json:"command"`
-	Context string   `json:"context"`
+	Command []string       `json:"command"`
+	Context string         `json:"context"`
+	Mounts  []payloadMount `json:"mounts"`
+}
+
+// payloadMount is a file or archive to be fetched and extracted into the home
+// folder before the task is started.
+type payloadMount struct {
+	Content interface{} `json:"content"`
+	Format  string      `json:"format"`
+	Path    string      `json:"path"`
+}
+
+// Formats supported for payloadMount.Format
+const (
+	mountFormatFile  = "file"
+	mountFormatTar   = "tar"
+	mountFormatTarGz = "tar.gz"
+	mountFormatZip   = "zip"
+)
+
+var payloadMountSchema = schematypes.Object{
+	Title: "Mount",
+	Description: util.Markdown(`
+		A file or archive to be fetched and placed in the 'HOME' directory
+		before the command is executed. Fetched content is cached across tasks.
+	`),
+	Properties: schematypes.Properties{
+		"content": mountFetcher.Schema(),
+		"format": schematypes.StringEnum{
+			Title: "Content Format",
+			Description: util.Markdown(`
+				Format of the content, archives are extracted into the folder given
+				by 'path', whereas plain files are written to the file given by
+				'path'.
+			`),
+			Options: []string{
+				mountFormatFile,
+				mountFormatTar,
+				mountFormatTarGz,
+				mountFormatZip,
+			},
+		},
+		"path": schematypes.String{
+			Title: "Path",
+			Description: util.Markdown(`
+				Path relative to the 'HOME' directory, for archives this is the
+				folder to extract into and defaults to the 'HOME' directory. For
+				plain files this is the file to write and must be given, plain files
+				are made executable.
+			`),
+			Pattern: `^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)*/?$`,
+		},
+	},
+	Required: []string{"content", "format"},
 }
 
 var payloadSchema = schematypes.Object{
@@ -22,7 +75,17 @@ var payloadSchema = schematypes.Object{
 			Description: util.Markdown(`
 				Optional URL for a gzipped tar-ball to downloaded
 				and extracted in the 'HOME' directory for running the command.
+
+				Deprecated, use 'mounts' which supports more formats and sources.
+			`),
+		},
+		"mounts": schematypes.Array{
+			Title: "Mounts",
+			Description: util.Markdown(`
+				List of files and archives to be fetched and placed in the 'HOME'
+				directory, in the order given, before the command is executed.
 			`),
+			Items: payloadMountSchema,
 		},
 	},
 	Required: []string{"command"},
@@ -0,0 +1,361 @@
+package nativeengine
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+	"github.com/taskcluster/taskcluster-worker/engines/native/unpack"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// mountFetcher is used to fetch content for payload mounts
+var mountFetcher = fetcher.Combine(
+	// Allow fetching from URL
+	fetcher.URL,
+	// Allow fetching from queue artifacts
+	fetcher.Artifact,
+	// Allow fetching from queue referenced by index namespace
+	fetcher.Index,
+	// Allow fetching from URL + hash
+	fetcher.URLHash,
+)
+
+// mountContentFile is the name of the file in the mountContent folder, when
+// the format is mountFormatFile.
+const mountContentFile = "content"
+
+// mountOptions is the struct we pass to caching.Cache.Require() which then
+// passes it to engine.newMountContent as opts. The JSON serialization of the
+// exported properties is used as cache key.
+type mountOptions struct {
+	HashKey   string              `json:"hashKey"` // hash of resolved reference
+	Format    string              `json:"format"`
+	reference fetcher.Reference   // present so we can fetch resolved reference
+	queue     func() client.Queue // present so we can fetch resolved reference
+}
+
+// mountContent is the fetched and extracted content of a payload mount, which
+// is cached across tasks.
+type mountContent struct {
+	folder runtime.TemporaryFolder
+}
+
+func (c *mountContent) MemorySize() (uint64, error) {
+	return 0, caching.ErrDisposableSizeNotSupported
+}
+
+func (c *mountContent) DiskSize() (uint64, error) {
+	var size uint64
+	err := filepath.Walk(c.folder.Path(), func(_ string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += uint64(info.Size())
+		}
+		return err
+	})
+	return size, err
+}
+
+func (c *mountContent) Dispose() error {
+	return c.folder.Remove()
+}
+
+// cachingContextWithQueue wraps a caching.Context and queue creation function
+// to match the interface of fetcher.Context
+type cachingContextWithQueue struct {
+	caching.Context
+	queue func() client.Queue
+}
+
+func (c cachingContextWithQueue) Queue() client.Queue {
+	return c.queue()
+}
+
+// fetchMountContext wraps TaskContext to satisfy the fetcher.Context and
+// caching.Context interfaces, by adding a Progress() function
+type fetchMountContext struct {
+	*runtime.TaskContext
+}
+
+func (c fetchMountContext) Progress(description string, percent float64) {
+	c.Log(fmt.Sprintf("Fetching mount: %s - %.0f %%", description, percent*100))
+}
+
+// newMountContent is the caching.Constructor for mountContent
+func (e *engine) newMountContent(ctx caching.Context, opts interface{}) (caching.Resource, error) {
+	options := opts.(mountOptions) // this is called by Require which is always passed mountOptions
+	fctx := cachingContextWithQueue{ctx, options.queue}
+
+	folder, err := e.environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create folder for mount")
+	}
+
+	if options.Format == mountFormatFile {
+		err = fetchToFile(fctx, options.reference, filepath.Join(folder.Path(), mountContentFile))
+	} else {
+		err = fetchAndExtract(fctx, e.environment.TemporaryStorage, options.reference, options.Format, folder.Path())
+	}
+	if err != nil {
+		folder.Remove()
+		// A broken reference is a necessarily a malformed task payload
+		if fetcher.IsBrokenReferenceError(err) {
+			return nil, runtime.NewMalformedPayloadError("mount reference is invalid, ", err.Error())
+		}
+		return nil, err
+	}
+
+	return &mountContent{folder: folder}, nil
+}
+
+// fetchToFile fetches reference to a new file at target
+func fetchToFile(ctx fetcher.Context, reference fetcher.Reference, target string) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return errors.Wrap(err, "failed to create file for mount")
+	}
+	err = reference.Fetch(ctx, &fetcher.FileReseter{File: f})
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close file for mount")
+	}
+	// Plain files are often scripts or binaries, so we make them executable
+	if err == nil {
+		err = os.Chmod(target, 0755)
+	}
+	return err
+}
+
+// fetchAndExtract fetches reference to a temporary file and extracts it into
+// folder as an archive of the given format.
+func fetchAndExtract(ctx fetcher.Context, storage runtime.TemporaryStorage, reference fetcher.Reference, format, folder string) error {
+	f, err := storage.NewFile()
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for mount")
+	}
+	defer f.Close()
+
+	if err = reference.Fetch(ctx, &fetcher.FileReseter{File: f}); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek temporary file for mount")
+	}
+
+	switch format {
+	case mountFormatTar:
+		err = unpack.ExtractTar(f, folder)
+	case mountFormatTarGz:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(f); err == nil {
+			err = unpack.ExtractTar(zr, folder)
+		}
+	case mountFormatZip:
+		err = unpack.ExtractZip(f.Path(), folder)
+	default:
+		panic(fmt.Sprintf("unsupported mount format: %s", format))
+	}
+	if err != nil {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"failed to extract mount as '%s', error: %s", format, err,
+		))
+	}
+	return nil
+}
+
+// fetchMounts fetches mounts (or obtains them from cache) and places them in
+// the home folder of user. Files copied are owned by user, if the engine
+// creates a user per task.
+func (e *engine) fetchMounts(ctx *runtime.TaskContext, mounts []payloadMount, user *system.User) error {
+	for i, m := range mounts {
+		if m.Format == mountFormatFile && (m.Path == "" || strings.HasSuffix(m.Path, "/")) {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"task.payload.mounts[%d].path must be given as a file path, when format is '%s'",
+				i, mountFormatFile,
+			))
+		}
+		for _, name := range strings.Split(strings.TrimSuffix(m.Path, "/"), "/") {
+			if name == "." || name == ".." {
+				return runtime.NewMalformedPayloadError(fmt.Sprintf(
+					"task.payload.mounts[%d].path cannot contain '.' or '..'", i,
+				))
+			}
+		}
+
+		ref, err := mountFetcher.NewReference(fetchMountContext{ctx}, m.Content)
+		if err != nil {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"unable to resolve task.payload.mounts[%d].content, error: %s", i, err,
+			))
+		}
+		scopeSets := ref.Scopes()
+		if !ctx.HasScopes(scopeSets...) {
+			var options []string
+			for _, scopes := range scopeSets {
+				options = append(options, strings.Join(scopes, ", "))
+			}
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"task.scopes must satisfy at-least one of the scope-sets: %s, to use task.payload.mounts[%d]",
+				strings.Join(options, " or "), i,
+			))
+		}
+
+		handle, err := e.mountCache.Require(fetchMountContext{ctx}, mountOptions{
+			HashKey:   ref.HashKey(),
+			Format:    m.Format,
+			reference: ref,
+			queue:     ctx.Queue,
+		})
+		if err != nil {
+			return err
+		}
+		content := handle.Resource().(*mountContent)
+		err = e.placeMount(content, m, user)
+		handle.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeMount copies the content of a mount into the home folder of user
+func (e *engine) placeMount(content *mountContent, m payloadMount, user *system.User) error {
+	chown := e.config.CreateUser
+	rel := strings.TrimSuffix(m.Path, "/")
+
+	if m.Format == mountFormatFile {
+		if err := mkdirAllOwnedBy(user.Home(), path.Dir(rel), user, chown); err != nil {
+			return err
+		}
+		target := filepath.Join(user.Home(), filepath.FromSlash(rel))
+		source := filepath.Join(content.folder.Path(), mountContentFile)
+		return copyEntry(source, target, user, chown)
+	}
+
+	if err := mkdirAllOwnedBy(user.Home(), rel, user, chown); err != nil {
+		return err
+	}
+	root := filepath.Join(user.Home(), filepath.FromSlash(rel))
+	source := content.folder.Path()
+	return filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == source {
+			return err
+		}
+		relpath, err := filepath.Rel(source, p)
+		if err != nil {
+			return err
+		}
+		return copyEntry(p, filepath.Join(root, relpath), user, chown)
+	})
+}
+
+// copyEntry copies the file, folder or symbolic link at source to target, the
+// parent of target must exist. Existing files at target are replaced, but
+// existing folders are reused, anything else at target is an error.
+func copyEntry(source, target string, user *system.User, chown bool) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	existing, err := os.Lstat(target)
+	if err == nil {
+		if existing.IsDir() && info.IsDir() {
+			return nil
+		}
+		if !existing.Mode().IsRegular() {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"mount conflicts with existing entry: '%s' in the home folder", target,
+			))
+		}
+		if err = os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		err = os.Mkdir(target, mode.Perm()|0700)
+	case mode&os.ModeSymlink != 0:
+		var link string
+		if link, err = os.Readlink(source); err == nil {
+			err = os.Symlink(link, target)
+		}
+		return err // Symbolic links are left owned by the worker
+	case mode.IsRegular():
+		err = copyFile(source, target, mode.Perm())
+	default:
+		return fmt.Errorf("unsupported file type in mount: '%s'", source)
+	}
+	if err == nil && chown {
+		err = system.ChangeOwner(target, user)
+	}
+	return err
+}
+
+// copyFile copies the regular file source to a new file at target with mode
+func copyFile(source, target string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// contextNamePattern is the pattern file names derived from task.payload.context
+// must match, otherwise the file will be called "context".
+var contextNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// contextMount returns a payloadMount for the legacy task.payload.context
+// property, the file is placed in the home folder and unpacked by
+// unpackContext after it has been fetched.
+func contextMount(context string) payloadMount {
+	name := context
+	if u, err := url.Parse(context); err == nil {
+		name = path.Base(u.Path)
+	}
+	if !contextNamePattern.MatchString(name) || name == "." || name == ".." {
+		name = "context"
+	}
+	return payloadMount{Content: context, Format: mountFormatFile, Path: name}
+}
+
+// unpackContext unpacks the legacy task.payload.context file, zip files are
+// unzipped and gzipped files are gunzipped, if the result is a tar-ball it is
+// extracted too. Files are unpacked next to filename.
+func unpackContext(filename string) error {
+	var err error
+	unpackedFile := ""
+	switch filepath.Ext(filename) {
+	case ".zip":
+		err = unpack.Unzip(filename)
+	case ".gz":
+		unpackedFile, err = unpack.Gunzip(filename)
+	}
+	if err == nil && filepath.Ext(unpackedFile) == ".tar" {
+		err = unpack.Untar(unpackedFile)
+	}
+	return err
+}
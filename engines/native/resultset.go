@@ -19,13 +19,19 @@ type resultSet struct {
 	monitor       runtime.Monitor
 	workingFolder runtime.TemporaryFolder
 	user          *system.User
+	mounts        []attachedMount
 	success       bool
+	usage         engines.ResourceUsage
 }
 
 func (r *resultSet) Success() bool {
 	return r.success
 }
 
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	return r.usage, nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
 	// Evaluate symlinks
 	p, err := filepath.EvalSymlinks(filepath.Join(r.user.Home(), path))
@@ -158,6 +164,13 @@ func (r *resultSet) Dispose() error {
 		r.user.Remove()
 	}
 
+	// Detach volumes, if this fails we can't remove the home folder, as it
+	// would delete the contents of the volumes.
+	if derr := detachVolumes(r.mounts); derr != nil {
+		r.monitor.ReportError(derr, "failed to detach volumes")
+		return runtime.ErrNonFatalInternalError
+	}
+
 	// Remove temporary home folder
 	if r.workingFolder != nil {
 		if rerr := r.workingFolder.Remove(); rerr != nil {
@@ -2,17 +2,16 @@ package nativeengine
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/engines/native/system"
-	"github.com/taskcluster/taskcluster-worker/engines/native/unpack"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
-	"github.com/taskcluster/taskcluster-worker/runtime/util"
+	"github.com/taskcluster/taskcluster-worker/runtime/loopbackproxy"
 )
 
 type sandbox struct {
@@ -22,6 +21,10 @@ type sandbox struct {
 	monitor       runtime.Monitor
 	workingFolder runtime.TemporaryFolder
 	user          *system.User
+	mounts        []attachedMount
+	cgroup        *system.CGroup
+	cgroupUsage   *system.CGroupUsage // usage read when the cgroup was killed
+	proxyServer   *loopbackproxy.Server
 	process       *system.Process
 	env           map[string]string
 	resolve       atomics.Once // Guarding resultSet, resultErr and abortErr
@@ -36,10 +39,28 @@ type sandbox struct {
 func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	var user *system.User
 	var workingFolder runtime.TemporaryFolder
+	var mounts []attachedMount
+	var cgroup *system.CGroup
+	var proxies *loopbackproxy.Server
 
 	var err error
 	defer func() {
 		if err != nil {
+			if proxies != nil {
+				proxies.Stop()
+			}
+
+			if cgroup != nil {
+				cgroup.Kill()
+				cgroup.Remove()
+			}
+
+			// Don't remove the home folder if volumes are still attached
+			if derr := detachVolumes(mounts); derr != nil {
+				b.monitor.ReportError(derr, "failed to detach volumes")
+				workingFolder = nil
+			}
+
 			if b.engine.config.CreateUser && user != nil {
 				user.Remove()
 			}
@@ -72,14 +93,39 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		}
 	}
 
+	// Fetch task context and mounts into the home folder
+	payloadMounts := b.payload.Mounts
+	var contextFile payloadMount
+	if b.payload.Context != "" {
+		contextFile = contextMount(b.payload.Context)
+		payloadMounts = append([]payloadMount{contextFile}, payloadMounts...)
+	}
+	if err = b.engine.fetchMounts(b.context, payloadMounts, user); err != nil {
+		if _, ok := runtime.IsMalformedPayloadError(err); ok {
+			return nil, err
+		}
+		incidentID := b.monitor.ReportError(err, "failed to fetch task.payload.mounts")
+		b.context.LogError("internal error fetching mounts, incidentId:", incidentID)
+		return nil, runtime.ErrNonFatalInternalError
+	}
 	if b.payload.Context != "" {
-		if err = fetchContext(b.payload.Context, user); err != nil {
+		if err = unpackContext(filepath.Join(user.Home(), contextFile.Path)); err != nil {
 			return nil, runtime.NewMalformedPayloadError(
-				fmt.Sprintf("Error downloading %s: %v", b.payload.Context, err),
+				fmt.Sprintf("Error unpacking %s: %v", b.payload.Context, err),
 			)
 		}
 	}
 
+	// Attach volumes in the home folder
+	mounts, err = attachVolumes(b.engine, b.mounts, user)
+	if err != nil {
+		if _, ok := runtime.IsMalformedPayloadError(err); ok {
+			return nil, err
+		}
+		b.monitor.ReportError(err, "failed to attach volumes")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
 	env := map[string]string{}
 	for k, v := range b.env {
 		env[k] = v
@@ -89,6 +135,28 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	env["USER"] = user.Name()
 	env["LOGNAME"] = user.Name()
 
+	// Start proxy server, if proxies are attached
+	if len(b.proxies) > 0 {
+		proxies, err = loopbackproxy.New(b.proxies, b.context)
+		if err != nil {
+			b.monitor.ReportError(err, "failed to start proxy server for task")
+			return nil, runtime.ErrNonFatalInternalError
+		}
+		env[loopbackproxy.EnvVar] = proxies.URL()
+	}
+
+	// Create cgroup for the task, if enabled
+	if b.engine.config.CGroups != nil {
+		cgroup, err = system.CreateCGroup(
+			b.engine.config.CGroups.Parent, "task-"+slugid.Nice(),
+			b.engine.config.CGroups.Limits(),
+		)
+		if err != nil {
+			b.monitor.ReportError(err, "failed to create cgroup for task")
+			return nil, runtime.ErrNonFatalInternalError
+		}
+	}
+
 	// Start process
 	debug("StartProcess: %v", b.payload.Command)
 	process, err := system.StartProcess(system.ProcessOptions{
@@ -97,6 +165,7 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		WorkingFolder: user.Home(),
 		Owner:         user,
 		Stdout:        ioext.WriteNopCloser(b.context.LogDrain()),
+		CGroup:        cgroup,
 		// Stderr defaults to Stdout when not specified
 	})
 	if err != nil {
@@ -113,8 +182,11 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		monitor:       b.monitor,
 		workingFolder: workingFolder,
 		user:          user,
+		mounts:        mounts,
+		cgroup:        cgroup,
+		proxyServer:   proxies,
 		process:       process,
-		env:           b.env,
+		env:           env,
 	}
 
 	go s.waitForTermination()
@@ -122,46 +194,6 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	return s, nil
 }
 
-func fetchContext(context string, user *system.User) error {
-	// TODO: use future cache subsystem, when we have it
-	// TODO: use the soon to be merged fetcher subsystem
-	filename, err := util.Download(context, user.Home())
-	if err != nil {
-		return fmt.Errorf("Error downloading '%s': %v", context, err)
-	}
-
-	// TODO: verify if this will harm Windows
-	// TODO: abstract this away in system package
-	if err = os.Chmod(filename, 0700); err != nil {
-		return fmt.Errorf("Error setting file '%s' permissions: %v", filename, err)
-	}
-
-	if err = system.ChangeOwner(filename, user); err != nil {
-		return err
-	}
-
-	unpackedFile := ""
-	switch filepath.Ext(filename) {
-	case ".zip":
-		err = unpack.Unzip(filename)
-	case ".gz":
-		unpackedFile, err = unpack.Gunzip(filename)
-	}
-
-	if err != nil {
-		return fmt.Errorf("Error unpacking '%s': %v", context, err)
-	}
-
-	if filepath.Ext(unpackedFile) == ".tar" {
-		err = unpack.Untar(unpackedFile)
-		if err != nil {
-			return fmt.Errorf("Error unpacking '%s': %v", context, err)
-		}
-	}
-
-	return nil
-}
-
 func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
 	s.mShells.Lock()
 	defer s.mShells.Unlock()
@@ -239,6 +271,8 @@ func (s *sandbox) waitForTermination() {
 
 	s.resolve.Do(func() {
 		// Halt all other sub-processes
+		s.stopProxyServer()
+		s.killCGroup(true)
 		if s.engine.config.CreateUser {
 			system.KillByOwner(s.user)
 		}
@@ -250,7 +284,9 @@ func (s *sandbox) waitForTermination() {
 			monitor:       s.monitor,
 			workingFolder: s.workingFolder,
 			user:          s.user,
+			mounts:        s.mounts,
 			success:       success,
+			usage:         s.resourceUsage(),
 		}
 		s.abortErr = engines.ErrSandboxTerminated
 	})
@@ -273,6 +309,8 @@ func (s *sandbox) Kill() error {
 		s.abortShells()
 
 		// Halt all other sub-processes
+		s.stopProxyServer()
+		s.killCGroup(true)
 		if s.engine.config.CreateUser {
 			system.KillByOwner(s.user)
 		}
@@ -284,7 +322,9 @@ func (s *sandbox) Kill() error {
 			monitor:       s.monitor,
 			workingFolder: s.workingFolder,
 			user:          s.user,
+			mounts:        s.mounts,
 			success:       false,
+			usage:         s.resourceUsage(),
 		}
 		s.abortErr = engines.ErrSandboxTerminated
 	})
@@ -304,6 +344,10 @@ func (s *sandbox) Abort() error {
 		// Abort all shells
 		s.abortShells()
 
+		// Kill all processes in the cgroup, including daemonized processes
+		s.stopProxyServer()
+		s.killCGroup(false)
+
 		if s.engine.config.CreateUser {
 			// When we have a new user created, we can safely
 			// kill any process owned by it.
@@ -316,8 +360,12 @@ func (s *sandbox) Abort() error {
 			s.user.Remove()
 		}
 
-		// Remove temporary home folder
-		if s.workingFolder != nil {
+		// Detach volumes, if this fails we can't remove the home folder, as
+		// it would delete the contents of the volumes.
+		if err := detachVolumes(s.mounts); err != nil {
+			s.monitor.ReportError(err, "failed to detach volumes")
+		} else if s.workingFolder != nil {
+			// Remove temporary home folder
 			if err := s.workingFolder.Remove(); err != nil {
 				s.monitor.Error("Failed to remove temporary home directory, error: ", err)
 			}
@@ -329,3 +377,67 @@ func (s *sandbox) Abort() error {
 	s.resolve.Wait()
 	return s.abortErr
 }
+
+// killCGroup kills all processes in the task cgroup, reports resource usage
+// and removes the cgroup. If logUsage is true resource usage is also written
+// to the task log. This does nothing, if cgroups aren't enabled.
+func (s *sandbox) killCGroup(logUsage bool) {
+	if s.cgroup == nil {
+		return
+	}
+
+	if err := s.cgroup.Kill(); err != nil {
+		s.monitor.ReportError(err, "failed to kill processes in task cgroup")
+	}
+
+	usage, err := s.cgroup.Usage()
+	if err != nil {
+		s.monitor.ReportWarning(err, "failed to read resource usage for task cgroup")
+	} else {
+		s.monitor.Measure("cpu-time", usage.CPUTime.Seconds())
+		msg := fmt.Sprintf("CPU time: %s", usage.CPUTime)
+		if usage.PeakMemory >= 0 {
+			peak := float64(usage.PeakMemory) / (1024 * 1024)
+			s.monitor.Measure("peak-memory", peak)
+			msg = fmt.Sprintf("Peak memory usage: %.1f MiB, %s", peak, msg)
+		}
+		if logUsage {
+			s.context.Log(msg)
+		}
+		s.cgroupUsage = &usage
+	}
+
+	if err = s.cgroup.Remove(); err != nil {
+		s.monitor.ReportError(err, "failed to remove task cgroup")
+	}
+}
+
+// resourceUsage returns resource usage from the task cgroup, if cgroups are
+// enabled, otherwise usage for the process is used, if it has terminated.
+// This must be called after killCGroup.
+func (s *sandbox) resourceUsage() engines.ResourceUsage {
+	usage := engines.NewResourceUsage()
+	if s.cgroupUsage != nil {
+		usage.CPUTime = s.cgroupUsage.CPUTime
+		usage.PeakMemory = s.cgroupUsage.PeakMemory
+		usage.DiskReadBytes = s.cgroupUsage.DiskReadBytes
+		usage.DiskWriteBytes = s.cgroupUsage.DiskWriteBytes
+		return usage
+	}
+	// Usage for the process only covers the process and its waited for
+	// descendants, but it's better than nothing.
+	if u, ok := s.process.Usage(); ok {
+		usage.CPUTime = u.CPUTime
+		usage.PeakMemory = u.PeakMemory
+		usage.DiskReadBytes = u.DiskReadBytes
+		usage.DiskWriteBytes = u.DiskWriteBytes
+	}
+	return usage
+}
+
+// stopProxyServer stops the proxy server, if one was started
+func (s *sandbox) stopProxyServer() {
+	if s.proxyServer != nil {
+		s.proxyServer.Stop()
+	}
+}
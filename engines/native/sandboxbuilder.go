@@ -1,7 +1,11 @@
 package nativeengine
 
 import (
+	"fmt"
+	"net/http"
 	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -9,15 +13,24 @@ import (
 
 type sandboxBuilder struct {
 	engines.SandboxBuilderBase
+	m       sync.Mutex
 	engine  *engine
 	monitor runtime.Monitor
 	payload payload
 	context *runtime.TaskContext
 	env     map[string]string
+	mounts  []mount
+	proxies map[string]http.Handler
 }
 
 var envVarPattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
+var proxyNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// mountPointPattern restricts mount-points to relative paths in the home
+// folder of the task user, ending with a slash to indicate a folder.
+var mountPointPattern = regexp.MustCompile(`^(?:[a-zA-Z0-9_.-]+/)+$`)
+
 func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error {
 	if !envVarPattern.MatchString(name) {
 		return runtime.NewMalformedPayloadError(
@@ -25,6 +38,10 @@ func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error
 			envVarPattern.String(),
 		)
 	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
 	if _, ok := b.env[name]; ok {
 		return engines.ErrNamingConflict
 	}
@@ -32,6 +49,71 @@ func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error
 	return nil
 }
 
+func (b *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
+	// Validate hostname against allowed patterns
+	if !proxyNamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError("Proxy hostname: '", hostname, "'",
+			" is not allowed for native engine. The hostname must match: ",
+			proxyNamePattern.String())
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Check that the hostname isn't already in use
+	if _, ok := b.proxies[hostname]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	b.proxies[hostname] = handler
+	return nil
+}
+
+func (b *sandboxBuilder) AttachVolume(mountPoint string, vol engines.Volume, readOnly bool) error {
+	// We may assert that vol is a result from engine.NewVolume()
+	v, ok := vol.(*volume)
+	if !ok {
+		b.monitor.Panicf("AttachVolume() was passed volume of type: %T", vol)
+	}
+
+	// Validate mount-point, mount-points are relative to the home folder
+	if !mountPointPattern.MatchString(mountPoint) {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"mount-point: '%s' is not allowed for native engine, mount-points must "+
+				"be relative to the home folder and match: %s",
+			mountPoint, mountPointPattern.String(),
+		))
+	}
+	for _, name := range strings.Split(strings.TrimSuffix(mountPoint, "/"), "/") {
+		if name == "." || name == ".." {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"mount-point: '%s' cannot contain '.' or '..'", mountPoint,
+			))
+		}
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Check for naming conflicts, nested mount-points are not allowed as the
+	// result would depend on the order in which volumes are attached.
+	for _, m := range b.mounts {
+		if strings.HasPrefix(m.mountPoint, mountPoint) || strings.HasPrefix(mountPoint, m.mountPoint) {
+			return engines.ErrNamingConflict
+		}
+	}
+
+	b.mounts = append(b.mounts, mount{
+		volume:     v,
+		mountPoint: mountPoint,
+		readOnly:   readOnly,
+	})
+	return nil
+}
+
 func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
 	return newSandbox(b)
 }
@@ -47,6 +47,7 @@ func newShell(s *sandbox, command []string, tty bool) (*shell, error) {
 		Stdout:        pipeout,
 		Stderr:        pipeerr,
 		TTY:           tty,
+		CGroup:        s.cgroup,
 	})
 	if err != nil {
 		return nil, err
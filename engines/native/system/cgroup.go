@@ -0,0 +1,19 @@
+package system
+
+import "time"
+
+// CGroupLimits holds the resource limits for a CGroup, zero values indicate
+// that no limit is imposed.
+type CGroupLimits struct {
+	Memory int64   // Maximum memory in bytes
+	CPUs   float64 // Number of CPUs worth of CPU time, may be a fraction
+	Pids   int     // Maximum number of processes and threads
+}
+
+// CGroupUsage holds resource usage reported for a CGroup.
+type CGroupUsage struct {
+	PeakMemory     int64         // Peak memory usage in bytes, -1 if unavailable
+	CPUTime        time.Duration // CPU time consumed by all processes
+	DiskReadBytes  int64         // Bytes read from disk, -1 if unavailable
+	DiskWriteBytes int64         // Bytes written to disk, -1 if unavailable
+}
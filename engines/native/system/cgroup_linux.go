@@ -0,0 +1,287 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupControllers are the controllers that must be enabled for task cgroups
+var cgroupControllers = []string{"memory", "cpu", "pids"}
+
+const (
+	// cgroupCPUPeriod is the period used in cpu.max when limiting CPUs, this is
+	// the kernel default of 100ms.
+	cgroupCPUPeriod = 100000
+	// cgroupKillTimeout is the maximum time to wait for processes in a cgroup
+	// to terminate after they have been killed.
+	cgroupKillTimeout = 30 * time.Second
+	// cgroupPollInterval is the interval between checks of whether a cgroup
+	// has been emptied.
+	cgroupPollInterval = 50 * time.Millisecond
+)
+
+// CGroup is a cgroup v2 created with CreateCGroup, processes started with
+// ProcessOptions.CGroup set are placed in the cgroup.
+type CGroup struct {
+	path string
+}
+
+// EnableCGroupControllers ensures that the parent cgroup exists, and that the
+// memory, cpu and pids controllers are enabled for its children.
+//
+// The parent must be a cgroup v2 folder writable by the worker, and it cannot
+// contain any processes itself, as cgroup v2 doesn't allow processes in
+// cgroups that have controllers enabled for their children.
+func EnableCGroupControllers(parent string) error {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create parent cgroup: '%s', error: %s", parent, err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("'%s' is not a cgroup v2 folder, error: %s", parent, err)
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range cgroupControllers {
+		if !stringContains(available, controller) {
+			return fmt.Errorf("cgroup controller '%s' is not available in '%s'", controller, parent)
+		}
+	}
+
+	control := "+" + strings.Join(cgroupControllers, " +")
+	if err = writeCGroupFile(parent, "cgroup.subtree_control", control); err != nil {
+		return fmt.Errorf("failed to enable cgroup controllers in '%s', error: %s", parent, err)
+	}
+	return nil
+}
+
+// CreateCGroup creates a new cgroup called name under parent with the given
+// limits. The parent must have been setup with EnableCGroupControllers.
+func CreateCGroup(parent, name string, limits CGroupLimits) (*CGroup, error) {
+	path := filepath.Join(parent, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: '%s', error: %s", path, err)
+	}
+	c := &CGroup{path: path}
+
+	var err error
+	if limits.Memory != 0 {
+		err = writeCGroupFile(path, "memory.max", strconv.FormatInt(limits.Memory, 10))
+		// Prevent the cgroup from using swap, if swap accounting is enabled
+		if err == nil {
+			err = writeCGroupFile(path, "memory.swap.max", "0")
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+	}
+	if err == nil && limits.CPUs != 0 {
+		quota := int64(limits.CPUs * cgroupCPUPeriod)
+		err = writeCGroupFile(path, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod))
+	}
+	if err == nil && limits.Pids != 0 {
+		err = writeCGroupFile(path, "pids.max", strconv.Itoa(limits.Pids))
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to set limits for cgroup: '%s', error: %s", path, err)
+	}
+
+	return c, nil
+}
+
+// Path returns the path to the cgroup folder.
+func (c *CGroup) Path() string {
+	return c.path
+}
+
+// AddProcess moves the process given by pid into the cgroup.
+func (c *CGroup) AddProcess(pid int) error {
+	return writeCGroupFile(c.path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// Kill sends SIGKILL to all processes in the cgroup, and waits for the cgroup
+// to be empty. This also kills processes that have been daemonized or
+// re-parented, as a process cannot leave its cgroup without privileges.
+func (c *CGroup) Kill() error {
+	// cgroup.kill is available from Linux 5.14, if missing we freeze the cgroup
+	// to prevent forks and kill each process.
+	err := writeCGroupFile(c.path, "cgroup.kill", "1")
+	if os.IsNotExist(err) {
+		err = c.killEach()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to kill processes in cgroup: '%s', error: %s", c.path, err)
+	}
+
+	// Wait for the cgroup to be empty
+	deadline := time.Now().Add(cgroupKillTimeout)
+	for {
+		populated, err := c.populated()
+		if err != nil {
+			return err
+		}
+		if !populated {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("processes in cgroup: '%s' didn't terminate within %s", c.path, cgroupKillTimeout)
+		}
+		time.Sleep(cgroupPollInterval)
+	}
+}
+
+// killEach freezes the cgroup and sends SIGKILL to each process.
+func (c *CGroup) killEach() error {
+	if err := writeCGroupFile(c.path, "cgroup.freeze", "1"); err != nil {
+		debug("failed to freeze cgroup: '%s', error: %s", c.path, err)
+	}
+	// Always thaw the cgroup, so nothing is left frozen if killing fails
+	defer writeCGroupFile(c.path, "cgroup.freeze", "0")
+
+	data, err := ioutil.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("invalid pid: '%s' in cgroup.procs", field)
+		}
+		if err = syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to kill pid: %d, error: %s", pid, err)
+		}
+	}
+	return nil
+}
+
+// populated returns true, if there are processes in the cgroup
+func (c *CGroup) populated() (bool, error) {
+	value, err := readCGroupKey(c.path, "cgroup.events", "populated")
+	if err != nil {
+		return false, err
+	}
+	return value != 0, nil
+}
+
+// Usage returns the resource usage of the cgroup.
+func (c *CGroup) Usage() (CGroupUsage, error) {
+	usage := CGroupUsage{PeakMemory: -1, DiskReadBytes: -1, DiskWriteBytes: -1}
+
+	// memory.peak is available from Linux 5.19
+	data, err := ioutil.ReadFile(filepath.Join(c.path, "memory.peak"))
+	if err == nil {
+		usage.PeakMemory, err = strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+		if err != nil {
+			return usage, fmt.Errorf("failed to parse memory.peak for cgroup: '%s', error: %s", c.path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return usage, fmt.Errorf("failed to read memory.peak for cgroup: '%s', error: %s", c.path, err)
+	}
+
+	usec, err := readCGroupKey(c.path, "cpu.stat", "usage_usec")
+	if err != nil {
+		return usage, err
+	}
+	usage.CPUTime = time.Duration(usec) * time.Microsecond
+
+	// io.stat is only available if the io controller is enabled
+	usage.DiskReadBytes, usage.DiskWriteBytes, err = readIOStat(c.path)
+	if err != nil {
+		return usage, err
+	}
+
+	return usage, nil
+}
+
+// readIOStat returns bytes read and written summed over all devices in
+// io.stat, or -1 if io.stat doesn't exist.
+func readIOStat(folder string) (int64, int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(folder, "io.stat"))
+	if os.IsNotExist(err) {
+		return -1, -1, nil
+	}
+	if err != nil {
+		return -1, -1, fmt.Errorf("failed to read io.stat for cgroup: '%s', error: %s", folder, err)
+	}
+	var read, write int64
+	for _, line := range strings.Split(string(data), "\n") {
+		// Lines have the form: '<major>:<minor> rbytes=<n> wbytes=<n> ...'
+		for _, field := range strings.Fields(line) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || (kv[0] != "rbytes" && kv[0] != "wbytes") {
+				continue
+			}
+			n, perr := strconv.ParseInt(kv[1], 10, 64)
+			if perr != nil {
+				return -1, -1, fmt.Errorf("failed to parse io.stat for cgroup: '%s', error: %s", folder, perr)
+			}
+			if kv[0] == "rbytes" {
+				read += n
+			} else {
+				write += n
+			}
+		}
+	}
+	return read, write, nil
+}
+
+// Remove the cgroup, this fails if there are processes in the cgroup.
+func (c *CGroup) Remove() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cgroup: '%s', error: %s", c.path, err)
+	}
+	return nil
+}
+
+// writeCGroupFile writes value to the file called name in the cgroup folder
+func writeCGroupFile(folder, name, value string) error {
+	f, err := os.OpenFile(filepath.Join(folder, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readCGroupKey reads the value of key from a flat-keyed cgroup file
+func readCGroupKey(folder, name, key string) (int64, error) {
+	f, err := os.Open(filepath.Join(folder, name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s for cgroup: '%s', error: %s", name, folder, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s for cgroup: '%s', error: %s", name, folder, err)
+	}
+	return 0, fmt.Errorf("key '%s' not found in %s for cgroup: '%s'", key, name, folder)
+}
+
+// stringContains returns true, if list contains s
+func stringContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+// +build linux,system
+
+package system
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+// testCGroupParent is the parent cgroup used for testing, this requires
+// cgroup v2 mounted at /sys/fs/cgroup and write access.
+const testCGroupParent = "/sys/fs/cgroup/taskcluster-worker-test"
+
+func TestCGroup(t *testing.T) {
+	if err := EnableCGroupControllers(testCGroupParent); err != nil {
+		t.Skip("unable to setup parent cgroup, error: ", err)
+	}
+	defer os.Remove(testCGroupParent)
+
+	c, err := CreateCGroup(testCGroupParent, slugid.Nice(), CGroupLimits{
+		Memory: 256 * 1024 * 1024,
+		CPUs:   0.5,
+		Pids:   64,
+	})
+	require.NoError(t, err)
+
+	// Start a process that leaves a daemonized sub-process behind
+	p, err := StartProcess(ProcessOptions{
+		Arguments: []string{"/bin/sh", "-c", "setsid /bin/sleep 60 &"},
+		CGroup:    c,
+	})
+	require.NoError(t, err)
+	require.True(t, p.Wait())
+
+	populated, err := c.populated()
+	require.NoError(t, err)
+	require.True(t, populated, "expected daemonized process in cgroup")
+
+	require.NoError(t, c.Kill())
+	populated, err = c.populated()
+	require.NoError(t, err)
+	require.False(t, populated, "expected cgroup to be empty after Kill()")
+
+	_, err = c.Usage()
+	require.NoError(t, err)
+	require.NoError(t, c.Remove())
+}
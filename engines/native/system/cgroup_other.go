@@ -0,0 +1,42 @@
+// +build !linux
+
+package system
+
+// CGroup is not supported on this platform, it is only declared such that
+// ProcessOptions is platform independent.
+type CGroup struct{}
+
+// EnableCGroupControllers returns ErrCGroupsNotSupported on this platform.
+func EnableCGroupControllers(parent string) error {
+	return ErrCGroupsNotSupported
+}
+
+// CreateCGroup returns ErrCGroupsNotSupported on this platform.
+func CreateCGroup(parent, name string, limits CGroupLimits) (*CGroup, error) {
+	return nil, ErrCGroupsNotSupported
+}
+
+// Path returns an empty string on this platform.
+func (c *CGroup) Path() string {
+	return ""
+}
+
+// AddProcess returns ErrCGroupsNotSupported on this platform.
+func (c *CGroup) AddProcess(pid int) error {
+	return ErrCGroupsNotSupported
+}
+
+// Kill returns ErrCGroupsNotSupported on this platform.
+func (c *CGroup) Kill() error {
+	return ErrCGroupsNotSupported
+}
+
+// Usage returns ErrCGroupsNotSupported on this platform.
+func (c *CGroup) Usage() (CGroupUsage, error) {
+	return CGroupUsage{PeakMemory: -1, DiskReadBytes: -1, DiskWriteBytes: -1}, ErrCGroupsNotSupported
+}
+
+// Remove returns ErrCGroupsNotSupported on this platform.
+func (c *CGroup) Remove() error {
+	return ErrCGroupsNotSupported
+}
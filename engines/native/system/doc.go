@@ -15,15 +15,24 @@
 //      system.FindGroup(name string) (*Group, error)
 //     	system.StartProcess(options ProcessOptions) (*Process, error)
 //     	system.KillByOwner(user *User) error
+//      system.ChangeOwnerRecursive(path string, user *User) error
+//      system.BindMount(source, target string, readOnly bool) error
+//      system.Unmount(target string) error
+//      system.CGroup
+//      system.EnableCGroupControllers(parent string) error
+//      system.CreateCGroup(parent, name string, limits CGroupLimits) (*CGroup, error)
+//
+// CGroups are only supported on Linux with cgroup v2, on other platforms
+// ErrCGroupsNotSupported is returned. Similarly, bind mounts are only supported
+// on Linux when running as root, otherwise ErrBindMountNotSupported is
+// returned.
 package system
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
 
-// TODO: Implement the following methods to support cache folder.
+// TODO: Implement the following methods to support shared cache folders.
 //      system.Group.Remove()
 //      system.CreateGroup() (*Group, error)
-//      system.Link(target, source string) error
-//      system.Unlink(target string) error
 //      system.SetRecursiveReadWriteRecursive(folder string, group *Group) error
 //      system.SetRecursiveReadOnlyAccess(folder string, group *Group) error
 
@@ -4,3 +4,11 @@ import "errors"
 
 // ErrUserGroupNotFound indicates that a given user-group doesn't exist.
 var ErrUserGroupNotFound = errors.New("user group doesn't exist")
+
+// ErrCGroupsNotSupported is returned from CreateCGroup and
+// EnableCGroupControllers on platforms without cgroup v2.
+var ErrCGroupsNotSupported = errors.New("cgroups are not supported on this platform")
+
+// ErrBindMountNotSupported is returned from BindMount on platforms without
+// bind mounts, or when the worker lacks privileges to create bind mounts.
+var ErrBindMountNotSupported = errors.New("bind mounts are not supported")
@@ -0,0 +1,45 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// BindMount mounts the folder source at target, which must be an existing
+// folder. If readOnly is true the mount will be read-only.
+//
+// Returns ErrBindMountNotSupported, if the worker isn't running as root.
+func BindMount(source, target string, readOnly bool) error {
+	if os.Geteuid() != 0 {
+		return ErrBindMountNotSupported
+	}
+
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to bind mount '%s' at '%s', error: %s", source, target, err)
+	}
+
+	// Read-only bind mounts must be created with a remount
+	if readOnly {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", target, "", flags, ""); err != nil {
+			syscall.Unmount(target, 0)
+			return fmt.Errorf("failed to make bind mount at '%s' read-only, error: %s", target, err)
+		}
+	}
+	return nil
+}
+
+// Unmount removes the mount at target, created with BindMount. If target is
+// busy it will be detached, such that it can't be accessed by new processes.
+func Unmount(target string) error {
+	err := syscall.Unmount(target, 0)
+	if err == syscall.EBUSY {
+		debug("unmount of '%s' failed with EBUSY, detaching instead", target)
+		err = syscall.Unmount(target, syscall.MNT_DETACH)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmount '%s', error: %s", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package system
+
+// BindMount returns ErrBindMountNotSupported on this platform.
+func BindMount(source, target string, readOnly bool) error {
+	return ErrBindMountNotSupported
+}
+
+// Unmount returns ErrBindMountNotSupported on this platform.
+func Unmount(target string) error {
+	return ErrBindMountNotSupported
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"os/user"
+	goruntime "runtime"
 	"strconv"
 	"sync"
 	"syscall"
@@ -22,6 +24,11 @@ import (
 
 const systemPKill = "/usr/bin/pkill"
 
+// cgroupWrapperScript blocks until file descriptor 3 is closed, then closes it
+// and executes the arguments given. This allows the parent to place the process
+// in a cgroup before the command is executed, and thus before it can fork.
+const cgroupWrapperScript = `read _ <&3; exec 3<&-; exec "$@"`
+
 // Process is a representation of a system process.
 type Process struct {
 	cmd     *exec.Cmd
@@ -182,6 +189,23 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 		}
 	}
 
+	// If placing the process in a cgroup, we wrap the command such that it
+	// doesn't execute until the process has been added to the cgroup.
+	var ready *os.File
+	if options.CGroup != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create pipe, error: %s", err)
+		}
+		defer r.Close() // only needed by the child process
+		ready = w
+		p.cmd.Args = append([]string{
+			"/bin/sh", "-c", cgroupWrapperScript, "sh", p.cmd.Path,
+		}, options.Arguments[1:]...)
+		p.cmd.Path = "/bin/sh"
+		p.cmd.ExtraFiles = []*os.File{r}
+	}
+
 	// Start the process
 	var err error
 	if !options.TTY {
@@ -209,11 +233,28 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 	}
 
 	if err != nil {
+		if ready != nil {
+			ready.Close()
+		}
 		debug("Failed to start process, error: %s", err)
 		return nil, fmt.Errorf("Unable to execute binary, error: %s", err)
 	}
 	debug("Started process with %v", options.Arguments)
 
+	// Move process into the cgroup, then close ready to let it execute the
+	// command. This way no sub-processes can be forked outside the cgroup.
+	if options.CGroup != nil {
+		err = options.CGroup.AddProcess(p.cmd.Process.Pid)
+		if err != nil {
+			p.cmd.Process.Kill()
+		}
+		ready.Close()
+		if err != nil {
+			go p.waitForResult()
+			return nil, fmt.Errorf("Unable to add process to cgroup, error: %s", err)
+		}
+	}
+
 	// Go wait for result
 	go p.waitForResult()
 
@@ -252,6 +293,31 @@ func (p *Process) Wait() bool {
 	return p.result
 }
 
+// Usage returns resource usage for the process, this returns false if the
+// process hasn't terminated or usage isn't available.
+func (p *Process) Usage() (ProcessUsage, bool) {
+	if !p.resolve.IsDone() || p.cmd.ProcessState == nil {
+		return ProcessUsage{}, false
+	}
+	rusage, ok := p.cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return ProcessUsage{}, false
+	}
+	usage := ProcessUsage{
+		CPUTime:        p.cmd.ProcessState.UserTime() + p.cmd.ProcessState.SystemTime(),
+		PeakMemory:     int64(rusage.Maxrss),
+		DiskReadBytes:  -1,
+		DiskWriteBytes: -1,
+	}
+	if goruntime.GOOS == "linux" {
+		// On linux maxrss is in KiB and block operations are 512 byte blocks
+		usage.PeakMemory *= 1024
+		usage.DiskReadBytes = int64(rusage.Inblock) * 512
+		usage.DiskWriteBytes = int64(rusage.Oublock) * 512
+	}
+	return usage, true
+}
+
 // Kill the process
 func (p *Process) Kill() {
 	p.cmd.Process.Kill()
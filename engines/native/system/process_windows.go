@@ -136,6 +136,11 @@ func (p *Process) Wait() bool {
 	return p.result
 }
 
+// Usage returns false, as resource usage isn't supported on windows.
+func (p *Process) Usage() (ProcessUsage, bool) {
+	return ProcessUsage{}, false
+}
+
 // Kill the process
 func (p *Process) Kill() {
 	p.cmd.Process.Kill()
@@ -1,6 +1,9 @@
 package system
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 // ProcessOptions are the arguments given for StartProcess.
 // This structure is platform independent.
@@ -13,4 +16,14 @@ type ProcessOptions struct {
 	Stdout        io.WriteCloser    // Stream for stdout
 	Stderr        io.WriteCloser    // Stream for stderr, or nil if using stdout
 	TTY           bool              // Start as TTY, if supported, ignores stderr
+	CGroup        *CGroup           // CGroup to place process in, nil if none
+}
+
+// ProcessUsage holds resource usage for a process that has terminated, this
+// includes descendants the process waited for. Values are -1 if unavailable.
+type ProcessUsage struct {
+	CPUTime        time.Duration // CPU time spent in user and kernel mode
+	PeakMemory     int64         // Peak resident set size in bytes
+	DiskReadBytes  int64         // Bytes read from disk
+	DiskWriteBytes int64         // Bytes written to disk
 }
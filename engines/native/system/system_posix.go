@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	osuser "os/user"
+	"path/filepath"
 	"strconv"
 )
 
@@ -29,3 +30,19 @@ func ChangeOwner(filepath string, user *User) error {
 
 	return nil
 }
+
+// ChangeOwnerRecursive changes the owner of path and everything inside it to
+// the given user. Symbolic links are not followed, instead the owner of the
+// link itself is changed.
+func ChangeOwnerRecursive(path string, user *User) error {
+	err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err == nil {
+			err = os.Lchown(name, int(user.uid), int(user.gid))
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Can't change owner of %s: %v", path, err)
+	}
+	return nil
+}
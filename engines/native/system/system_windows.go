@@ -6,3 +6,9 @@ package system
 func ChangeOwner(filepath string, user *User) error {
 	panic("Not implemented")
 }
+
+// ChangeOwnerRecursive changes the owner of path and everything inside it to
+// the given user
+func ChangeOwnerRecursive(path string, user *User) error {
+	panic("Not implemented")
+}
@@ -0,0 +1,224 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinkSize is the maximum length of symbolic link targets in zip files
+const maxSymlinkSize = 4096
+
+// ExtractTar extracts the tar-stream r into folder. Folders, regular files,
+// symbolic links and hard links are supported, entries that would be written
+// outside folder, including through symbolic links, result in an error.
+func ExtractTar(r io.Reader, folder string) error {
+	t := tar.NewReader(r)
+	for {
+		hdr, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := prepareEntry(folder, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue // The root folder itself
+		}
+
+		mode := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = makeFolder(target, mode)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(target, t, mode)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			var source string
+			source, err = safeJoin(folder, hdr.Linkname)
+			if err == nil {
+				err = checkRegularFile(folder, source)
+			}
+			if err == nil {
+				err = os.Link(source, target)
+			}
+		default:
+			err = fmt.Errorf("File type %v unsupported: %s", hdr.Typeflag, hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractZip extracts the zip archive in filename into folder. Entries that
+// would be written outside folder result in an error.
+func ExtractZip(filename, folder string) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		target, err := prepareEntry(folder, f.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue // The root folder itself
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = makeFolder(target, mode.Perm())
+		case mode&os.ModeSymlink != 0:
+			err = extractZipSymlink(f, target)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			rc, err = f.Open()
+			if err == nil {
+				err = writeFile(target, rc, mode.Perm())
+				rc.Close()
+			}
+		default:
+			err = fmt.Errorf("File type %v unsupported: %s", mode, f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipSymlink creates a symbolic link at target, the link target is
+// stored as the contents of the zip entry.
+func extractZipSymlink(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	link, err := ioutil.ReadAll(io.LimitReader(rc, maxSymlinkSize+1))
+	if err != nil {
+		return err
+	}
+	if len(link) > maxSymlinkSize {
+		return fmt.Errorf("%s: symbolic link target too long", f.Name)
+	}
+	return os.Symlink(string(link), target)
+}
+
+// safeJoin joins folder and the slash separated name, returning an error if
+// the result is outside folder.
+func safeJoin(folder, name string) (string, error) {
+	root := filepath.Clean(folder)
+	p := filepath.Join(root, filepath.FromSlash(name))
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: illegal path", name)
+	}
+	return p, nil
+}
+
+// prepareEntry returns the path for the archive entry name in folder, and
+// ensures that all parent folders exist and are not symbolic links. Returns
+// an empty string if name is folder itself.
+func prepareEntry(folder, name string) (string, error) {
+	target, err := safeJoin(folder, name)
+	if err != nil {
+		return "", err
+	}
+	root := filepath.Clean(folder)
+	if target == root {
+		return "", nil
+	}
+
+	// Create parent folders, refusing anything that isn't a folder, such that
+	// symbolic links in the archive can't be used to write outside folder.
+	rel, _ := filepath.Rel(root, filepath.Dir(target))
+	p := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." || part == "" {
+			continue
+		}
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			err = os.Mkdir(p, 0755)
+		} else if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s: parent is not a folder", name)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Existing entries are replaced, unless they are folders
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		if err = os.Remove(target); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// checkRegularFile returns an error if p inside folder isn't a regular file,
+// or if any of its parents are symbolic links.
+func checkRegularFile(folder, p string) error {
+	root := filepath.Clean(folder)
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return err
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		root = filepath.Join(root, part)
+		info, err := os.Lstat(root)
+		if err != nil {
+			return err
+		}
+		if root == p && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s: hard link to non-regular file", rel)
+		}
+		if root != p && !info.IsDir() {
+			return fmt.Errorf("%s: hard link through non-folder", rel)
+		}
+	}
+	return nil
+}
+
+// makeFolder creates folder with mode, or updates mode if it already exists
+func makeFolder(folder string, mode os.FileMode) error {
+	if err := os.Mkdir(folder, mode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	// Ensure we can always write to folders we extract into
+	return os.Chmod(folder, mode|0700)
+}
+
+// writeFile writes the contents of r to a new file with mode
+func writeFile(filename string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(filename, mode)
+	}
+	return err
+}
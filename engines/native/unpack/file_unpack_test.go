@@ -1,7 +1,12 @@
 package unpack
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -53,3 +58,62 @@ func TestGunzipUntar(t *testing.T) {
 	defer os.RemoveAll("testdata/folder")
 	checkData(t)
 }
+
+func TestExtractZip(t *testing.T) {
+	folder, err := ioutil.TempDir("", "unpack-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	require.NoError(t, ExtractZip("testdata/test.zip", folder))
+	require.Equal(t, "This is a test.\n", readFile(t, filepath.Join(folder, "folder/test.txt")))
+	require.Equal(t, "This is another test.\n", readFile(t, filepath.Join(folder, "folder/subfolder/test.txt")))
+}
+
+func TestExtractTar(t *testing.T) {
+	folder, err := ioutil.TempDir("", "unpack-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	f, err := os.Open("testdata/test.tar.gz")
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	require.NoError(t, ExtractTar(zr, folder))
+	require.Equal(t, "This is a test.\n", readFile(t, filepath.Join(folder, "folder/test.txt")))
+	require.Equal(t, "This is another test.\n", readFile(t, filepath.Join(folder, "folder/subfolder/test.txt")))
+}
+
+func TestExtractTarSymlinkEscape(t *testing.T) {
+	folder, err := ioutil.TempDir("", "unpack-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	outside, err := ioutil.TempDir("", "unpack-test-outside")
+	require.NoError(t, err)
+	defer os.RemoveAll(outside)
+
+	// Create tar-ball with a symlink pointing outside, and a file written
+	// through the symlink.
+	b := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(b)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "link",
+		Typeflag: tar.TypeSymlink,
+		Linkname: outside,
+		Mode:     0777,
+	}))
+	data := []byte("evil")
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "link/evil.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(data)),
+	}))
+	_, err = tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	require.Error(t, ExtractTar(b, folder))
+	require.Error(t, exists(filepath.Join(outside, "evil.txt")))
+}
@@ -0,0 +1,373 @@
+package nativeengine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+var volumeSchema = schematypes.Object{
+	Title:                "Native Volume Options",
+	Description:          "Options for native volumes at this time no options are supported.",
+	AdditionalProperties: false, // We just require an empty object to ensure forward-compatibility
+}
+
+type volumeOptions struct{}
+
+type volumeBuilder struct {
+	engines.VolumeBuilderBase
+	m       sync.Mutex
+	v       *volume
+	invalid bool
+}
+
+type volume struct {
+	engines.VolumeBase
+	m        sync.Mutex
+	folder   runtime.TemporaryFolder
+	monitor  runtime.Monitor
+	disposed bool
+}
+
+func newVolumeBuilder(e *engine) (*volumeBuilder, error) {
+	folder, err := e.environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		e.monitor.ReportError(err, "failed to create folder for volume")
+		return nil, runtime.ErrFatalInternalError
+	}
+
+	return &volumeBuilder{
+		v: &volume{
+			folder:  folder,
+			monitor: e.monitor.WithPrefix("volume"),
+		},
+	}, nil
+}
+
+// path returns the path to name in the volume folder, or an error if name
+// reaches outside the volume folder.
+func (v *volume) path(name string) (string, error) {
+	root := filepath.Clean(v.folder.Path())
+	p := filepath.Join(root, filepath.FromSlash(name))
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path: '%s' is outside the volume", name)
+	}
+	return p, nil
+}
+
+func (vb *volumeBuilder) WriteFolder(name string) error {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.v.monitor.Panic("VolumeBuilder.WriteFolder() was called after BuildVolume()/Discard()")
+	}
+
+	p, err := vb.v.path(name)
+	if err != nil {
+		vb.v.monitor.ReportError(err, "VolumeBuilder.WriteFolder() for native-engine attempted to create folder outside the volume")
+		return runtime.ErrFatalInternalError
+	}
+
+	if err = os.MkdirAll(p, 0777); err != nil {
+		vb.v.monitor.WithTag("folderName", name).ReportError(err, "VolumeBuilder.WriteFolder() for native-engine failed to create folder")
+		return runtime.ErrFatalInternalError
+	}
+	return nil
+}
+
+func (vb *volumeBuilder) WriteFile(name string) io.WriteCloser {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.v.monitor.Panic("VolumeBuilder.WriteFile() was called after BuildVolume()/Discard()")
+	}
+
+	p, err := vb.v.path(name)
+	if err != nil {
+		vb.v.monitor.ReportError(err, "VolumeBuilder.WriteFile() for native-engine attempted to create file outside the volume")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		vb.v.monitor.WithTag("fileName", name).ReportError(err, "VolumeBuilder.WriteFile() for native-engine failed to create folders for file")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		vb.v.monitor.WithTag("fileName", name).ReportError(err, "VolumeBuilder.WriteFile() for native-engine failed to create file")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	return f // Note it is the callers responsibility to close the file
+}
+
+func (vb *volumeBuilder) BuildVolume() (engines.Volume, error) {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.v.monitor.Panic("VolumeBuilder.BuildVolume() was called after BuildVolume()/Discard()")
+	}
+	vb.invalid = true
+
+	return vb.v, nil
+}
+
+func (vb *volumeBuilder) Discard() error {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.v.monitor.Panic("VolumeBuilder.Discard() was called after BuildVolume()/Discard()")
+	}
+	vb.invalid = true
+
+	return vb.v.Dispose()
+}
+
+// Path returns the path to the folder holding the volume contents
+func (v *volume) Path() string {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// Validate that this haven't been disposed yet
+	if v.disposed {
+		v.monitor.Panic("Volume cannot be used after Dispose()")
+	}
+
+	return v.folder.Path()
+}
+
+func (v *volume) Dispose() error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// Ignore double Dispose() there is no risk here
+	if v.disposed {
+		v.monitor.Warn("Volume.Dispose() was called twice!")
+		return nil
+	}
+	v.disposed = true
+
+	if err := v.folder.Remove(); err != nil {
+		v.monitor.ReportError(err, "Volume.Dispose() failed to remove volume folder")
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
+}
+
+// errWriteCloser is a simple io.WriteCloser implementation that returns Err
+// for all operations.
+type errWriteCloser struct {
+	Err error
+}
+
+func (e *errWriteCloser) Write(p []byte) (int, error) {
+	return 0, e.Err
+}
+
+func (e *errWriteCloser) Close() error {
+	return e.Err
+}
+
+// mount is a volume to be attached to the sandbox at mountPoint, which is
+// relative to the home folder of the task user.
+type mount struct {
+	volume     *volume
+	mountPoint string
+	readOnly   bool
+}
+
+// attachedMount is a volume that has been attached at target, either as a
+// bind mount or as a symbolic link.
+type attachedMount struct {
+	target string
+	bind   bool
+}
+
+// attachVolumes attaches mounts in the home folder of user, volumes are bind
+// mounted if supported, otherwise they are symlinked. Read-only volumes can't
+// be symlinked, so attaching these fails if bind mounts aren't supported. If an
+// error is returned mounts attached have been detached again.
+//
+// When the engine creates a user per task, ownership of volumes is changed to
+// the task user, as volumes may have been used by a previous task user.
+// Read-only volumes are owned by the worker and made readable for everyone.
+func attachVolumes(e *engine, mounts []mount, user *system.User) ([]attachedMount, error) {
+	var attached []attachedMount
+	for _, m := range mounts {
+		a, err := attachVolume(e, m, user)
+		if err != nil {
+			if derr := detachVolumes(attached); derr != nil {
+				e.monitor.ReportError(derr, "failed to detach volumes after attaching failed")
+			}
+			return nil, err
+		}
+		attached = append(attached, a)
+	}
+	return attached, nil
+}
+
+func attachVolume(e *engine, m mount, user *system.User) (attachedMount, error) {
+	source := m.volume.Path()
+	target := filepath.Join(user.Home(), filepath.FromSlash(m.mountPoint))
+
+	// Fix ownership of the volume
+	if e.config.CreateUser {
+		owner := user
+		if m.readOnly {
+			var err error
+			if owner, err = system.CurrentUser(); err != nil {
+				return attachedMount{}, err
+			}
+		}
+		if err := system.ChangeOwnerRecursive(source, owner); err != nil {
+			return attachedMount{}, err
+		}
+		if m.readOnly {
+			if err := makeReadable(source); err != nil {
+				return attachedMount{}, err
+			}
+		}
+	}
+
+	// Create parent folders owned by the task user
+	parent := path.Dir(strings.TrimSuffix(m.mountPoint, "/"))
+	if err := mkdirAllOwnedBy(user.Home(), parent, user, e.config.CreateUser); err != nil {
+		return attachedMount{}, err
+	}
+
+	// Bind mount the volume if supported, otherwise we create a symlink
+	err := os.Mkdir(target, 0777)
+	created := err == nil
+	if os.IsExist(err) {
+		if info, lerr := os.Lstat(target); lerr != nil || !info.IsDir() {
+			return attachedMount{}, runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"mount-point: '%s' cannot be used, because it already exists and isn't a folder", m.mountPoint,
+			))
+		}
+	} else if err != nil {
+		return attachedMount{}, fmt.Errorf("failed to create mount-point: '%s', error: %s", m.mountPoint, err)
+	}
+	if err == nil && e.config.CreateUser {
+		if err = system.ChangeOwner(target, user); err != nil {
+			os.Remove(target)
+			return attachedMount{}, err
+		}
+	}
+	err = system.BindMount(source, target, m.readOnly)
+	if err == nil {
+		return attachedMount{target: target, bind: true}, nil
+	}
+	if err != system.ErrBindMountNotSupported {
+		return attachedMount{}, err
+	}
+
+	// A symlink can't be read-only, so read-only volumes require bind mounts
+	if m.readOnly {
+		if created {
+			os.Remove(target)
+		}
+		return attachedMount{}, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"mount-point: '%s' cannot be attached read-only, because bind mounts "+
+				"are not supported by this worker", m.mountPoint,
+		))
+	}
+
+	// Symlinks can only be created in place of an empty folder
+	if err = os.Remove(target); err != nil {
+		return attachedMount{}, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"mount-point: '%s' cannot be used, because it already exists", m.mountPoint,
+		))
+	}
+	if err = os.Symlink(source, target); err != nil {
+		return attachedMount{}, fmt.Errorf("failed to symlink volume at '%s', error: %s", target, err)
+	}
+	return attachedMount{target: target, bind: false}, nil
+}
+
+// detachVolumes detaches volumes in reverse order, it is important that this
+// succeeds before the home folder is removed, as the contents of bind mounted
+// volumes would otherwise be deleted.
+func detachVolumes(attached []attachedMount) error {
+	var err error
+	for i := len(attached) - 1; i >= 0; i-- {
+		a := attached[i]
+		var derr error
+		if a.bind {
+			derr = system.Unmount(a.target)
+		} else {
+			derr = os.Remove(a.target)
+		}
+		if derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// mkdirAllOwnedBy creates the folder given by the slash separated path rel
+// inside root, folders created are owned by user, if chown is true. Existing
+// path components must be folders, symbolic links are not followed as they
+// could lead outside root.
+func mkdirAllOwnedBy(root, rel string, user *system.User, chown bool) error {
+	folder := root
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		folder = filepath.Join(folder, name)
+		info, err := os.Lstat(folder)
+		if err == nil {
+			if !info.IsDir() {
+				return runtime.NewMalformedPayloadError(fmt.Sprintf(
+					"'%s' in the home folder must be a folder to be used in a mount-point", rel,
+				))
+			}
+			continue
+		}
+		if err = os.Mkdir(folder, 0777); err != nil {
+			return fmt.Errorf("failed to create folder: '%s', error: %s", folder, err)
+		}
+		if chown {
+			if err = system.ChangeOwner(folder, user); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// makeReadable grants read access to everyone for all files and folders in
+// folder, symbolic links are ignored.
+func makeReadable(folder string) error {
+	return filepath.Walk(folder, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return nil
+		}
+		if mode.IsDir() {
+			return os.Chmod(name, mode.Perm()|0555)
+		}
+		return os.Chmod(name, mode.Perm()|0444)
+	})
+}
@@ -4,6 +4,7 @@
 //  - qemu
 //  - iproute2
 //  - dnsmasq-base
+//  - e2fsprogs (mkfs.ext4 must support -d, for volumes)
 // This is tested against Debian Jessie 64bit, should probably work with most
 // other systems.
 package qemuengine
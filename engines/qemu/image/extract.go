@@ -4,8 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -22,6 +24,9 @@ const (
 
 const maxImageSize = int64(50 * 1024 * 1024 * 1024) // Use int64 for i386 builds
 
+// stateFileName is the name of the optional saved virtual machine state
+const stateFileName = "vmstate.bin"
+
 // RandomMAC generates a new random MAC with the local bit set.
 func RandomMAC() string {
 	// Credits: http://stackoverflow.com/a/21027407/68333
@@ -37,7 +42,7 @@ func RandomMAC() string {
 
 // extractImage will extract the "disk.img", "layer.qcow2" and "machine.json"
 // files from a tar archive using GNU tar ensuring that sparse entries will be
-// extracted as sparse files.
+// extracted as sparse files. If present "vmstate.bin" will also be extracted.
 //
 // This also validates that files aren't symlinks and are in correct format,
 // with legal backing_file parameters.
@@ -56,9 +61,13 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 	// Using zstd | tar so we get sparse files (sh to get OS pipes)
 	tar := exec.Command("sh", "-fec", "zstd -dqc '"+imageFile+"' | "+
 		"tar -xoC '"+imageFolder+"' --no-same-permissions -- "+
-		"disk.img layer.qcow2 machine.json",
+		"disk.img layer.qcow2 machine.json "+stateFileName,
 	)
 	_, err := tar.Output()
+	// The saved state is optional, so we ignore the error if it's missing
+	if ee, ok := err.(*exec.ExitError); ok && onlyMissingState(ee.Stderr) {
+		err = nil
+	}
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
 			return nil, runtime.NewMalformedPayloadError(
@@ -82,6 +91,19 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 		}
 	}
 
+	// Check the saved state, if present
+	stateFile := filepath.Join(imageFolder, stateFileName)
+	if _, err = os.Lstat(stateFile); err == nil {
+		if !ioext.IsPlainFile(stateFile) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains '",
+				stateFileName, "' which is not a plain file")
+		}
+		if !ioext.IsFileLessThan(stateFile, maxImageSize) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains '",
+				stateFileName, "' larger than ", maxImageSize, " bytes")
+		}
+	}
+
 	// Load the machine configuration
 	machineFile := filepath.Join(imageFolder, "machine.json")
 	machine, err := newMachineFromFile(machineFile)
@@ -136,6 +158,22 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 	return machine, nil
 }
 
+// onlyMissingState returns true, if stderr from GNU tar only complains about
+// the optional saved state being missing from the archive.
+func onlyMissingState(stderr []byte) bool {
+	missing := false
+	for _, line := range strings.Split(strings.TrimSpace(string(stderr)), "\n") {
+		switch strings.TrimSpace(line) {
+		case "tar: " + stateFileName + ": Not found in archive":
+			missing = true
+		case "tar: Exiting with failure status due to previous errors":
+		default:
+			return false
+		}
+	}
+	return missing
+}
+
 // load vm.Machine from file with migration of machine definition
 func newMachineFromFile(machineFile string) (*vm.Machine, error) {
 	// Read machine.json
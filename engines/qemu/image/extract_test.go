@@ -0,0 +1,23 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnlyMissingState(t *testing.T) {
+	require.True(t, onlyMissingState([]byte(
+		"tar: vmstate.bin: Not found in archive\n"+
+			"tar: Exiting with failure status due to previous errors\n",
+	)))
+	require.False(t, onlyMissingState([]byte(
+		"tar: machine.json: Not found in archive\n"+
+			"tar: vmstate.bin: Not found in archive\n"+
+			"tar: Exiting with failure status due to previous errors\n",
+	)))
+	require.False(t, onlyMissingState([]byte(
+		"zstd: error 70 : Write error : Broken pipe\n",
+	)))
+	require.False(t, onlyMissingState([]byte("")))
+}
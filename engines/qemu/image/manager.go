@@ -11,6 +11,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
 // Manager loads and tracks images.
@@ -30,12 +31,13 @@ type Downloader func(imageFile *os.File) error
 // image represents an image of which multiple instances can be created
 type image struct {
 	gc.DisposableResource
-	imageID string
-	folder  string
-	machine *vm.Machine
-	done    <-chan struct{}
-	manager *Manager
-	err     error
+	imageID   string
+	folder    string
+	machine   *vm.Machine
+	stateFile string // saved state, empty-string if none
+	done      <-chan struct{}
+	manager   *Manager
+	err       error
 }
 
 // Instance represents an instance of an image.
@@ -143,6 +145,9 @@ func (img *image) loadImage(download Downloader, done chan<- struct{}) {
 	if err != nil {
 		goto cleanup
 	}
+	if ioext.IsPlainFile(filepath.Join(img.folder, stateFileName)) {
+		img.stateFile = filepath.Join(img.folder, stateFileName)
+	}
 
 	// Clean up if there is any error
 cleanup:
@@ -227,6 +232,17 @@ func (i *Instance) Machine() vm.Machine {
 	return *i.image.machine
 }
 
+// State returns the saved virtual machine state, if any, and the machine
+// configuration the state was saved with. This implements vm.StateImage.
+func (i *Instance) State() (string, vm.Machine) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+	return i.image.stateFile, *i.image.machine
+}
+
 // DiskFile returns the qcow2 file this image instance is backed by.
 func (i *Instance) DiskFile() string {
 	i.m.Lock()
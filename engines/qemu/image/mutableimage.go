@@ -11,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
 // MutableImage is an vm.MutableImage implementation that keeps the image
@@ -70,6 +71,14 @@ func NewMutableImageFromFile(imageFile, imageFolder string) (*MutableImage, erro
 		return nil, fmt.Errorf("Failed to delete layer.qcow2 after extract, err: %s", err)
 	}
 
+	// Remove saved state, if any, as it's invalid once the disk is modified
+	if err := os.Remove(filepath.Join(imageFolder, stateFileName)); err != nil && !os.IsNotExist(err) {
+		// Delete image folder, ignoring errors
+		os.RemoveAll(imageFolder)
+
+		return nil, fmt.Errorf("Failed to delete %s after extract, err: %s", stateFileName, err)
+	}
+
 	return &MutableImage{
 		folder:  imageFolder,
 		machine: machine,
@@ -105,6 +114,31 @@ func (img *MutableImage) Machine() vm.Machine {
 	return *img.machine
 }
 
+// StateFile returns the path to which saved virtual machine state should be
+// written, if the image should be packaged with saved state.
+func (img *MutableImage) StateFile() string {
+	img.m.Lock()
+	defer img.m.Unlock()
+	if img.folder == "" {
+		panic("MutableImage have been disposed")
+	}
+
+	return filepath.Join(img.folder, stateFileName)
+}
+
+// SetMachine sets the machine definition packaged with the image. When saved
+// state is packaged the machine definition must be the exact definition the
+// state was saved with.
+func (img *MutableImage) SetMachine(machine vm.Machine) {
+	img.m.Lock()
+	defer img.m.Unlock()
+	if img.folder == "" {
+		panic("MutableImage have been disposed")
+	}
+
+	img.machine = &machine
+}
+
 // Package will write an zstd compressed tar archive of the image to targetFile.
 // This method cannot be called the image is in-use.
 func (img *MutableImage) Package(targetFile string) error {
@@ -149,10 +183,12 @@ func (img *MutableImage) Package(targetFile string) error {
 	}
 	file.Close()
 
-	// Create tarball of everything
-	tar := exec.Command(
-		"tar", "-Scf", "image.tar", "disk.img", "layer.qcow2", "machine.json",
-	)
+	// Create tarball of everything, including saved state if present
+	files := []string{"disk.img", "layer.qcow2", "machine.json"}
+	if ioext.IsPlainFile(filepath.Join(img.folder, stateFileName)) {
+		files = append(files, stateFileName)
+	}
+	tar := exec.Command("tar", append([]string{"-Scf", "image.tar"}, files...)...)
 	tar.Dir = img.folder
 	if _, err := tar.Output(); err != nil {
 		msg := err.Error()
@@ -187,6 +223,10 @@ func (img *MutableImage) Package(targetFile string) error {
 	if err := os.Remove(filepath.Join(img.folder, "image.tar")); err != nil {
 		return fmt.Errorf("Failed to clean up after packaging, err: %s", err)
 	}
+	// Remove saved state, if any
+	if err := os.Remove(filepath.Join(img.folder, stateFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to clean up after packaging, err: %s", err)
+	}
 
 	return nil
 }
@@ -35,6 +35,7 @@ type MetaService struct {
 	m               sync.Mutex
 	command         []string
 	env             map[string]string
+	mounts          []Mount
 	logDrain        io.Writer
 	resultCallback  func(bool)
 	environment     *runtime.Environment
@@ -81,6 +82,14 @@ func New(
 	return s
 }
 
+// SetMounts sets the volumes the guest should mount before executing the
+// command, this must be called before the virtual machine is started.
+func (s *MetaService) SetMounts(mounts []Mount) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.mounts = mounts
+}
+
 // ServeHTTP handles request to the meta-data service.
 func (s *MetaService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
@@ -121,9 +130,13 @@ func (s *MetaService) handleExecute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	debug("GET /engine/v1/execute")
+	s.m.Lock()
+	mounts := s.mounts
+	s.m.Unlock()
 	reply(w, http.StatusOK, Execute{
 		Command: s.command,
 		Env:     s.env,
+		Mounts:  mounts,
 	})
 }
 
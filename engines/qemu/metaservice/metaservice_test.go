@@ -229,6 +229,34 @@ func TestMetaService(t *testing.T) {
 	assert(t, len(files) == 0, "Expected zero files")
 }
 
+func TestMetaServiceExecute(t *testing.T) {
+	// Setup a new MetaService
+	s := New([]string{"bash", "-c", "whoami"}, map[string]string{
+		"MY_VAR": "hello",
+	}, ioutil.Discard, func(bool) {}, &runtime.Environment{})
+	s.SetMounts([]Mount{
+		{Serial: "volume-0", MountPoint: "/mnt/cache/", ReadOnly: true},
+	})
+
+	// Get the command to execute
+	req, err := http.NewRequest("GET", "http://169.254.169.254/engine/v1/execute", nil)
+	nilOrFatal(t, err)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert(t, w.Code == http.StatusOK)
+
+	// Check the payload
+	var execute Execute
+	err = json.Unmarshal(w.Body.Bytes(), &execute)
+	nilOrFatal(t, err, "Failed to decode JSON")
+	assert(t, len(execute.Command) == 3 && execute.Command[2] == "whoami", "Expected command")
+	assert(t, execute.Env["MY_VAR"] == "hello", "Expected MY_VAR")
+	assert(t, len(execute.Mounts) == 1, "Expected one mount")
+	assert(t, execute.Mounts[0].Serial == "volume-0", "Expected serial")
+	assert(t, execute.Mounts[0].MountPoint == "/mnt/cache/", "Expected mountPoint")
+	assert(t, execute.Mounts[0].ReadOnly, "Expected readOnly")
+}
+
 func TestMetaServiceShell(t *testing.T) {
 	// Create temporary storage
 	storage, err := runtime.NewTemporaryStorage(os.TempDir())
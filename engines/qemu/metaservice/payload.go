@@ -4,6 +4,14 @@ package metaservice
 type Execute struct {
 	Env     map[string]string `json:"env"`
 	Command []string          `json:"command"`
+	Mounts  []Mount           `json:"mounts"`
+}
+
+// Mount instructs the guest to mount a volume before executing the command.
+type Mount struct {
+	Serial     string `json:"serial"`     // serial number of the block device
+	MountPoint string `json:"mountPoint"` // absolute path to mount the volume at
+	ReadOnly   bool   `json:"readOnly"`   // mount the volume read-only
 }
 
 // List of API error codes for using the Error struct.
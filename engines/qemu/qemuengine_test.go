@@ -156,6 +156,23 @@ func TestArtifacts(t *testing.T) {
 	c.Test()
 }
 
+func TestVolumes(t *testing.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "/mnt/my-volume/",
+		WriteVolumePayload: `{
+      "image": "` + s.URL + `",
+      "command": ["sh", "-c", "echo 'hello-cache-volume' > /mnt/my-volume/cache-file.txt"]
+    }`,
+		CheckVolumePayload: `{
+      "image": "` + s.URL + `",
+      "command": ["sh", "-c", "cat /mnt/my-volume/cache-file.txt | grep 'hello-cache-volume'"]
+    }`,
+	}
+
+	c.Test()
+}
+
 func TestShell(t *testing.T) {
 	c := enginetest.ShellTestCase{
 		EngineProvider: provider,
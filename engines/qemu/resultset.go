@@ -30,6 +30,12 @@ func (r *resultSet) Success() bool {
 	return r.success
 }
 
+// ResourceUsage returns resources consumed by the virtual machine, network
+// usage isn't measured for QEMU.
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	return r.vm.ResourceUsage(), nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
 	return r.metaService.GetArtifact(path)
 }
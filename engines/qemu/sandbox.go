@@ -1,6 +1,7 @@
 package qemuengine
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -34,6 +35,7 @@ func newSandbox(
 	command []string,
 	env map[string]string,
 	proxies map[string]http.Handler,
+	mounts []mount,
 	machine vm.Machine,
 	image vm.Image,
 	network vm.Network,
@@ -56,6 +58,26 @@ func newSandbox(
 		return nil, err
 	}
 
+	// Attach volumes as additional disks, the guest identifies disks by serial
+	metaMounts := make([]metaservice.Mount, len(mounts))
+	for i, m := range mounts {
+		serial := fmt.Sprintf("volume-%d", i)
+		err = instance.AttachDisk(vm.Disk{
+			File:     m.volume.DiskFile(),
+			Format:   "qcow2",
+			Serial:   serial,
+			ReadOnly: m.readOnly,
+		})
+		if err != nil {
+			return nil, err
+		}
+		metaMounts[i] = metaservice.Mount{
+			Serial:     serial,
+			MountPoint: m.mountPoint,
+			ReadOnly:   m.readOnly,
+		}
+	}
+
 	// Create sandbox
 	s := &sandbox{
 		vm:      instance,
@@ -67,6 +89,7 @@ func newSandbox(
 
 	// Setup meta-data service
 	s.metaService = metaservice.New(command, env, c.LogDrain(), s.result, e.Environment)
+	s.metaService.SetMounts(metaMounts)
 
 	// Create session manager
 	s.sessions = newSessionManager(s.metaService, s.vm)
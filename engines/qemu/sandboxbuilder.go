@@ -1,6 +1,7 @@
 package qemuengine
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"regexp"
@@ -27,6 +28,7 @@ type sandboxBuilder struct {
 	imageDone  <-chan struct{}
 	proxies    map[string]http.Handler
 	env        map[string]string
+	mounts     []mount
 	context    *runtime.TaskContext
 	engine     *engine
 	monitor    runtime.Monitor
@@ -55,6 +57,9 @@ func newSandboxBuilder(
 
 	// Start downloading and extracting the image
 	go func() {
+		span := c.Span().StartSpan("image.fetch", nil)
+		defer span.End()
+
 		var scopeSets [][]string
 		var inst *image.Instance
 
@@ -78,8 +83,14 @@ func newSandboxBuilder(
 		}
 
 		debug("fetching image: %#v (if not already present)", payload.Image)
+		span.SetAttribute("image", ref.HashKey())
 		inst, err = e.imageManager.Instance(ref.HashKey(), func(imageFile *os.File) error {
-			return ref.Fetch(ctx, &fetcher.FileReseter{File: imageFile})
+			// Only called if the image isn't already present
+			downloadSpan := span.StartSpan("image.download", nil)
+			defer downloadSpan.End()
+			ferr := ref.Fetch(ctx, &fetcher.FileReseter{File: imageFile})
+			downloadSpan.SetError(ferr)
+			return ferr
 		})
 		debug("fetched image: %#v", payload.Image)
 
@@ -88,6 +99,7 @@ func newSandboxBuilder(
 		if fetcher.IsBrokenReferenceError(err) {
 			err = runtime.NewMalformedPayloadError("unable to fetch image, error:", err)
 		}
+		span.SetError(err)
 
 		sb.m.Lock()
 		// if already discarded then we don't set the image... instead we release it
@@ -107,6 +119,59 @@ func newSandboxBuilder(
 	return sb
 }
 
+// mount is a volume to be attached to the virtual machine
+type mount struct {
+	volume     *volume
+	mountPoint string
+	readOnly   bool
+}
+
+// mountPointPattern restricts mount-points to absolute paths ending in slash
+var mountPointPattern = regexp.MustCompile(`^(?:/[^/\0\\:*"<>|]+)+/$`)
+
+func (sb *sandboxBuilder) AttachVolume(mountPoint string, vol engines.Volume, readOnly bool) error {
+	// We may assert that vol is a result from engine.NewVolume()
+	v, ok := vol.(*volume)
+	if !ok {
+		sb.monitor.Panicf("AttachVolume() was passed volume of type: %T", vol)
+	}
+
+	// Validate mount-point
+	if !mountPointPattern.MatchString(mountPoint) {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"mount-point: '%s' is not allowed for QEMU engine, mount-points must be "+
+				"absolute paths ending with a slash, matching: %s",
+			mountPoint, mountPointPattern.String(),
+		))
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check for naming conflicts, we forbid nested mount-points as the result
+	// would depend on the order of the AttachVolume() calls.
+	for _, m := range sb.mounts {
+		if strings.HasPrefix(m.mountPoint, mountPoint) || strings.HasPrefix(mountPoint, m.mountPoint) {
+			return engines.ErrNamingConflict
+		}
+	}
+
+	// Check that we have enough PCI slots for the volume
+	if len(sb.mounts) >= vm.MaxDisks {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"QEMU engine cannot attach more than %d volumes", vm.MaxDisks,
+		))
+	}
+
+	sb.mounts = append(sb.mounts, mount{
+		volume:     v,
+		mountPoint: mountPoint,
+		readOnly:   readOnly,
+	})
+	return nil
+}
+
 var proxyNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
 func (sb *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
@@ -185,7 +250,7 @@ func (sb *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 
 	// Create a sandbox
 	s, err := newSandbox(
-		sb.command, sb.env, sb.proxies, sb.machine, sb.image, sb.network,
+		sb.command, sb.env, sb.proxies, sb.mounts, sb.machine, sb.image, sb.network,
 		sb.context, sb.engine, sb.monitor,
 	)
 	if err != nil {
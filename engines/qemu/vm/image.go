@@ -17,6 +17,16 @@ type MutableImage interface {
 	Package(targetFile string) error // Package the as zstd compressed tar archive
 }
 
+// A StateImage is an Image that may carry a saved virtual machine state, such
+// that the virtual machine can be resumed instead of booted from cold.
+type StateImage interface {
+	Image
+	// State returns the file holding the saved virtual machine state, and the
+	// machine definition the state was saved with. If the image doesn't carry
+	// a saved state, the file is empty-string.
+	State() (string, Machine)
+}
+
 // imageMachinePair holds an image and a machine overwriting the built-in machine.
 type imageMachinePair struct {
 	Image
@@ -35,3 +45,11 @@ func OverwriteMachine(image Image, machine Machine) Image {
 		machine: machine.WithDefaults(image.Machine()),
 	}
 }
+
+// State forwards the saved state of the underlying image, if any.
+func (i *imageMachinePair) State() (string, Machine) {
+	if si, ok := i.Image.(StateImage); ok {
+		return si.State()
+	}
+	return "", Machine{}
+}
@@ -182,6 +182,11 @@ func (m Machine) ApplyLimits(limits MachineLimits) (Machine, error) {
 	return Machine{o}, nil
 }
 
+// equals returns true, if m and other have the same definition
+func (m Machine) equals(other Machine) bool {
+	return reflect.DeepEqual(m.options, other.options)
+}
+
 // DeriveLimits constructs sane MachineLimits that permits the machine.
 func (m Machine) DeriveLimits() MachineLimits {
 	// Default 1 for threads, cores and sockets
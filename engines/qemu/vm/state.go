@@ -0,0 +1,165 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+)
+
+const (
+	// statePollInterval is the interval between checks of migration status
+	statePollInterval = 100 * time.Millisecond
+	// stateTimeout is the maximum time to spend saving or loading state
+	stateTimeout = 10 * time.Minute
+	// linkDownDuration is the time the network link is down after resuming,
+	// giving the guest time to notice, so it will renew its DHCP lease.
+	linkDownDuration = 1 * time.Second
+)
+
+// ErrVMNotRunning is returned from SaveState if QEMU isn't running
+var ErrVMNotRunning = errors.New("virtual machine isn't running")
+
+// run executes a QMP command and decodes the return value into result, if
+// result is non-nil.
+func (vm *VirtualMachine) run(command string, args interface{}, result interface{}) error {
+	raw, err := vm.domain.Run(qmp.Command{
+		Execute: command,
+		Args:    args,
+	})
+	if err != nil {
+		return fmt.Errorf("failed QMP command '%s', error: %s", command, err)
+	}
+	if result == nil {
+		return nil
+	}
+	var response struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if err = json.Unmarshal(raw, &response); err != nil {
+		return fmt.Errorf("failed to parse response from QMP command '%s', error: %s", command, err)
+	}
+	if err = json.Unmarshal(response.Return, result); err != nil {
+		return fmt.Errorf("failed to parse return value from QMP command '%s', error: %s", command, err)
+	}
+	return nil
+}
+
+// poll calls check every statePollInterval until it returns true, an error,
+// stateTimeout is exceeded or exited is closed, when QEMU terminates.
+func (vm *VirtualMachine) poll(exited <-chan struct{}, check func() (bool, error)) error {
+	deadline := time.After(stateTimeout)
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+		select {
+		case <-deadline:
+			return errors.New("timed out waiting for migration")
+		case <-exited:
+			return ErrVMNotRunning
+		case <-time.After(statePollInterval):
+		}
+	}
+}
+
+// waitForIncoming waits for the saved state given as incoming migration to be
+// loaded, and disconnects the network link before execution is continued.
+func (vm *VirtualMachine) waitForIncoming(exited <-chan struct{}) error {
+	err := vm.poll(exited, func() (bool, error) {
+		var status struct {
+			Status string `json:"status"`
+		}
+		if err := vm.run("query-status", nil, &status); err != nil {
+			return false, err
+		}
+		return status.Status != "inmigrate", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The guest was saved with a network different from the one it is given
+	// now, disconnecting the link until the guest is running, causes most
+	// guests to renew their DHCP lease.
+	return vm.run("set_link", map[string]interface{}{
+		"name": "nic0",
+		"up":   false,
+	}, nil)
+}
+
+// reconnectNetwork connects the network link after linkDownDuration, this
+// must be called after the guest is resumed.
+func (vm *VirtualMachine) reconnectNetwork() {
+	select {
+	case <-vm.Done:
+		return
+	case <-time.After(linkDownDuration):
+	}
+	err := vm.run("set_link", map[string]interface{}{
+		"name": "nic0",
+		"up":   true,
+	}, nil)
+	if err != nil {
+		vm.monitor.ReportError(err, "failed to reconnect network after resuming saved state")
+	}
+}
+
+// SaveState stops the virtual machine, saves the state to stateFile and quits
+// QEMU. This is used when building images to capture the state of a booted
+// virtual machine, such that it can be resumed instead of booted.
+//
+// The disk must not be modified after the state has been saved, as the state
+// can only be resumed with the disk as it was when the state was saved.
+func (vm *VirtualMachine) SaveState(stateFile string) error {
+	vm.m.Lock()
+	running := vm.domain != nil && vm.socketFolder != ""
+	vm.m.Unlock()
+	if !running {
+		return ErrVMNotRunning
+	}
+	if strings.ContainsAny(stateFile, "'\\") {
+		return fmt.Errorf("state file path '%s' cannot contain quotes", stateFile)
+	}
+
+	// Stop execution, so the guest doesn't change while we save the state
+	if err := vm.run("stop", nil, nil); err != nil {
+		return err
+	}
+
+	// Save state with migration to file
+	debug("saving virtual machine state to: %s", stateFile)
+	err := vm.run("migrate", map[string]interface{}{
+		"uri": "exec:cat > '" + stateFile + "'",
+	}, nil)
+	if err != nil {
+		return err
+	}
+	err = vm.poll(vm.Done, func() (bool, error) {
+		var info struct {
+			Status string `json:"status"`
+		}
+		if err := vm.run("query-migrate", nil, &info); err != nil {
+			return false, err
+		}
+		if info.Status == "failed" || info.Status == "cancelled" {
+			return false, fmt.Errorf("saving state failed, migration status: %s", info.Status)
+		}
+		return info.Status == "completed", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Quit QEMU, the execution is stopped so we can kill it if quit fails
+	if err = vm.run("quit", nil, nil); err != nil {
+		debug("QMP command 'quit' failed, killing QEMU, error: %s", err)
+		vm.Kill()
+	}
+	<-vm.Done
+	return nil
+}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+// clockTicks is the number of clock ticks per second used in /proc/<pid>/stat,
+// this is USER_HZ which is 100 on all mainstream linux platforms.
+const clockTicks = 100
+
+// ResourceUsage returns resources consumed by the virtual machine, CPU time
+// and peak memory is for the QEMU process, disk I/O is from QMP blockstats.
+// Values that can't be measured are -1, this is only measured while QEMU is
+// running.
+func (vm *VirtualMachine) ResourceUsage() engines.ResourceUsage {
+	usage := engines.NewResourceUsage()
+
+	vm.m.Lock()
+	running := vm.domain != nil && vm.socketFolder != ""
+	vm.m.Unlock()
+	select {
+	case <-vm.Done:
+		running = false
+	default:
+	}
+	if !running {
+		return usage
+	}
+
+	// Sum bytes read and written over all block devices
+	var blockstats []struct {
+		Device string `json:"device"`
+		Stats  struct {
+			ReadBytes  int64 `json:"rd_bytes"`
+			WriteBytes int64 `json:"wr_bytes"`
+		} `json:"stats"`
+	}
+	if err := vm.run("query-blockstats", nil, &blockstats); err != nil {
+		vm.monitor.ReportWarning(err, "failed to query blockstats for resource usage")
+	} else {
+		usage.DiskReadBytes = 0
+		usage.DiskWriteBytes = 0
+		for _, b := range blockstats {
+			usage.DiskReadBytes += b.Stats.ReadBytes
+			usage.DiskWriteBytes += b.Stats.WriteBytes
+		}
+	}
+
+	// Read CPU time and peak memory for the QEMU process, this is only
+	// available on linux.
+	pid := vm.qemu.Process.Pid
+	if cpu, err := readProcessCPUTime(pid); err == nil {
+		usage.CPUTime = cpu
+	} else if !os.IsNotExist(err) {
+		vm.monitor.ReportWarning(err, "failed to read CPU time for QEMU process")
+	}
+	if peak, err := readProcessPeakMemory(pid); err == nil {
+		usage.PeakMemory = peak
+	} else if !os.IsNotExist(err) {
+		vm.monitor.ReportWarning(err, "failed to read peak memory for QEMU process")
+	}
+
+	return usage
+}
+
+// readProcessCPUTime returns utime + stime from /proc/<pid>/stat
+func readProcessCPUTime(pid int) (time.Duration, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name in parentheses may contain spaces, so skip past it
+	s := string(data)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	// utime and stime are field 14 and 15, counting from the pid as field 1
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse utime from /proc/%d/stat, error: %s", pid, err)
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse stime from /proc/%d/stat, error: %s", pid, err)
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
+
+// readProcessPeakMemory returns VmHWM from /proc/<pid>/status in bytes
+func readProcessPeakMemory(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Line has the form: 'VmHWM:    123456 kB'
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmHWM:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse VmHWM from /proc/%d/status, error: %s", pid, err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("VmHWM not found in /proc/%d/status", pid)
+}
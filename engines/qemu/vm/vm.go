@@ -2,6 +2,7 @@ package vm
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -53,8 +54,27 @@ type VirtualMachine struct {
 	Error        error           // Error, to be read after Done is closed
 	monitor      runtime.Monitor
 	domain       *qemu.Domain
+	machine      Machine // machine definition after defaults and limits
+	stateFile    string  // saved state to resume from, empty if booting
+	resumed      bool    // true, if resumed from saved state
+	killed       bool    // true, if Kill() has been called
+	storage      string  // storage device for attaching disks
+	disks        int     // number of additional disks attached
 }
 
+// Disk holds the options for an additional disk to be attached to the virtual
+// machine using AttachDisk().
+type Disk struct {
+	File     string // path to disk image file
+	Format   string // disk image format: 'qcow2' or 'raw'
+	Serial   string // serial number exposed to the guest, max 20 characters
+	ReadOnly bool   // attach the disk read-only
+}
+
+// MaxDisks is the maximum number of additional disks that can be attached to
+// a virtual machine, limited by the number of free PCI slots.
+const MaxDisks = 16
+
 // NewVirtualMachine constructs a new virtual machine using the given
 // machineOptions, image, network and cdroms.
 //
@@ -75,6 +95,18 @@ func NewVirtualMachine(
 	}
 	o := m.options
 
+	// Resume from saved state, if the image has one saved with this machine
+	var stateFile string
+	if si, ok := image.(StateImage); ok {
+		if f, sm := si.State(); f != "" {
+			if sm.WithDefaults(defaultMachine).equals(m) {
+				stateFile = f
+			} else {
+				monitor.Info("image has saved state for a different machine definition, booting from cold")
+			}
+		}
+	}
+
 	// Create a sub-folder in the socketFolder
 	socketFolder = filepath.Join(socketFolder, slugid.Nice())
 
@@ -84,6 +116,9 @@ func NewVirtualMachine(
 		network:      network,
 		image:        image,
 		monitor:      monitor,
+		machine:      m,
+		stateFile:    stateFile,
+		storage:      o.Storage,
 	}
 
 	vncSocket := filepath.Join(vm.socketFolder, vncSocketFile)
@@ -92,25 +127,8 @@ func NewVirtualMachine(
 	// Construct options for QEMU
 	var options []string
 	// Auxiliary functions for defining options
-	type args map[string]string
 	option := func(option, prefix string, args args) {
-		// Sort for consistency. QEMU shouldn't care about order, but if there is
-		// a bug it's nice that it's consistent.
-		keys := make([]string, 0, len(args))
-		for k := range args {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		// Create pairs and join with a comma
-		pairs := make([]string, len(keys))
-		for i, k := range keys {
-			pairs[i] = fmt.Sprintf("%s=%s", k, args[k])
-		}
-		// Preprend with prefix, if it's non-empty
-		if prefix != "" {
-			pairs = append([]string{prefix}, pairs...)
-		}
-		options = append(options, "-"+option, strings.Join(pairs, ","))
+		options = append(options, qemuOption(option, prefix, args)...)
 	}
 	device := func(device string, args args) { option("device", device, args) }
 	drive := func(flags string, args args) { option("drive", flags, args) }
@@ -323,6 +341,84 @@ func NewVirtualMachine(
 	return vm, nil
 }
 
+// args for a QEMU command line option
+type args map[string]string
+
+// qemuOption returns the command line arguments for a QEMU option, prefix and
+// key-value pairs from args are joined with commas. Commas in values from args
+// are escaped by doubling them, as QEMU expects.
+func qemuOption(option, prefix string, args args) []string {
+	// Sort for consistency. QEMU shouldn't care about order, but if there is
+	// a bug it's nice that it's consistent.
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// Create pairs and join with a comma
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, strings.Replace(args[k], ",", ",,", -1))
+	}
+	// Preprend with prefix, if it's non-empty
+	if prefix != "" {
+		pairs = append([]string{prefix}, pairs...)
+	}
+	return []string{"-" + option, strings.Join(pairs, ",")}
+}
+
+// AttachDisk attaches an additional disk to the virtual machine, this must be
+// called before Start(). Disks are attached in PCI slots following the boot
+// disk, the guest can identify the disk by serial number.
+func (vm *VirtualMachine) AttachDisk(disk Disk) error {
+	vm.m.Lock()
+	defer vm.m.Unlock()
+	if vm.started {
+		panic("AttachDisk() cannot be called after the virtual machine is started")
+	}
+	// Saved state doesn't include additional disks, so we must boot from cold
+	if vm.stateFile != "" {
+		vm.monitor.Info("ignoring saved state, as additional disks are attached, booting from cold")
+		vm.stateFile = ""
+	}
+	if vm.disks >= MaxDisks {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"virtual machine cannot have more than %d additional disks attached", MaxDisks,
+		))
+	}
+	id := fmt.Sprintf("disk-%d", vm.disks+1)
+	drive := args{
+		"file":   disk.File,
+		"if":     "none",
+		"id":     id,
+		"cache":  "writeback",
+		"aio":    "threads",
+		"format": disk.Format,
+		"werror": "report",
+		"rerror": "report",
+	}
+	if disk.ReadOnly {
+		drive["readonly"] = "on"
+	}
+	vm.qemu.Args = append(vm.qemu.Args, qemuOption("drive", "", drive)...)
+	vm.qemu.Args = append(vm.qemu.Args, qemuOption("device", vm.storage, args{
+		"scsi":   "off",
+		"bus":    "pci.0",
+		"addr":   fmt.Sprintf("0x%x", 0x9+vm.disks), // Additional disks follow boot disk at 0x8
+		"drive":  id,
+		"id":     "virtio-" + id,
+		"serial": disk.Serial,
+	})...)
+	vm.disks++
+	return nil
+}
+
+// Machine returns the machine definition of the virtual machine, after
+// defaults and limits have been applied.
+func (vm *VirtualMachine) Machine() Machine {
+	return vm.machine
+}
+
 // SetHTTPHandler sets the HTTP handler for the meta-data service.
 func (vm *VirtualMachine) SetHTTPHandler(handler http.Handler) {
 	vm.m.Lock()
@@ -334,6 +430,9 @@ func (vm *VirtualMachine) SetHTTPHandler(handler http.Handler) {
 }
 
 // Start the virtual machine.
+//
+// If the virtual machine is to be resumed from saved state and resuming fails,
+// the virtual machine is booted from cold instead.
 func (vm *VirtualMachine) Start() {
 	vm.m.Lock()
 	if vm.started {
@@ -343,37 +442,93 @@ func (vm *VirtualMachine) Start() {
 	vm.started = true
 	vm.m.Unlock()
 
+	// Arguments for QEMU, the incoming migration is added when resuming
+	args := vm.qemu.Args[1:]
+
+	// Resume from saved state, if we have one
+	if vm.stateFile != "" {
+		if !vm.launch(args, true) {
+			return
+		}
+		vm.monitor.Warn("Failed to resume from saved state, booting from cold")
+	}
+	vm.launch(args, false)
+}
+
+// launch starts the QEMU process, if resume is true the saved state is given
+// as incoming migration.
+//
+// Returns true, if resuming failed and the QEMU process was terminated without
+// releasing resources, such that the virtual machine can be booted from cold.
+func (vm *VirtualMachine) launch(args []string, resume bool) bool {
 	stdout, stdoutWriter := io.Pipe()
 	stderr, stderrWriter := io.Pipe()
+
+	// Create QEMU process
+	vm.m.Lock()
+	vm.qemu = exec.Command(vm.qemu.Path, args...)
 	vm.qemu.Stdout = stdoutWriter
 	vm.qemu.Stderr = stderrWriter
+	vm.m.Unlock()
 
 	// Local reference to socketFolder to avoid race condition
 	socketFolder := vm.socketFolder
 
-	// Create socket folder
-	err := os.MkdirAll(socketFolder, 0700)
+	// Create socket folder, removing sockets from previous attempts
+	err := os.RemoveAll(socketFolder)
+	if err == nil {
+		err = os.MkdirAll(socketFolder, 0700)
+	}
 	if err != nil {
 		vm.monitor.Errorf("Failed to create socketFolder, error: %s", err)
-		vm.Error = err
-		close(vm.qemuDone)
-		return
+		vm.m.Lock()
+		vm.release(err)
+		vm.m.Unlock()
+		return false
 	}
 
 	// Start monitor socketFolder for vnc and qmp sockets
 	socketsReady, err := vm.waitForSockets()
 	if err != nil {
 		vm.monitor.Errorf("Error configuring socketFolder monitoring, error: %s", err)
-		vm.Error = err
-		close(vm.qemuDone)
-		return
+		vm.m.Lock()
+		vm.release(err)
+		vm.m.Unlock()
+		return false
 	}
 
-	// Start QEMU
-	vm.Error = vm.qemu.Start()
-	if vm.Error != nil {
-		close(vm.qemuDone)
-		return
+	// Pass saved state as incoming migration, if resuming
+	var state *os.File
+	if resume {
+		state, err = os.Open(vm.stateFile)
+		if err != nil {
+			vm.monitor.Errorf("Failed to open saved state, error: %s", err)
+			vm.m.Lock()
+			vm.release(err)
+			vm.m.Unlock()
+			return false
+		}
+		vm.qemu.ExtraFiles = []*os.File{state}
+		vm.qemu.Args = append(vm.qemu.Args, "-incoming", "fd:3") // ExtraFiles start at fd 3
+	}
+
+	// Start QEMU, unless we were killed before booting from cold
+	cmd := vm.qemu
+	vm.m.Lock()
+	if vm.killed {
+		err = errors.New("virtual machine was killed")
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		vm.release(err)
+	}
+	vm.m.Unlock()
+	if state != nil {
+		state.Close() // QEMU holds its own file descriptor
+	}
+	if err != nil {
+		return false
 	}
 
 	// Forward stdout/err to log
@@ -383,56 +538,60 @@ func (vm *VirtualMachine) Start() {
 	go scanLog(stderr, vm.monitor.Error, vm.monitor.Error)
 
 	// Wait for QEMU to finish and cleanup
+	exited := make(chan struct{})
 	go func() {
 		// Wait for QEMU to be done
-		werr := vm.qemu.Wait()
+		werr := cmd.Wait()
 		debug("qemu terminated")
 
 		// Acquire lock
 		vm.m.Lock()
 		defer vm.m.Unlock()
+		defer close(exited)
 
 		// Close output pipes
 		stdoutWriter.Close()
 		stderrWriter.Close()
 
-		// Set error, if any and not already set
-		if vm.Error == nil {
-			vm.Error = werr
-		}
-
 		// Close domain, if set
 		if vm.domain != nil {
 			vm.domain.Close()
 		}
 
-		// Release network and image
-		vm.network.Release()
-		vm.network = nil
-		vm.image.Release()
-		vm.image = nil
-
-		// Remove socket folder
-		os.RemoveAll(vm.socketFolder)
-		vm.socketFolder = ""
-
-		// Notify everybody that the VM is stopped
-		// Ensure resources are freed first, otherwise we'll race with resources
-		// against the next task. If the number of resources is limiting the
-		// number of concurrent tasks we can run.
-		// This is usually the case, so race would happen at full capacity.
-		close(vm.qemuDone)
+		// If resuming failed, we keep resources for booting from cold
+		if resume && !vm.resumed && !vm.killed {
+			return
+		}
+
+		vm.release(werr)
 	}()
 
+	// fail aborts the VM, if resuming we just terminate QEMU and wait for it to
+	// exit, returning true if resources were kept for booting from cold.
+	fail := func(err error) bool {
+		if !resume {
+			vm.abort(err)
+			return false
+		}
+		vm.monitor.Warn("Error resuming from saved state, error: ", err)
+		cmd.Process.Kill()
+		<-exited
+		select {
+		case <-vm.Done:
+			return false
+		default:
+			return true
+		}
+	}
+
 	// Wait for vncSocket and qmpSocket to appear, or qemu to crash
 	select {
 	case err = <-socketsReady:
 		if err != nil {
-			vm.abort(err)
-			return
+			return fail(err)
 		}
-	case <-vm.Done:
-		return
+	case <-exited:
+		return fail(errors.New("QEMU terminated before sockets were ready"))
 	}
 
 	// Create monitor
@@ -440,40 +599,54 @@ func (vm *VirtualMachine) Start() {
 	monitor, err := qmp.NewSocketMonitor("unix", qmpSocket, 5*time.Second)
 	if err != nil {
 		debug("Error opening QMP monitor, error: %s", err)
-		vm.abort(fmt.Errorf("Failed to open QMP monitor, error: %s", err))
-		return
+		return fail(fmt.Errorf("Failed to open QMP monitor, error: %s", err))
 	}
 
 	if err = monitor.Connect(); err != nil {
 		debug("Error connecting QMP monitor, error: %s", err)
-		vm.abort(fmt.Errorf("Failed to connect to QMP monitor, error: %s", err))
 		monitor.Disconnect()
-		return
+		return fail(fmt.Errorf("Failed to connect to QMP monitor, error: %s", err))
 	}
 
 	domain, err := qemu.NewDomain(monitor, slugid.Nice())
 	if err != nil {
 		debug("Error creating domain from QMP monitor, error: %s", err)
-		vm.abort(fmt.Errorf("Failed to create domain from QMP monitor, error: %s", err))
 		monitor.Disconnect()
-		return
+		return fail(fmt.Errorf("Failed to create domain from QMP monitor, error: %s", err))
 	}
 
 	// Acquire lock when we set domain, so we don't race with QEMU cleanup code
 	// above... This code will close domain, if it's non-nil, so after setting it
-	// just check that vm.Done isn't closed as that would indicate the code
-	// already ran, and we just have to cleanup.
+	// just check that QEMU didn't exit as that would indicate the code already
+	// ran, and we just have to cleanup.
 	vm.m.Lock()
 	vm.domain = domain
 	select {
-	case <-vm.Done:
-		vm.domain.Close()
+	case <-exited:
+		domain.Close()
 		vm.m.Unlock()
-		return
+		return fail(errors.New("QEMU terminated before domain was created"))
 	default:
 	}
 	vm.m.Unlock()
 
+	// Wait for saved state to be loaded, if resuming
+	if resume {
+		if err = vm.waitForIncoming(exited); err != nil {
+			return fail(fmt.Errorf("Failed to resume from saved state, error: %s", err))
+		}
+		// Once resumed, QEMU exiting must release resources, unless it already did
+		vm.m.Lock()
+		select {
+		case <-exited:
+			vm.m.Unlock()
+			return fail(errors.New("QEMU terminated after resuming from saved state"))
+		default:
+			vm.resumed = true
+		}
+		vm.m.Unlock()
+	}
+
 	// Run QMP command continue to start execution
 	_, err = vm.domain.Run(qmp.Command{
 		Execute: "cont",
@@ -481,7 +654,40 @@ func (vm *VirtualMachine) Start() {
 	if err != nil {
 		debug("Error executing QMP command 'cont', error: %s", err)
 		vm.abort(fmt.Errorf("Failed QMP command 'cont', error: %s", err))
+		return false
 	}
+
+	// Reconnect the network, so the guest will renew its DHCP lease
+	if resume {
+		go vm.reconnectNetwork()
+	}
+	return false
+}
+
+// release sets the error, if any and not already set, releases network, image
+// and socket folder, and closes Done. Caller must hold vm.m.
+func (vm *VirtualMachine) release(err error) {
+	// Set error, if any and not already set
+	if vm.Error == nil {
+		vm.Error = err
+	}
+
+	// Release network and image
+	vm.network.Release()
+	vm.network = nil
+	vm.image.Release()
+	vm.image = nil
+
+	// Remove socket folder
+	os.RemoveAll(vm.socketFolder)
+	vm.socketFolder = ""
+
+	// Notify everybody that the VM is stopped
+	// Ensure resources are freed first, otherwise we'll race with resources
+	// against the next task. If the number of resources is limiting the
+	// number of concurrent tasks we can run.
+	// This is usually the case, so race would happen at full capacity.
+	close(vm.qemuDone)
 }
 
 // abort kills the VM and sets the error, if it's not already dead with another
@@ -503,7 +709,13 @@ func (vm *VirtualMachine) Kill() {
 		return // We're obviously not running, so we must be done
 	default:
 		debug("terminating QEMU with SIGKILL")
-		vm.qemu.Process.Kill()
+		vm.m.Lock()
+		vm.killed = true
+		process := vm.qemu.Process
+		vm.m.Unlock()
+		if process != nil {
+			process.Kill()
+		}
 		<-vm.Done
 	}
 }
@@ -538,7 +750,7 @@ func (vm *VirtualMachine) Screenshot() (image.Image, error) {
 // waitForSockets will monitor socketFolder and return a channel that is closed
 // when vncSocketFile and qmpSocketFile have been created.
 func (vm *VirtualMachine) waitForSockets() (<-chan error, error) {
-	done := make(chan error)
+	done := make(chan error, 1) // buffered, as nobody reads after QEMU exits
 
 	// Cache socket folder here to avoid race conditions
 	socketFolder := vm.socketFolder
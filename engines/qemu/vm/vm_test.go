@@ -0,0 +1,41 @@
+package vm
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQemuOption(t *testing.T) {
+	assert.Equal(t, []string{"-boot", "menu=off,strict=on"}, qemuOption("boot", "", args{
+		"menu":   "off",
+		"strict": "on",
+	}))
+	assert.Equal(t, []string{"-device", "usb-kbd,id=keyboard-0"}, qemuOption("device", "usb-kbd", args{
+		"id": "keyboard-0",
+	}))
+	assert.Equal(t, []string{"-drive", "file=/tmp/a,,b.img"}, qemuOption("drive", "", args{
+		"file": "/tmp/a,b.img",
+	}))
+}
+
+func TestAttachDisk(t *testing.T) {
+	vm := &VirtualMachine{
+		qemu:    exec.Command("qemu-system-x86_64"),
+		storage: "virtio-blk-pci",
+	}
+	require.NoError(t, vm.AttachDisk(Disk{
+		File:     "/mnt/volumes/my,volume.qcow2",
+		Format:   "qcow2",
+		Serial:   "vol-1",
+		ReadOnly: true,
+	}))
+	assert.Equal(t, []string{
+		"qemu-system-x86_64",
+		"-drive", "aio=threads,cache=writeback,file=/mnt/volumes/my,,volume.qcow2," +
+			"format=qcow2,id=disk-1,if=none,readonly=on,rerror=report,werror=report",
+		"-device", "virtio-blk-pci,addr=0x9,bus=pci.0,drive=disk-1,id=virtio-disk-1,scsi=off,serial=vol-1",
+	}, vm.qemu.Args)
+}
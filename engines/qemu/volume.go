@@ -0,0 +1,296 @@
+package qemuengine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// defaultVolumeSize is the size of volumes in GiB, if not specified
+const defaultVolumeSize = 10
+
+// volumeDiskFile is the name of the disk image in the volume folder
+const volumeDiskFile = "volume.qcow2"
+
+var volumeSchema = schematypes.Object{
+	Title: "QEMU Volume Options",
+	Description: util.Markdown(`
+		Options for QEMU volumes, volumes are qcow2 disk images formatted with
+		ext4, which are attached to the virtual machine as additional block
+		devices and mounted by the guest-tools.
+	`),
+	Properties: schematypes.Properties{
+		"size": schematypes.Integer{
+			Title: "Volume Size",
+			Description: util.Markdown(fmt.Sprintf(`
+				Size of the volume in GiB, defaults to %d GiB. Storage is only
+				allocated as data is written to the volume.
+			`, defaultVolumeSize)),
+			Minimum: 1,
+			Maximum: 80, // For sanity, same as the limit for images
+		},
+	},
+}
+
+type volumeOptions struct {
+	Size int `json:"size"`
+}
+
+type volumeBuilder struct {
+	engines.VolumeBuilderBase
+	m       sync.Mutex
+	staging runtime.TemporaryFolder
+	options volumeOptions
+	engine  *engine
+	monitor runtime.Monitor
+	invalid bool
+}
+
+type volume struct {
+	engines.VolumeBase
+	m        sync.Mutex
+	folder   runtime.TemporaryFolder
+	monitor  runtime.Monitor
+	disposed bool
+}
+
+func newVolumeBuilder(e *engine, options volumeOptions) (*volumeBuilder, error) {
+	// Create a folder for staging files to be written to the volume
+	staging, err := e.Environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		e.monitor.ReportError(err, "failed to create staging folder for volume")
+		return nil, runtime.ErrFatalInternalError
+	}
+	// Ensure the root of the volume is writable by the task user in the guest
+	if err = os.Chmod(staging.Path(), 0777); err != nil {
+		staging.Remove()
+		e.monitor.ReportError(err, "failed to chmod staging folder for volume")
+		return nil, runtime.ErrFatalInternalError
+	}
+
+	return &volumeBuilder{
+		staging: staging,
+		options: options,
+		engine:  e,
+		monitor: e.monitor.WithPrefix("volume"),
+	}, nil
+}
+
+// path returns the path to name in the staging folder, or an error if name
+// reaches outside the staging folder.
+func (vb *volumeBuilder) path(name string) (string, error) {
+	root := filepath.Clean(vb.staging.Path())
+	p := filepath.Join(root, filepath.FromSlash(name))
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path: '%s' is outside the volume", name)
+	}
+	return p, nil
+}
+
+func (vb *volumeBuilder) WriteFolder(name string) error {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.monitor.Panic("VolumeBuilder.WriteFolder() was called after BuildVolume()/Discard()")
+	}
+
+	p, err := vb.path(name)
+	if err != nil {
+		vb.monitor.ReportError(err, "VolumeBuilder.WriteFolder() for qemu-engine attempted to create folder outside the volume")
+		return runtime.ErrFatalInternalError
+	}
+
+	if err = os.MkdirAll(p, 0777); err != nil {
+		vb.monitor.WithTag("folderName", name).ReportError(err, "VolumeBuilder.WriteFolder() for qemu-engine failed to create folder")
+		return runtime.ErrFatalInternalError
+	}
+	return nil
+}
+
+func (vb *volumeBuilder) WriteFile(name string) io.WriteCloser {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.monitor.Panic("VolumeBuilder.WriteFile() was called after BuildVolume()/Discard()")
+	}
+
+	p, err := vb.path(name)
+	if err != nil {
+		vb.monitor.ReportError(err, "VolumeBuilder.WriteFile() for qemu-engine attempted to create file outside the volume")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		vb.monitor.WithTag("fileName", name).ReportError(err, "VolumeBuilder.WriteFile() for qemu-engine failed to create folders for file")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		vb.monitor.WithTag("fileName", name).ReportError(err, "VolumeBuilder.WriteFile() for qemu-engine failed to create file")
+		return &errWriteCloser{Err: runtime.ErrFatalInternalError}
+	}
+
+	return f // Note it is the callers responsibility to close the file
+}
+
+func (vb *volumeBuilder) BuildVolume() (engines.Volume, error) {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.monitor.Panic("VolumeBuilder.BuildVolume() was called after BuildVolume()/Discard()")
+	}
+	vb.invalid = true
+
+	// Whatever happens we remove the staging folder
+	defer func() {
+		if err := vb.staging.Remove(); err != nil {
+			vb.monitor.ReportWarning(err, "failed to remove staging folder for volume")
+		}
+	}()
+
+	// Create folder for the volume
+	folder, err := vb.engine.Environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		vb.monitor.ReportError(err, "failed to create folder for volume")
+		return nil, runtime.ErrFatalInternalError
+	}
+
+	size := vb.options.Size
+	if size == 0 {
+		size = defaultVolumeSize
+	}
+	err = createVolumeDisk(vb.staging.Path(), filepath.Join(folder.Path(), volumeDiskFile), size)
+	if err != nil {
+		folder.Remove()
+		vb.monitor.ReportError(err, "failed to create disk image for volume")
+		return nil, runtime.ErrFatalInternalError
+	}
+
+	return &volume{
+		folder:  folder,
+		monitor: vb.monitor,
+	}, nil
+}
+
+func (vb *volumeBuilder) Discard() error {
+	vb.m.Lock()
+	defer vb.m.Unlock()
+
+	// Ensure that this VolumeBuilder instance is still valid
+	if vb.invalid {
+		vb.monitor.Panic("VolumeBuilder.Discard() was called after BuildVolume()/Discard()")
+	}
+	vb.invalid = true
+
+	if err := vb.staging.Remove(); err != nil {
+		vb.monitor.ReportError(err, "failed to remove staging folder for volume")
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
+}
+
+// createVolumeDisk creates a qcow2 disk image at target with an ext4
+// file-system of given size in GiB, populated with the contents of folder.
+func createVolumeDisk(folder, target string, size int) error {
+	// Create a raw sparse file next to the target, mkfs.ext4 can't write qcow2
+	raw := target + ".raw"
+	defer os.Remove(raw)
+	f, err := os.Create(raw)
+	if err != nil {
+		return errors.Wrap(err, "failed to create raw disk image")
+	}
+	err = f.Truncate(int64(size) * 1024 * 1024 * 1024)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to allocate raw disk image")
+	}
+
+	// Format as ext4 and populate with files from folder
+	err = runCommand("mkfs.ext4", "-q", "-F", "-L", "volume", "-d", folder, raw)
+	if err != nil {
+		return err
+	}
+
+	// Convert to qcow2, this preserves sparseness
+	return runCommand(
+		"qemu-img", "convert", "-f", "raw", "-O", "qcow2",
+		raw, target,
+	)
+}
+
+// runCommand runs a command and returns an error with stderr, if it fails
+func runCommand(name string, args ...string) error {
+	_, err := exec.Command(name, args...).Output()
+	if err != nil {
+		msg := err.Error()
+		if ee, ok := err.(*exec.ExitError); ok {
+			msg = string(ee.Stderr)
+		}
+		return fmt.Errorf("failed to run '%s %s', error: %s", name, strings.Join(args, " "), msg)
+	}
+	return nil
+}
+
+// DiskFile returns the path to the qcow2 disk image for the volume
+func (v *volume) DiskFile() string {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// Validate that this haven't been disposed yet
+	if v.disposed {
+		v.monitor.Panic("Volume cannot be used after Dispose()")
+	}
+
+	return filepath.Join(v.folder.Path(), volumeDiskFile)
+}
+
+func (v *volume) Dispose() error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// Ignore double Dispose() there is no risk here
+	if v.disposed {
+		v.monitor.Warn("Volume.Dispose() was called twice!")
+		return nil
+	}
+	v.disposed = true
+
+	if err := v.folder.Remove(); err != nil {
+		v.monitor.ReportError(err, "Volume.Dispose() failed to remove volume folder")
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
+}
+
+// errWriteCloser is a simple io.WriteCloser implementation that returns Err
+// for all operations.
+type errWriteCloser struct {
+	Err error
+}
+
+func (e *errWriteCloser) Write(p []byte) (int, error) {
+	return 0, e.Err
+}
+
+func (e *errWriteCloser) Close() error {
+	return e.Err
+}
@@ -1,6 +1,8 @@
 package engines
 
 import (
+	"time"
+
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -83,6 +85,13 @@ type ResultSet interface {
 	// as a tar-stream. Ideally this also includes cache folders.
 	ArchiveSandbox() (ioext.ReadSeekCloser, error)
 
+	// ResourceUsage returns the resources consumed by the sandbox during
+	// execution. Engines may report -1 for values they cannot measure, or
+	// return ErrFeatureNotSupported if no values can be measured.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported
+	ResourceUsage() (ResourceUsage, error)
+
 	// Dispose shall release all resources.
 	//
 	// CacheFolders given to the sandbox shall not be disposed, instead they are
@@ -120,7 +129,37 @@ func (ResultSetBase) ArchiveSandbox() (ioext.ReadSeekCloser, error) {
 	return nil, ErrFeatureNotSupported
 }
 
+// ResourceUsage returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (ResultSetBase) ResourceUsage() (ResourceUsage, error) {
+	return ResourceUsage{}, ErrFeatureNotSupported
+}
+
 // Dispose returns nil indicating that resources have been released.
 func (ResultSetBase) Dispose() error {
 	return nil
 }
+
+// ResourceUsage is the resources consumed by a sandbox, as returned from
+// ResultSet.ResourceUsage(). Values that could not be measured are -1.
+type ResourceUsage struct {
+	CPUTime        time.Duration // CPU time spent in user and kernel mode
+	PeakMemory     int64         // Peak memory usage in bytes
+	DiskReadBytes  int64         // Bytes read from disk
+	DiskWriteBytes int64         // Bytes written to disk
+	NetworkRxBytes int64         // Bytes received over the network
+	NetworkTxBytes int64         // Bytes transmitted over the network
+}
+
+// NewResourceUsage returns a ResourceUsage with all values set to -1,
+// indicating that they could not be measured.
+func NewResourceUsage() ResourceUsage {
+	return ResourceUsage{
+		CPUTime:        -1,
+		PeakMemory:     -1,
+		DiskReadBytes:  -1,
+		DiskWriteBytes: -1,
+		NetworkRxBytes: -1,
+		NetworkTxBytes: -1,
+	}
+}
@@ -0,0 +1,66 @@
+package scriptengine
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+)
+
+// cacheNamePattern is the pattern cache names requested by the script must match
+var cacheNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,255}$`)
+
+// cacheOptions is the options passed to caching.Cache.Require() which then
+// passes it to engine.newCacheFolder. The JSON serialization is the cache key.
+type cacheOptions struct {
+	Name string `json:"name"`
+}
+
+// cacheFolder is a folder requested by the script over the control channel,
+// the folder is kept across tasks.
+type cacheFolder struct {
+	name   string
+	folder runtime.TemporaryFolder
+}
+
+func (c *cacheFolder) MemorySize() (uint64, error) {
+	return 0, caching.ErrDisposableSizeNotSupported
+}
+
+func (c *cacheFolder) DiskSize() (uint64, error) {
+	var size uint64
+	err := filepath.Walk(c.folder.Path(), func(_ string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += uint64(info.Size())
+		}
+		return err
+	})
+	return size, err
+}
+
+func (c *cacheFolder) Dispose() error {
+	return c.folder.Remove()
+}
+
+// cacheContext wraps TaskContext to satisfy the caching.Context interface
+type cacheContext struct {
+	*runtime.TaskContext
+}
+
+func (cacheContext) Progress(description string, percent float64) {
+	// Creating a cache folder is instant, so progress isn't reported
+}
+
+// newCacheFolder is the caching.Constructor for cacheFolder
+func (e *engine) newCacheFolder(ctx caching.Context, opts interface{}) (caching.Resource, error) {
+	options := opts.(cacheOptions) // this is called by Require which is always passed cacheOptions
+
+	folder, err := e.environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cache folder")
+	}
+	return &cacheFolder{name: options.Name, folder: folder}, nil
+}
@@ -5,9 +5,27 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
+// Proxy modes supported by the script engine
+const (
+	proxyModeNone     = "none"
+	proxyModeLoopback = "loopback"
+)
+
+// defaultGracePeriod is the number of seconds between SIGTERM and SIGKILL when
+// aborting a task, if not configured.
+const defaultGracePeriod = 30
+
+// proxyURLProperty is the property in the JSON given to the script over stdin
+// holding the URL for attached proxies.
+const proxyURLProperty = "proxyUrl"
+
 type configType struct {
-	Command []string `json:"command"`
-	Schema  struct {
+	Command        []string `json:"command"`
+	ControlChannel bool     `json:"controlChannel"`
+	Shell          []string `json:"shell"`
+	ProxyMode      string   `json:"proxyMode"`
+	GracePeriod    int      `json:"gracePeriod"`
+	Schema         struct {
 		Type       string                 `json:"type"`
 		Properties map[string]interface{} `json:"properties"`
 		Required   []string               `json:"required"`
@@ -48,6 +66,90 @@ var configSchema = schematypes.Object{
 			`),
 			Items: schematypes.String{},
 		},
+		"controlChannel": schematypes.Boolean{
+			Title: "Enable Control Channel",
+			Description: util.Markdown(`
+				Pass a structured control channel to the script. When enabled the
+				script is started with file descriptor '3' open for writing
+				newline-delimited JSON messages to the worker, and file descriptor
+				'4' open for reading replies. The file descriptor numbers are also
+				given in the environment variables 'TASKCLUSTER_CONTROL_FD' and
+				'TASKCLUSTER_CONTROL_REPLY_FD'.
+
+				Each message is a JSON object on a single line, with a 'type'
+				property and an optional 'id' property. If 'id' is given the worker
+				writes a reply '{"id": ..., "error": "...", "path": "..."}' to the
+				reply file descriptor, where 'error' is present if the message was
+				rejected, and 'path' is given for cache requests. Messages without
+				'id' get no reply, so scripts need not read replies. Supported
+				messages are:
+				 * '{"type": "artifact", "name": ..., "path": ..., "contentType": ..., "expires": ...}',
+				   upload the file at 'path', relative to the _working directory_,
+				   as artifact 'name' when the script exits, 'contentType' and
+				   'expires' are optional.
+				 * '{"type": "redirect-artifact", "name": ..., "url": ..., "contentType": ..., "expires": ...}',
+				   create a redirect artifact, 'contentType' and 'expires' are optional.
+				 * '{"type": "error-artifact", "name": ..., "message": ..., "reason": ..., "expires": ...}',
+				   create an error artifact, 'reason' is one of 'file-missing-on-worker',
+				   'invalid-resource-on-worker' or 'too-large-file-on-worker'.
+				 * '{"type": "progress", "message": ..., "percent": ...}', write a
+				   progress message to the task log, 'percent' is optional.
+				 * '{"type": "cache", "name": ...}', request a cache folder, the
+				   absolute 'path' of the folder is given in the reply. Caches are
+				   kept by the worker across tasks, but a cache is only used by one
+				   task at a time.
+				 * '{"type": "exception", "reason": ..., "message": ...}', resolve
+				   the task exception when the script exits, regardless of exit
+				   code unless it is '4', 'reason' is 'malformed-payload' or
+				   'internal-error'.
+
+				The 'expires' properties are RFC 3339 timestamps, and default to
+				task expiration.
+			`),
+		},
+		"shell": schematypes.Array{
+			Title: "Interactive Shell Command",
+			Description: util.Markdown(`
+				Command to execute when an interactive shell is requested without
+				specifying a command. Shells are executed in the same temporary
+				_working directory_ and with the same environment variables as the
+				script. If not given, interactive shells are not supported.
+			`),
+			Items: schematypes.String{},
+		},
+		"proxyMode": schematypes.StringEnum{
+			Title: "Proxy Mode",
+			Description: util.Markdown(`
+				How proxies attached by plugins are exposed to the script, defaults
+				to 'none' which doesn't support proxies.
+
+				If 'loopback' is given, proxies are served by an HTTP server on the
+				loopback device, and if any proxies are attached the URL is given to
+				the script as the 'proxyUrl' property in the JSON fed over 'stdin',
+				as well as the 'TASKCLUSTER_PROXY_URL' environment variable.
+				Requests to '<proxyUrl>/<name>/<path>' are forwarded to the proxy
+				attached as '<name>'. The URL contains a per-task secret and must
+				not be leaked. In this mode the payload schema cannot have a
+				'proxyUrl' property.
+			`),
+			Options: []string{proxyModeNone, proxyModeLoopback},
+		},
+		"gracePeriod": schematypes.Integer{
+			Title: "Termination Grace Period",
+			Description: util.Markdown(`
+				The script is executed in a new process group, when the task is
+				aborted 'SIGTERM' is sent to all processes in the process group.
+				If processes in the group are still running after 'gracePeriod'
+				seconds, 'SIGKILL' is sent to all processes in the group.
+				Defaults to 30 seconds.
+
+				Processes that are still running in the process group, when the
+				script exits are reported and killed, so that processes don't
+				leak between tasks.
+			`),
+			Minimum: 1,
+			Maximum: 3600,
+		},
 		"schema": schematypes.Object{
 			Title: "Payload Schema",
 			Description: util.Markdown(`
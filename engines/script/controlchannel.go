@@ -0,0 +1,367 @@
+package scriptengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+)
+
+const (
+	// File descriptors for the control channel in the script process, these are
+	// ExtraFiles[0] and ExtraFiles[1] as 0, 1, 2 are stdin, stdout and stderr.
+	controlFD      = 3
+	controlReplyFD = 4
+
+	// maxControlMessageSize is the maximum size of a single control message
+	maxControlMessageSize = 1024 * 1024
+
+	// controlDrainTimeout is the maximum time to wait for the control channel
+	// to be closed after the script has exited. Sub-processes of the script may
+	// have inherited the file descriptor and keep it open.
+	controlDrainTimeout = 5 * time.Second
+)
+
+// Error reasons permitted for error artifacts
+var errorArtifactReasons = []string{
+	"file-missing-on-worker",
+	"invalid-resource-on-worker",
+	"too-large-file-on-worker",
+}
+
+// controlMessage is a message from the script, fields not relevant for the
+// given Type are ignored.
+type controlMessage struct {
+	ID          interface{} `json:"id"`
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Path        string      `json:"path"`
+	URL         string      `json:"url"`
+	ContentType string      `json:"contentType"`
+	Expires     string      `json:"expires"`
+	Message     string      `json:"message"`
+	Reason      string      `json:"reason"`
+	Percent     *float64    `json:"percent"`
+}
+
+// controlReply is written to the reply file descriptor for messages with an id
+type controlReply struct {
+	ID    interface{} `json:"id"`
+	Error string      `json:"error,omitempty"`
+	Path  string      `json:"path,omitempty"`
+}
+
+// controlArtifact is an artifact declared over the control channel, to be
+// created when the script exits.
+type controlArtifact struct {
+	Kind        string // artifact, redirect-artifact or error-artifact
+	Name        string
+	Path        string // absolute path, for kind = artifact
+	URL         string
+	ContentType string
+	Message     string
+	Reason      string
+	Expires     time.Time
+}
+
+// controlChannel reads messages from the script and collects declared
+// artifacts, requested caches and exceptions.
+type controlChannel struct {
+	folder  string
+	context *runtime.TaskContext
+	monitor runtime.Monitor
+	caches  *caching.Cache
+
+	// Our ends of the pipes, and the ends passed to the script
+	messages     *os.File
+	replies      *os.File
+	scriptWriter *os.File
+	scriptReader *os.File
+
+	done      chan struct{}
+	drained   atomics.Bool // true, if we stopped reading after timeout
+	m         sync.Mutex
+	artifacts []controlArtifact
+	handles   []*caching.Handle
+	exception error
+}
+
+func newControlChannel(folder string, context *runtime.TaskContext, caches *caching.Cache, monitor runtime.Monitor) (*controlChannel, error) {
+	messages, scriptWriter, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create pipe for control channel")
+	}
+	scriptReader, replies, err := os.Pipe()
+	if err != nil {
+		messages.Close()
+		scriptWriter.Close()
+		return nil, errors.Wrap(err, "failed to create pipe for control channel replies")
+	}
+	return &controlChannel{
+		folder:       folder,
+		context:      context,
+		monitor:      monitor.WithPrefix("control-channel"),
+		caches:       caches,
+		messages:     messages,
+		replies:      replies,
+		scriptWriter: scriptWriter,
+		scriptReader: scriptReader,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+// ExtraFiles returns files to be passed to the script as exec.Cmd.ExtraFiles
+func (c *controlChannel) ExtraFiles() []*os.File {
+	return []*os.File{c.scriptWriter, c.scriptReader}
+}
+
+// Env returns environment variables to be given to the script
+func (c *controlChannel) Env() map[string]string {
+	return map[string]string{
+		"TASKCLUSTER_CONTROL_FD":       fmt.Sprintf("%d", controlFD),
+		"TASKCLUSTER_CONTROL_REPLY_FD": fmt.Sprintf("%d", controlReplyFD),
+	}
+}
+
+// Start reading messages, must be called after the script has been started,
+// as this closes the file descriptors passed to the script.
+func (c *controlChannel) Start() {
+	c.scriptWriter.Close()
+	c.scriptReader.Close()
+	go c.run()
+}
+
+// Close closes all file descriptors, this is only necessary if Start() isn't
+// called, because the script failed to start.
+func (c *controlChannel) Close() {
+	c.scriptWriter.Close()
+	c.scriptReader.Close()
+	c.messages.Close()
+	c.replies.Close()
+}
+
+// Wait for all messages to be read, must be called after the script exits.
+// If sub-processes keep the control channel open, we stop reading after
+// controlDrainTimeout.
+func (c *controlChannel) Wait() {
+	select {
+	case <-c.done:
+	case <-time.After(controlDrainTimeout):
+		c.context.LogError("Control channel wasn't closed when the script exited, ignoring further messages")
+		c.drained.Set(true)
+		c.messages.Close()
+		c.replies.Close() // unblocks writes, if the script isn't reading replies
+		<-c.done
+	}
+}
+
+// Artifacts returns artifacts declared over the control channel
+func (c *controlChannel) Artifacts() []controlArtifact {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]controlArtifact{}, c.artifacts...)
+}
+
+// Exception returns the error to resolve the task with, if the script has
+// sent an exception message.
+func (c *controlChannel) Exception() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.exception
+}
+
+// ReleaseCaches releases caches requested by the script, must be called after
+// the script has exited.
+func (c *controlChannel) ReleaseCaches() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, h := range c.handles {
+		h.Release()
+	}
+	c.handles = nil
+}
+
+func (c *controlChannel) run() {
+	defer close(c.done)
+	defer c.replies.Close()
+	defer c.messages.Close()
+
+	scanner := bufio.NewScanner(c.messages)
+	scanner.Buffer(make([]byte, 4096), maxControlMessageSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg controlMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			c.context.LogError("Invalid control message, error: ", err)
+			continue
+		}
+		path, err := c.handle(msg)
+		if err != nil {
+			c.context.LogError(fmt.Sprintf("Control message of type '%s' rejected: %s", msg.Type, err))
+		}
+		if msg.ID != nil {
+			reply := controlReply{ID: msg.ID, Path: path}
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			if err = c.reply(reply); err != nil {
+				debug("failed to write control channel reply, error: %s", err)
+			}
+		}
+	}
+	// Errors from closing the pipe in Wait() are expected, anything else is
+	// most likely a message that is too long, and we discard further messages,
+	// so that the script doesn't block writing to the control channel.
+	if err := scanner.Err(); err != nil && !c.drained.Get() {
+		c.context.LogError("Failed to read control channel, ignoring further messages, error: ", err)
+		io.Copy(ioutil.Discard, c.messages)
+	}
+}
+
+func (c *controlChannel) reply(reply controlReply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize control reply")) // should never happen
+	}
+	_, err = c.replies.Write(append(data, '\n'))
+	return err
+}
+
+// handle a message from the script, returns path for cache messages
+func (c *controlChannel) handle(msg controlMessage) (string, error) {
+	switch msg.Type {
+	case "artifact":
+		if msg.Path == "" {
+			return "", errors.New("'path' is required")
+		}
+		p := filepath.Join(c.folder, filepath.FromSlash(msg.Path))
+		if !strings.HasPrefix(p, filepath.Clean(c.folder)+string(filepath.Separator)) {
+			return "", fmt.Errorf("'path': '%s' is outside the working directory", msg.Path)
+		}
+		return "", c.addArtifact(msg, controlArtifact{Path: p})
+	case "redirect-artifact":
+		if msg.URL == "" {
+			return "", errors.New("'url' is required")
+		}
+		return "", c.addArtifact(msg, controlArtifact{URL: msg.URL})
+	case "error-artifact":
+		if !stringContains(errorArtifactReasons, msg.Reason) {
+			return "", fmt.Errorf("'reason' must be one of: %s", strings.Join(errorArtifactReasons, ", "))
+		}
+		return "", c.addArtifact(msg, controlArtifact{Message: msg.Message, Reason: msg.Reason})
+	case "progress":
+		if msg.Percent != nil {
+			c.context.Log(fmt.Sprintf("[progress] %.0f%% %s", *msg.Percent, msg.Message))
+		} else {
+			c.context.Log("[progress] ", msg.Message)
+		}
+		return "", nil
+	case "cache":
+		return c.requireCache(msg.Name)
+	case "exception":
+		return "", c.setException(msg.Reason, msg.Message)
+	default:
+		return "", fmt.Errorf("unknown message type: '%s'", msg.Type)
+	}
+}
+
+func (c *controlChannel) addArtifact(msg controlMessage, a controlArtifact) error {
+	if msg.Name == "" {
+		return errors.New("'name' is required")
+	}
+	a.Kind = msg.Type
+	a.Name = msg.Name
+	a.ContentType = msg.ContentType
+	a.Expires = c.context.Expires
+	if msg.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, msg.Expires)
+		if err != nil {
+			return fmt.Errorf("'expires' must be an RFC 3339 timestamp, error: %s", err)
+		}
+		if expires.After(c.context.Expires) {
+			return errors.New("'expires' cannot be after task expiration")
+		}
+		a.Expires = expires
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, existing := range c.artifacts {
+		if existing.Name == a.Name {
+			return fmt.Errorf("artifact '%s' has already been declared", a.Name)
+		}
+	}
+	c.artifacts = append(c.artifacts, a)
+	return nil
+}
+
+func (c *controlChannel) setException(reason, message string) error {
+	var err error
+	switch reason {
+	case "malformed-payload":
+		err = runtime.NewMalformedPayloadError(message)
+	case "internal-error":
+		err = runtime.ErrNonFatalInternalError
+	default:
+		return errors.New("'reason' must be 'malformed-payload' or 'internal-error'")
+	}
+	c.context.LogError(fmt.Sprintf("Script reported exception '%s': %s", reason, message))
+	if reason == "internal-error" {
+		c.monitor.Warn("script reported internal-error: ", message)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.exception = err
+	return nil
+}
+
+func (c *controlChannel) requireCache(name string) (string, error) {
+	if !cacheNamePattern.MatchString(name) {
+		return "", fmt.Errorf("'name' must match: %s", cacheNamePattern.String())
+	}
+
+	c.m.Lock()
+	for _, h := range c.handles {
+		if h.Resource().(*cacheFolder).name == name {
+			c.m.Unlock()
+			return h.Resource().(*cacheFolder).folder.Path(), nil
+		}
+	}
+	c.m.Unlock()
+
+	handle, err := c.caches.Require(cacheContext{c.context}, cacheOptions{Name: name})
+	if err != nil {
+		c.monitor.ReportError(err, "failed to create cache folder")
+		return "", errors.New("internal error creating cache folder")
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.handles = append(c.handles, handle)
+	return handle.Resource().(*cacheFolder).folder.Path(), nil
+}
+
+// stringContains returns true, if list contains s
+func stringContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
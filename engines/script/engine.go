@@ -2,10 +2,12 @@ package scriptengine
 
 import (
 	"fmt"
+	"net/http"
 
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
 )
 
 type engineProvider struct {
@@ -18,6 +20,7 @@ type engine struct {
 	config      configType
 	schema      schematypes.Object
 	environment *runtime.Environment
+	caches      *caching.Cache
 }
 
 func init() {
@@ -32,6 +35,16 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 	var config configType
 	schematypes.MustValidateAndMap(configSchema, options.Config, &config)
 
+	if config.GracePeriod == 0 {
+		config.GracePeriod = defaultGracePeriod
+	}
+	if config.ProxyMode == "" {
+		config.ProxyMode = proxyModeNone
+	}
+	if _, ok := config.Schema.Properties[proxyURLProperty]; ok && config.ProxyMode == proxyModeLoopback {
+		return nil, fmt.Errorf("schema cannot have property '%s' when proxyMode is '%s'", proxyURLProperty, proxyModeLoopback)
+	}
+
 	// Construct payload schema as schematypes.Object using schema.properties
 	properties := schematypes.Properties{}
 	for k, s := range config.Schema.Properties {
@@ -42,14 +55,17 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 		properties[k] = schema
 	}
 
-	return &engine{
+	e := &engine{
 		monitor: options.Monitor,
 		config:  config,
 		schema: schematypes.Object{
 			Properties: properties,
 		},
 		environment: options.Environment,
-	}, nil
+	}
+	// Caches requested over the control channel are exclusive to one task
+	e.caches = caching.New(e.newCacheFolder, false, options.Environment.GarbageCollector, options.Monitor.WithPrefix("caches"))
+	return e, nil
 }
 
 func (e *engine) PayloadSchema() schematypes.Object {
@@ -63,6 +79,7 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 		payload: options.Payload,
 		engine:  e,
 		context: options.TaskContext,
+		proxies: make(map[string]http.Handler),
 		monitor: options.Monitor,
 	}, nil
 }
@@ -1,9 +1,24 @@
 package scriptengine
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	t "testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/tcqueue"
+	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
 )
 
 var provider = &enginetest.EngineProvider{
@@ -66,3 +81,208 @@ func TestStderrPrefixing(t *t.T) {
     }`,
 	}).Test()
 }
+
+func TestControlChannelProgress(t *t.T) {
+	(&enginetest.LoggingTestCase{
+		EngineProvider: &enginetest.EngineProvider{
+			Engine: "script",
+			Config: `{
+        "command": ["bash", "-ec", "v=$(cat); echo \"$v\" | grep hello-world > /dev/null && echo '{\"type\": \"progress\", \"message\": \"half-way\", \"percent\": 50}' >&$TASKCLUSTER_CONTROL_FD; echo \"$v\" | grep success > /dev/null"],
+        "controlChannel": true,
+          "schema": {
+            "type": "object",
+            "properties": {
+              "arg": {"type": "string"}
+            },
+            "required": ["arg"]
+          }
+      }`,
+		},
+		Target: "[progress] 50% half-way",
+		TargetPayload: `{
+      "arg": "hello-world, this is a successful task"
+    }`,
+		FailingPayload: `{
+      "arg": "hello-world, this is a failing task"
+    }`,
+		SilentPayload: `{
+      "arg": "This is a successful task, that doesn't log target string"
+    }`,
+	}).Test()
+}
+
+func TestShell(t *t.T) {
+	c := enginetest.ShellTestCase{
+		EngineProvider: &enginetest.EngineProvider{
+			Engine: "script",
+			Config: `{
+        "command": ["bash", "-ec", "cat > /dev/null; sleep 1"],
+        "shell": ["sh"],
+          "schema": {
+            "type": "object",
+            "properties": {},
+            "required": []
+          }
+      }`,
+		},
+		Command:      "echo \"hello $TASK_ID\" | cut -c 1-5;\n",
+		Stdout:       "hello\n",
+		Stderr:       "",
+		BadCommand:   "exit 1;\n",
+		SleepCommand: "sleep 30;\n",
+		Payload:      `{}`, // sleep in script, sandbox doesn't terminate before shell is started
+	}
+
+	c.TestCommand()
+	c.Test()
+}
+
+func TestAttachProxy(t *t.T) {
+	c := enginetest.ProxyTestCase{
+		EngineProvider: &enginetest.EngineProvider{
+			Engine: "script",
+			Config: `{
+        "command": ["bash", "-ec", "cat > /dev/null; echo 'Pinging'; STATUS=$(curl -s -o output.txt -w '%{http_code}' \"$TASKCLUSTER_PROXY_URL/test-proxy/v1/ping\"); cat output.txt; test $STATUS -eq 200;"],
+        "proxyMode": "loopback",
+          "schema": {
+            "type": "object",
+            "properties": {},
+            "required": []
+          }
+      }`,
+		},
+		ProxyName:        "test-proxy",
+		PingProxyPayload: `{}`,
+	}
+
+	c.TestPingProxyPayload()
+	c.TestPing404IsUnsuccessful()
+	c.TestLiveLogging()
+	c.TestParallelPings()
+	c.Test()
+}
+
+func TestKill(t *t.T) {
+	enginetest.KillTestCase{
+		EngineProvider: &enginetest.EngineProvider{
+			Engine: "script",
+			Config: `{
+        "command": ["bash", "-ec", "cat > /dev/null; echo 'Sleeping'; sleep 60 & sleep 60"],
+          "schema": {
+            "type": "object",
+            "properties": {},
+            "required": []
+          }
+      }`,
+		},
+		Target:  "Sleeping",
+		Payload: `{}`,
+	}.Test()
+}
+
+// newTestTask creates a script engine from config and a TaskContext for a
+// task, call the returned function to dispose them.
+func newTestTask(t *t.T, config string) (engines.Engine, *runtime.TaskContext, *runtime.TaskContextController, func()) {
+	storage, err := runtime.NewTemporaryStorage(os.TempDir())
+	require.NoError(t, err)
+	folder, err := storage.NewFolder()
+	require.NoError(t, err)
+
+	var c interface{}
+	require.NoError(t, json.Unmarshal([]byte(config), &c))
+	engine, err := engineProvider{}.NewEngine(engines.EngineOptions{
+		Environment: &runtime.Environment{
+			GarbageCollector: &gc.GarbageCollector{},
+			TemporaryStorage: folder,
+			Monitor:          mocks.NewMockMonitor(true),
+		},
+		Monitor: mocks.NewMockMonitor(true),
+		Config:  c,
+	})
+	require.NoError(t, err)
+
+	ctx, control, err := runtime.NewTaskContext(folder.NewFilePath(), runtime.TaskInfo{
+		TaskID:  slugid.Nice(),
+		Expires: time.Now().Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	return engine, ctx, control, func() {
+		control.Dispose()
+		engine.Dispose()
+		folder.Remove()
+	}
+}
+
+// runTestSandbox runs a sandbox with an empty payload and returns the result
+func runTestSandbox(t *t.T, engine engines.Engine, ctx *runtime.TaskContext) engines.ResultSet {
+	sandboxBuilder, err := engine.NewSandboxBuilder(engines.SandboxOptions{
+		TaskContext: ctx,
+		Payload:     map[string]interface{}{},
+		Monitor:     mocks.NewMockMonitor(true),
+	})
+	require.NoError(t, err)
+	sandbox, err := sandboxBuilder.StartSandbox()
+	require.NoError(t, err)
+	result, err := sandbox.WaitForResult()
+	require.NoError(t, err)
+	return result
+}
+
+func TestArtifactUpload(t *t.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client.")
+	}))
+	defer ts.Close()
+
+	engine, ctx, control, dispose := newTestTask(t, `{
+		"command": ["bash", "-ec", "cat > /dev/null; mkdir -p artifacts/public; echo 'hello' > artifacts/public/hello.txt"],
+		"schema": {
+			"type": "object",
+			"properties": {},
+			"required": []
+		}
+	}`)
+	defer dispose()
+
+	s3resp, _ := json.Marshal(tcqueue.S3ArtifactResponse{
+		PutURL: ts.URL,
+	})
+	resp := tcqueue.PostArtifactResponse(s3resp)
+	mockedQueue := &client.MockQueue{}
+	mockedQueue.On(
+		"CreateArtifact",
+		ctx.TaskID,
+		"0",
+		"public/hello.txt",
+		client.PostS3ArtifactRequest,
+	).Return(&resp, nil)
+	control.SetQueueClient(mockedQueue)
+
+	result := runTestSandbox(t, engine, ctx)
+	defer result.Dispose()
+
+	assert.True(t, result.Success(), "expected task to succeed after uploading artifact")
+	mockedQueue.AssertExpectations(t)
+}
+
+func TestBackgroundProcessOutlivesScript(t *t.T) {
+	engine, ctx, _, dispose := newTestTask(t, `{
+		"command": ["bash", "-ec", "cat > /dev/null; echo 'Sleeping'; sleep 600 & exit 0"],
+		"schema": {
+			"type": "object",
+			"properties": {},
+			"required": []
+		}
+	}`)
+	defer dispose()
+
+	// Task should resolve when the script exits, not when the background
+	// process exits, as it is killed.
+	start := time.Now()
+	result := runTestSandbox(t, engine, ctx)
+	defer result.Dispose()
+
+	assert.True(t, result.Success(), "expected task to succeed")
+	assert.True(t, time.Since(start) < 60*time.Second, "expected background process to be killed")
+}
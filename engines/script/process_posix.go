@@ -0,0 +1,43 @@
+// +build !windows
+
+package scriptengine
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures cmd to run in a new session, and thus in a new
+// process group, such that the script and all sub-processes can be signaled.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to all processes in the process group
+// led by pid.
+func terminateProcessGroup(pid int) error {
+	return signalProcessGroup(pid, syscall.SIGTERM)
+}
+
+// killProcessGroup sends SIGKILL to all processes in the process group led
+// by pid.
+func killProcessGroup(pid int) error {
+	return signalProcessGroup(pid, syscall.SIGKILL)
+}
+
+// processGroupAlive returns true, if there are processes in the process group
+// led by pid.
+func processGroupAlive(pid int) bool {
+	err := syscall.Kill(-pid, syscall.Signal(0))
+	// EPERM means there are processes we can't signal, which would be odd
+	return err == nil || err == syscall.EPERM
+}
+
+func signalProcessGroup(pid int, sig syscall.Signal) error {
+	err := syscall.Kill(-pid, sig)
+	// ESRCH means the process group is empty
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+// +build windows
+
+package scriptengine
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures cmd to run in a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// terminateProcessGroup kills the process pid, as windows has no equivalent of
+// SIGTERM for processes without a console.
+//
+// TODO: Terminate the entire process tree, and do so gracefully.
+func terminateProcessGroup(pid int) error {
+	return killProcessGroup(pid)
+}
+
+// killProcessGroup kills the process pid.
+//
+// TODO: Kill the entire process tree, see native engine KillProcessTree.
+func killProcessGroup(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil // process doesn't exist
+	}
+	return p.Kill()
+}
+
+// processGroupAlive always returns false on windows, as we can't list the
+// processes in a process group.
+func processGroupAlive(pid int) bool {
+	return false
+}
@@ -1,21 +1,30 @@
 package scriptengine
 
 import (
+	"fmt"
 	"io"
 	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/goware/prefixer"
+	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/loopbackproxy"
 )
 
 const artifactFolder = "artifacts"
 
+// processPollInterval is the interval at which we check if processes in the
+// process group have terminated, while waiting for the grace period.
+const processPollInterval = 100 * time.Millisecond
+
 type sandbox struct {
 	engines.SandboxBase
 	context     *runtime.TaskContext
@@ -23,6 +32,12 @@ type sandbox struct {
 	cmd         *exec.Cmd
 	stderr      io.Reader
 	folder      runtime.TemporaryFolder
+	env         map[string]string
+	control     *controlChannel       // nil, if control channel isn't enabled
+	proxyServer *loopbackproxy.Server // nil, if no proxies are attached
+	mShells     sync.Mutex
+	shells      []*shell
+	sessions    atomics.WaitGroup
 	resolve     atomics.Once
 	resultSet   engines.ResultSet
 	resultError error
@@ -33,14 +48,29 @@ type sandbox struct {
 }
 
 func (s *sandbox) run() {
-	// Read stderr to task log before we wait for exit code
-	io.Copy(s.context.LogDrain(), prefixer.New(s.stderr, "[worker:error] "))
-	err := s.cmd.Wait()
+	// Read stderr to task log while the script is running
+	stderrDone := make(chan struct{})
+	go func() {
+		io.Copy(s.context.LogDrain(), prefixer.New(s.stderr, "[worker:error] "))
+		close(stderrDone)
+	}()
+
+	// Wait for the script to exit, we can't use s.cmd.Wait() as it also waits
+	// for stdout and stderr to be closed, which processes left running by the
+	// script may hold open.
+	state, err := s.cmd.Process.Wait()
+	if err == nil && !state.Success() {
+		err = &exec.ExitError{ProcessState: state}
+	}
 
 	success := err == nil
 	var resultError error
 	if e, ok := err.(*exec.ExitError); ok {
-		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// script was terminated by a signal, from Kill() or Abort(), this is
+			// considered a failure
+			debug("script terminated by signal: %s", status.Signal())
+		} else if ok {
 			switch status.ExitStatus() {
 			case 0:
 				// this shouldn't be possible...
@@ -66,6 +96,28 @@ func (s *sandbox) run() {
 		s.monitor.Error("Script execution failed, error: ", err)
 	}
 
+	// Kill processes left behind by the script, so they don't leak between tasks
+	s.killStragglers()
+
+	// Wait for output to be drained, and release resources held by s.cmd, the
+	// error is ignored as we have already waited for the process.
+	<-stderrDone
+	_ = s.cmd.Wait()
+
+	// Wait for messages on the control channel, exceptions reported by the
+	// script take precedence over exit codes, unless the exit code is fatal.
+	if s.control != nil {
+		s.control.Wait()
+		if exception := s.control.Exception(); exception != nil && resultError != runtime.ErrFatalInternalError {
+			resultError = exception
+		}
+	}
+
+	// Wait for all shells to finish and prevent new shells from being created,
+	// as shells may also produce artifacts.
+	s.sessions.WaitAndDrain()
+	debug("All shells terminated")
+
 	// Upload artifacts if not aborted
 	if !s.aborted.Get() {
 		err2 := s.uploadArtifacts()
@@ -77,6 +129,12 @@ func (s *sandbox) run() {
 	} else {
 		success = false
 	}
+	if s.control != nil {
+		s.control.ReleaseCaches()
+	}
+	if s.proxyServer != nil {
+		s.proxyServer.Stop()
+	}
 	close(s.done)
 
 	s.resolve.Do(func() {
@@ -96,11 +154,125 @@ func (s *sandbox) run() {
 }
 
 func (s *sandbox) Kill() error {
-	// TODO: Implement termination of all subprocesses
-	_ = s.cmd.Process.Kill()
+	// Discard error as we're racing with termination
+	_ = killProcessGroup(s.cmd.Process.Pid)
+
+	// Abort all shells
+	s.abortShells()
 	return nil
 }
 
+// terminate sends SIGTERM to the process group of the script, and SIGKILL if
+// processes are still running after the configured grace period.
+func (s *sandbox) terminate() {
+	pid := s.cmd.Process.Pid
+	// Discard errors as we're racing with termination
+	_ = terminateProcessGroup(pid)
+
+	deadline := time.Now().Add(time.Duration(s.engine.config.GracePeriod) * time.Second)
+	for processGroupAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(processPollInterval)
+	}
+
+	_ = killProcessGroup(pid)
+}
+
+// killStragglers reports and kills processes left in the process group after
+// the script has exited. Stragglers aren't reported if the task is aborted,
+// as they are being terminated.
+func (s *sandbox) killStragglers() {
+	pid := s.cmd.Process.Pid
+	if s.aborted.Get() || !processGroupAlive(pid) {
+		return
+	}
+	s.context.LogError("Processes left running after the script exited will be killed")
+	s.monitor.ReportWarning(errors.New("processes left running in process group after script exited"),
+		"script leaked processes, pid: ", pid)
+	if err := killProcessGroup(pid); err != nil {
+		s.monitor.ReportError(err, "failed to kill processes left by script")
+	}
+}
+
+func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
+	// Interactive shells are only supported, if configured
+	if len(s.engine.config.Shell) == 0 {
+		return nil, engines.ErrFeatureNotSupported
+	}
+	if len(command) == 0 {
+		command = s.engine.config.Shell
+	}
+
+	s.mShells.Lock()
+	defer s.mShells.Unlock()
+
+	// Increment shell counter, if draining we don't allow new shells
+	if s.sessions.Add(1) != nil {
+		if s.aborted.Get() {
+			return nil, engines.ErrSandboxAborted
+		}
+		return nil, engines.ErrSandboxTerminated
+	}
+
+	debug("NewShell with: %v", command)
+	S, err := newShell(s, command, tty)
+	if err != nil {
+		debug("Failed to start shell, error: %s", err)
+		s.sessions.Done()
+		if err == engines.ErrFeatureNotSupported {
+			return nil, err
+		}
+		return nil, runtime.NewMalformedPayloadError(
+			"Unable to spawn command: ", command, " error: ", err,
+		)
+	}
+
+	// Add shells to list
+	s.shells = append(s.shells, S)
+
+	// Wait for the S to be done and decrement WaitGroup
+	go func() {
+		result, _ := S.Wait()
+		debug("Shell finished with: %v", result)
+
+		s.mShells.Lock()
+		defer s.mShells.Unlock()
+
+		// remove S from s.shells
+		shells := make([]*shell, 0, len(s.shells))
+		for _, s2 := range s.shells {
+			if s2 != S {
+				shells = append(shells, s2)
+			}
+		}
+		s.shells = shells
+
+		// Mark as done
+		s.sessions.Done()
+	}()
+
+	return S, nil
+}
+
+// abortShells prevents new shells and aborts all existing shells
+func (s *sandbox) abortShells() {
+	s.mShells.Lock()
+
+	// Prevent new shells
+	s.sessions.Drain()
+
+	// Abort all shells
+	for _, S := range s.shells {
+		go S.Abort()
+	}
+	s.shells = nil
+
+	// can't hold lock while waiting for session to finish
+	s.mShells.Unlock()
+
+	// Wait for all shells to be done
+	s.sessions.Wait()
+}
+
 func (s *sandbox) WaitForResult() (engines.ResultSet, error) {
 	s.resolve.Wait()
 	return s.resultSet, s.resultError
@@ -111,8 +283,11 @@ func (s *sandbox) Abort() error {
 		// Abort artifact upload
 		s.aborted.Set(true)
 
-		// Discard error from Kill() as we're racing with termination
-		_ = s.cmd.Process.Kill()
+		// Terminate the script and all sub-processes
+		s.terminate()
+
+		// Abort all shells
+		s.abortShells()
 
 		// Wait for artifact upload to be aborted
 		<-s.done
@@ -129,49 +304,104 @@ func (s *sandbox) Abort() error {
 }
 
 func (s *sandbox) uploadArtifacts() error {
+	var err error
+
+	// Create artifacts declared over the control channel
+	declared := map[string]bool{}
+	if s.control != nil {
+		for _, a := range s.control.Artifacts() {
+			if a.Path != "" {
+				declared[a.Path] = true
+			}
+			if aerr := s.createArtifact(a); aerr != nil && err == nil {
+				err = aerr
+			}
+		}
+	}
+
 	folder := filepath.Join(s.folder.Path(), artifactFolder)
-	return filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
+	werr := filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
 		// Abort if there is an error
 		if err != nil {
 			return err
 		}
 
-		// Skip folders
-		if info.IsDir() {
+		// Skip folders, and files declared over the control channel
+		if info.IsDir() || declared[p] {
 			return nil
 		}
 
-		// Guess mimetype
-		mimeType := mime.TypeByExtension(filepath.Ext(p))
-		if mimeType == "" {
-			// application/octet-stream is the mime type for "unknown"
-			mimeType = "application/octet-stream"
-		}
-
-		// Open file
-		f, err := os.Open(p)
-		if err != nil {
-			return err
-		}
-
 		// Find filename
 		name, _ := filepath.Rel(folder, p)
 
-		// Upload artifact
-		err = s.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     filepath.ToSlash(name),
-			Mimetype: mimeType,
-			Expires:  s.context.Expires, // use task expiration
-			Stream:   f,
-		})
+		return s.uploadFile(filepath.ToSlash(name), p, "", s.context.Expires) // use task expiration
+	})
+	if err == nil {
+		err = werr
+	}
+	return err
+}
 
-		// Ensure that we close the file
-		cerr := f.Close()
+// createArtifact creates an artifact declared over the control channel
+func (s *sandbox) createArtifact(a controlArtifact) error {
+	switch a.Kind {
+	case "redirect-artifact":
+		return s.context.CreateRedirectArtifact(runtime.RedirectArtifact{
+			Name:     a.Name,
+			Mimetype: a.ContentType,
+			URL:      a.URL,
+			Expires:  a.Expires,
+		})
+	case "error-artifact":
+		return s.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Message: a.Message,
+			Reason:  a.Reason,
+			Expires: a.Expires,
+		})
+	}
 
-		// Return first error, if any
-		if err != nil {
-			err = cerr
+	// Declared files that don't exist are uploaded as error artifacts
+	info, err := os.Stat(a.Path)
+	if err != nil || !info.Mode().IsRegular() {
+		s.context.LogError(fmt.Sprintf("Artifact '%s' declared by script is not a file", a.Name))
+		err = s.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Message: "Artifact declared by script is not a file",
+			Reason:  "file-missing-on-worker",
+			Expires: a.Expires,
+		})
+		if err == nil {
+			err = fmt.Errorf("artifact '%s' declared by script is not a file", a.Name)
 		}
 		return err
+	}
+	return s.uploadFile(a.Name, a.Path, a.ContentType, a.Expires)
+}
+
+// uploadFile uploads the file p as artifact called name, guessing mimeType
+// from the file extension if not given.
+func (s *sandbox) uploadFile(name, p, mimeType string, expires time.Time) error {
+	// Guess mimetype
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(p))
+	}
+	if mimeType == "" {
+		// application/octet-stream is the mime type for "unknown"
+		mimeType = "application/octet-stream"
+	}
+
+	// Open file
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	// Upload artifact, this closes the file
+	return s.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     name,
+		Mimetype: mimeType,
+		Expires:  expires,
+		Stream:   f,
 	})
 }
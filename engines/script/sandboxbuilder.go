@@ -4,26 +4,63 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/loopbackproxy"
 )
 
+// proxyNamePattern is the pattern hostnames given to AttachProxy must match
+var proxyNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
 type sandboxBuilder struct {
 	engines.SandboxBuilderBase
+	m       sync.Mutex
 	payload map[string]interface{}
 	engine  *engine
 	context *runtime.TaskContext
+	proxies map[string]http.Handler
 	monitor runtime.Monitor
 }
 
+func (b *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
+	if b.engine.config.ProxyMode != proxyModeLoopback {
+		return engines.ErrFeatureNotSupported
+	}
+
+	// Validate hostname against allowed patterns
+	if !proxyNamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError("Proxy hostname: '", hostname, "'",
+			" is not allowed for script engine. The hostname must match: ",
+			proxyNamePattern.String())
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Check that the hostname isn't already in use
+	if _, ok := b.proxies[hostname]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	b.proxies[hostname] = handler
+	return nil
+}
+
 func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
 	script := b.engine.config.Command
 	cmd := exec.Command(script[0], script[1:]...)
+	setProcessGroup(cmd)
 	folder, err := b.engine.environment.TemporaryStorage.NewFolder()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating temporary folder")
@@ -32,7 +69,32 @@ func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create artifact folder")
 	}
-	data, err := json.Marshal(b.payload)
+
+	env := map[string]string{
+		"TASK_ID": b.context.TaskID,
+		"RUN_ID":  fmt.Sprintf("%d", b.context.RunID),
+	}
+
+	// Start proxy server, if proxies are attached, the URL is given in the
+	// JSON fed to the script, and as environment variable
+	payload := b.payload
+	var proxies *loopbackproxy.Server
+	if len(b.proxies) > 0 {
+		proxies, err = loopbackproxy.New(b.proxies, b.context)
+		if err != nil {
+			folder.Remove()
+			b.monitor.ReportError(err, "failed to start proxy server for task")
+			return nil, runtime.ErrNonFatalInternalError
+		}
+		payload = make(map[string]interface{}, len(b.payload)+1)
+		for k, v := range b.payload {
+			payload[k] = v
+		}
+		payload[proxyURLProperty] = proxies.URL()
+		env[loopbackproxy.EnvVar] = proxies.URL()
+	}
+
+	data, err := json.Marshal(payload)
 	if err != nil {
 		panic(errors.Wrap(err, "Error serializing json payload"))
 	}
@@ -44,22 +106,48 @@ func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 	if err != nil {
 		panic(errors.Wrap(err, "failed to created cmd.StderrPipe()")) // should never happen
 	}
-	cmd.Env = formatEnv(map[string]string{
-		"TASK_ID": b.context.TaskID,
-		"RUN_ID":  fmt.Sprintf("%d", b.context.RunID),
-	})
+
+	// Setup control channel, if enabled
+	var control *controlChannel
+	if b.engine.config.ControlChannel {
+		control, err = newControlChannel(folder.Path(), b.context, b.engine.caches, b.monitor)
+		if err != nil {
+			if proxies != nil {
+				proxies.Stop()
+			}
+			folder.Remove()
+			return nil, err
+		}
+		cmd.ExtraFiles = control.ExtraFiles()
+		for k, v := range control.Env() {
+			env[k] = v
+		}
+	}
+	cmd.Env = formatEnv(env)
 
 	if err := cmd.Start(); err != nil {
+		if control != nil {
+			control.Close()
+		}
+		if proxies != nil {
+			proxies.Stop()
+		}
 		return nil, errors.Wrap(err, "Internal error invalid script")
 	}
+	if control != nil {
+		control.Start()
+	}
 	s := &sandbox{
-		cmd:     cmd,
-		stderr:  stderr,
-		folder:  folder,
-		monitor: b.monitor,
-		context: b.context,
-		engine:  b.engine,
-		done:    make(chan struct{}),
+		cmd:         cmd,
+		stderr:      stderr,
+		folder:      folder,
+		env:         env,
+		control:     control,
+		proxyServer: proxies,
+		monitor:     b.monitor,
+		context:     b.context,
+		engine:      b.engine,
+		done:        make(chan struct{}),
 	}
 	go s.run()
 	return s, nil
@@ -0,0 +1,134 @@
+package scriptengine
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins/interactive/pty"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+type shell struct {
+	cmd        *exec.Cmd
+	pty        *pty.PTY // nil, if not a TTY
+	stdin      io.WriteCloser
+	stdout     io.ReadCloser
+	stderr     io.ReadCloser
+	resolve    atomics.Once // Guarding result, resultErr and abortErr
+	result     bool
+	resultErr  error
+	abortErr   error
+	aborted    atomics.Bool
+	terminated atomics.Bool
+}
+
+func newShell(s *sandbox, command []string, tty bool) (*shell, error) {
+	if tty && !pty.Supported {
+		return nil, engines.ErrFeatureNotSupported
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = s.folder.Path()
+	cmd.Env = formatEnv(s.env)
+
+	S := &shell{cmd: cmd}
+	if tty {
+		// When doing a TTY stdout and stderr are merged, so stderr just becomes an
+		// empty stream as far as client is aware
+		p, err := pty.Start(cmd)
+		if err != nil {
+			return nil, err
+		}
+		S.pty = p
+		S.stdin = p
+		S.stdout = ioutil.NopCloser(p)
+		S.stderr = ioutil.NopCloser(bytes.NewBuffer(nil))
+	} else {
+		var err error
+		if S.stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, errors.Wrap(err, "failed to create stdin pipe")
+		}
+		// We don't use StdoutPipe() and StderrPipe() as cmd.Wait() closes them,
+		// before the reader has consumed all data.
+		var stdout, stderr io.WriteCloser
+		S.stdout, stdout = io.Pipe()
+		S.stderr, stderr = io.Pipe()
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err = cmd.Start(); err != nil {
+			return nil, err
+		}
+	}
+
+	go S.waitForResult()
+
+	return S, nil
+}
+
+func (s *shell) waitForResult() {
+	// wait for process to terminate
+	err := s.cmd.Wait()
+	debug("shell done, error: %v", err)
+
+	// Close output streams, so readers get EOF
+	if s.pty != nil {
+		s.pty.Close()
+	} else {
+		s.cmd.Stdout.(io.Closer).Close()
+		s.cmd.Stderr.(io.Closer).Close()
+	}
+
+	s.resolve.Do(func() {
+		s.terminated.Set(true)
+		s.result = err == nil
+		s.abortErr = engines.ErrShellTerminated
+	})
+}
+
+func (s *shell) StdinPipe() io.WriteCloser {
+	return s.stdin
+}
+
+func (s *shell) StdoutPipe() io.ReadCloser {
+	return s.stdout
+}
+
+func (s *shell) StderrPipe() io.ReadCloser {
+	return s.stderr
+}
+
+func (s *shell) SetSize(columns, rows uint16) error {
+	// Best effort check if we've terminated
+	if s.aborted.Get() {
+		return engines.ErrShellAborted
+	}
+	if s.terminated.Get() {
+		return engines.ErrShellTerminated
+	}
+	// Feature not supported if not tty
+	if s.pty == nil {
+		return engines.ErrFeatureNotSupported
+	}
+	return s.pty.SetSize(columns, rows)
+}
+
+func (s *shell) Abort() error {
+	s.resolve.Do(func() {
+		s.aborted.Set(true)
+		s.terminated.Set(true)
+		// Discard error from Kill() as we're racing with termination
+		_ = s.cmd.Process.Kill()
+		s.resultErr = engines.ErrShellAborted
+	})
+	s.resolve.Wait()
+	return s.abortErr
+}
+
+func (s *shell) Wait() (bool, error) {
+	s.resolve.Wait()
+	return s.result, s.resultErr
+}
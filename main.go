@@ -27,6 +27,7 @@ import (
 
 	_ "github.com/taskcluster/taskcluster-worker/commands/daemon"
 	_ "github.com/taskcluster/taskcluster-worker/commands/help"
+	_ "github.com/taskcluster/taskcluster-worker/commands/incidents"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-build"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-guest-tools"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-run"
@@ -57,6 +58,7 @@ import (
 	_ "github.com/taskcluster/taskcluster-worker/plugins/plugintest"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/reboot"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/relengapi"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/resourceusage"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/tasklog"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/tcproxy"
@@ -2,7 +2,6 @@ package artifacts
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -41,8 +40,10 @@ type pluginProvider struct {
 
 type plugin struct {
 	plugins.PluginBase
-	environment *runtime.Environment
-	privateKey  *openpgp.Entity // nil, if COT is disabled
+	environment   *runtime.Environment
+	privateKey    *openpgp.Entity // nil, if COT is disabled
+	maxTotalSize  int64           // zero, if unlimited
+	blobArtifacts bool            // if true, upload blob artifacts instead of s3
 }
 
 type taskPlugin struct {
@@ -52,8 +53,10 @@ type taskPlugin struct {
 	artifacts    []artifact
 	createCOT    bool
 	certifiedLog bool
-	uploaded     map[string][]byte // Map from artifact to sha256 hash
+	uploaded     map[string]string // Map from artifact to hex encoded sha256 hash
 	mUploaded    sync.Mutex
+	totalSize    int64      // Total size of artifacts uploaded
+	mTotalSize   sync.Mutex // Guards totalSize
 	monitor      runtime.Monitor
 	failed       atomics.Bool                     // If true, Stopped() returns false
 	mErrors      sync.Mutex                       // Guards errors
@@ -87,8 +90,10 @@ func (pluginProvider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin,
 	}
 
 	return &plugin{
-		environment: options.Environment,
-		privateKey:  key,
+		environment:   options.Environment,
+		privateKey:    key,
+		maxTotalSize:  c.MaxTotalSize,
+		blobArtifacts: c.BlobArtifacts,
 	}, nil
 }
 
@@ -127,7 +132,7 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 		artifacts:    P.Artifacts,
 		createCOT:    p.privateKey != nil && P.CreateCOT,
 		certifiedLog: p.privateKey != nil && P.CertifiedLog,
-		uploaded:     make(map[string][]byte),
+		uploaded:     make(map[string]string),
 		context:      options.TaskContext,
 		monitor:      options.Monitor,
 	}, nil
@@ -147,7 +152,7 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 		switch a.Type {
 		case typeFile:
 			tp.processFile(result, a)
-		case typeDirectory:
+		case typeDirectory, typeGlob:
 			tp.processDirectory(result, a)
 		}
 	})
@@ -183,13 +188,18 @@ func (tp *taskPlugin) hashArtifact(name string, r io.ReadSeeker) error {
 	}
 
 	// Set artifact hash in uploaded for COT generation
-	tp.mUploaded.Lock()
-	defer tp.mUploaded.Unlock()
-	tp.uploaded[name] = h.Sum(nil)
+	tp.recordHash(name, hex.EncodeToString(h.Sum(nil)))
 
 	return nil
 }
 
+// recordHash records the hex encoded sha256 of an artifact for COT generation
+func (tp *taskPlugin) recordHash(name, sha256 string) {
+	tp.mUploaded.Lock()
+	defer tp.mUploaded.Unlock()
+	tp.uploaded[name] = sha256
+}
+
 func (tp *taskPlugin) Finished(success bool) error {
 	// Skip if no COT is to be generated
 	if !tp.createCOT {
@@ -206,39 +216,13 @@ func (tp *taskPlugin) Finished(success bool) error {
 		}
 		defer r.Close()
 
-		// Compute artifact hash for chain-of-trust
-		if err = tp.hashArtifact(certifiedLogName, r); err != nil {
-			return err
-		}
-
-		compressed, err := tp.plugin.environment.TemporaryStorage.NewFile()
-		if err != nil {
-			return err
-		}
-		defer compressed.Close()
-
-		// Compress log
-		zipper := gzip.NewWriter(compressed)
-		if _, err = io.Copy(zipper, r); err != nil {
-			return errors.Wrap(err, "failed to compress log")
-		}
-		if err = zipper.Close(); err != nil {
-			return errors.Wrap(err, "failed to close compressing of log")
-		}
-		_, err = compressed.Seek(0, 0)
-		if err != nil {
-			return errors.Wrap(err, "Failed to seek to start of compressed log")
-		}
-
-		// Let's upload from compressed
-		err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     certifiedLogName,
-			Mimetype: "text/plain; charset=utf-8",
-			Stream:   compressed,
-			Expires:  tp.context.TaskInfo.Expires,
-			AdditionalHeaders: map[string]string{
-				"Content-Encoding": "gzip",
-			},
+		// Let's upload from r, compressing on the fly
+		err = tp.upload(runtime.S3Artifact{
+			Name:            certifiedLogName,
+			Mimetype:        "text/plain; charset=utf-8",
+			Stream:          r,
+			Expires:         tp.context.TaskInfo.Expires,
+			ContentEncoding: "gzip",
 		})
 		if err != nil {
 			err = errors.Wrap(err, "failed to upload certified.log")
@@ -259,7 +243,7 @@ func (tp *taskPlugin) Finished(success bool) error {
 	}
 	for name, hash := range tp.uploaded {
 		COT.Artifacts[name] = cotArtifact{
-			Sha256: hex.EncodeToString(hash),
+			Sha256: hash,
 		}
 	}
 	data, err := json.MarshalIndent(COT, "", "  ")
@@ -324,6 +308,10 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 
 	// If resource isn't found, task should fail and we print a message to task log
 	if err == engines.ErrResourceNotFound {
+		if a.Optional {
+			tp.context.Log(fmt.Sprintf("Optional artifact '%s' was not found, skipping.", a.Path))
+			return
+		}
 		tp.failed.Set(true)
 		if result.Success() {
 			// Only complain about missing artifacts, if the task was successful
@@ -370,26 +358,8 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 		return
 	}
 
-	// Guess the mimetype
-	mtype := mime.TypeByExtension(filepath.Ext(a.Path))
-	if mtype == "" {
-		mtype = mime.TypeByExtension(filepath.Ext(a.Name))
-	}
-	if mtype == "" {
-		mtype = unknownMimetype
-	}
-
-	// Compute artifact hash for chain-of-trust
-	if err = tp.hashArtifact(a.Name, r); err == nil {
-		// Let's upload from r
-		err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     a.Name,
-			Mimetype: mtype,
-			Stream:   r,
-			Expires:  a.Expires,
-		})
-	}
-
+	// Let's upload from r
+	err = tp.uploadArtifact(a, a.Name, r, a.Path, a.Name)
 	if err != nil && err != context.Canceled {
 		tp.nonFatalErr.Set(true)
 		i := tp.monitor.ReportError(err, "Failed to upload artifact")
@@ -398,13 +368,30 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 }
 
 func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
-	debug("extracting directory from path: %s", a.Path)
+	// For glob artifacts we extract the folder preceding the first wildcard
+	folder, pattern := a.Path, ""
+	if a.Type == typeGlob {
+		folder, pattern = splitGlob(a.Path)
+	}
+
+	debug("extracting directory from path: %s", folder)
 	semaphore := make(chan struct{}, maxUploadConcurrency)
-	err := result.ExtractFolder(a.Path, func(p string, r ioext.ReadSeekCloser) error {
-		debug(" - Found artifact: %s in %s", p, a.Path)
+	matched := atomics.Bool{}
+	err := result.ExtractFolder(folder, func(p string, r ioext.ReadSeekCloser) error {
+		debug(" - Found artifact: %s in %s", p, folder)
 		// Always close the reader
 		defer r.Close()
 
+		// Skip files not matching the pattern, or matching an exclude pattern
+		if pattern != "" && !matchGlob(pattern, p) {
+			return nil
+		}
+		if matchAnyGlob(a.Exclude, p) {
+			debug(" - Excluding artifact: %s in %s", p, folder)
+			return nil
+		}
+		matched.Set(true)
+
 		// Block until we can write to semaphore, then read when we're done uploading
 		// This way the capacity o the semaphore channel limits concurrency.
 		select {
@@ -416,32 +403,17 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 			<-semaphore
 		}()
 
-		// Guess the mimetype
-		mtype := mime.TypeByExtension(filepath.Ext(p))
-		if mtype == "" {
-			mtype = unknownMimetype
-		}
-
 		// Construct artifact name
 		name := path.Join(a.Name, p)
 
-		var uerr error
-		// Compute artifact hash for chain-of-trust
-		if uerr = tp.hashArtifact(name, r); uerr == nil {
-			// Upload artifact
-			debug(" - Uploading %s from %s -> %s", p, a.Path, name)
-			uerr = tp.context.UploadS3Artifact(runtime.S3Artifact{
-				Name:     name,
-				Expires:  a.Expires,
-				Stream:   r,
-				Mimetype: mtype,
-			})
-		}
+		// Upload artifact
+		debug(" - Uploading %s from %s -> %s", p, folder, name)
+		uerr := tp.uploadArtifact(a, name, r, p)
 
 		// If we have an upload error, that's just a internal non-fatal error.
 		// We ignore the error, if TaskContext was canceled, as requests should be
 		// aborted when that happens.
-		if uerr != nil && tp.context.Err() != nil {
+		if uerr != nil && tp.context.Err() == nil {
 			tp.nonFatalErr.Set(true)
 			i := tp.monitor.ReportError(uerr, "Failed to upload artifact")
 			tp.context.LogError("Failed to upload artifact unhandled error, incidentId:", i)
@@ -464,15 +436,19 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 
 	// If resource isn't found, task should fail and we print a message to task log
 	if err == engines.ErrResourceNotFound {
+		if a.Optional {
+			tp.context.Log(fmt.Sprintf("Optional artifact folder '%s' was not found, skipping.", folder))
+			return
+		}
 		tp.failed.Set(true)
 		// Only complain about missing artifact folder if task is successful
 		if result.Success() {
-			tp.context.LogError(fmt.Sprintf("No folder was found at '%s', artifact upload failed.", a.Path))
+			tp.context.LogError(fmt.Sprintf("No folder was found at '%s', artifact upload failed.", folder))
 		}
 		tp.context.CreateErrorArtifact(runtime.ErrorArtifact{
 			Name:    a.Name,
 			Reason:  reasonFileMissing,
-			Message: fmt.Sprintf("No folder was found at path: '%s' on worker", a.Path),
+			Message: fmt.Sprintf("No folder was found at path: '%s' on worker", folder),
 			Expires: a.Expires,
 		})
 		return
@@ -515,4 +491,118 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		tp.context.LogError("Failed to extract artifact unhandled error, incidentId:", i)
 		return
 	}
+
+	// If glob pattern didn't match any files, task should fail unless optional
+	if a.Type == typeGlob && !matched.Get() && !a.Optional {
+		tp.failed.Set(true)
+		if result.Success() {
+			tp.context.LogError(fmt.Sprintf("No files matched '%s', artifact upload failed.", a.Path))
+		}
+		tp.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Reason:  reasonFileMissing,
+			Message: fmt.Sprintf("No files matched pattern: '%s' on worker", a.Path),
+			Expires: a.Expires,
+		})
+	}
+}
+
+// uploadArtifact uploads r as artifact with given name, using content type
+// and encoding from a. If no content type is given, it is guessed from the
+// file extension of filenames.
+//
+// If the artifact would exceed maxTotalSize, an error artifact is created and
+// the task fails.
+func (tp *taskPlugin) uploadArtifact(a artifact, name string, r ioext.ReadSeekCloser, filenames ...string) error {
+	// Find size of the artifact
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "failed to seek to end of artifact")
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start of artifact")
+	}
+	if !tp.reserveSize(size) {
+		tp.failed.Set(true)
+		tp.context.LogError(fmt.Sprintf(
+			"Artifact '%s' exceeds the maximum total artifact size of %d bytes.", name, tp.plugin.maxTotalSize,
+		))
+		return tp.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    name,
+			Reason:  reasonTooLarge,
+			Message: fmt.Sprintf("Artifacts exceeded the maximum total size of %d bytes", tp.plugin.maxTotalSize),
+			Expires: a.Expires,
+		})
+	}
+
+	// Guess the mimetype, if not given
+	mtype := a.ContentType
+	for _, filename := range filenames {
+		if mtype == "" {
+			mtype = mime.TypeByExtension(filepath.Ext(filename))
+		}
+	}
+	if mtype == "" {
+		mtype = unknownMimetype
+	}
+
+	err = tp.upload(runtime.S3Artifact{
+		Name:            name,
+		Mimetype:        mtype,
+		Stream:          r,
+		Expires:         a.Expires,
+		ContentEncoding: a.ContentEncoding,
+	})
+	if err != nil {
+		// Only successfully uploaded artifacts count towards maxTotalSize
+		tp.releaseSize(size)
+	}
+	return err
+}
+
+// upload uploads artifact as blob artifact if enabled in config, otherwise as
+// S3 artifact, recording the hash of the artifact for chain-of-trust.
+func (tp *taskPlugin) upload(artifact runtime.S3Artifact) error {
+	if !tp.plugin.blobArtifacts {
+		// Compute artifact hash for chain-of-trust
+		if err := tp.hashArtifact(artifact.Name, artifact.Stream); err != nil {
+			return err
+		}
+		return tp.context.UploadS3Artifact(artifact)
+	}
+
+	digests, err := tp.context.UploadBlobArtifact(runtime.BlobArtifact{
+		Name:            artifact.Name,
+		Mimetype:        artifact.Mimetype,
+		Stream:          artifact.Stream,
+		Expires:         artifact.Expires,
+		ContentEncoding: artifact.ContentEncoding,
+	})
+	if err != nil {
+		return err
+	}
+	tp.recordHash(artifact.Name, digests.Sha256)
+	return nil
+}
+
+// reserveSize adds size to the total size of uploaded artifacts, returns false
+// if this would exceed maxTotalSize. Call releaseSize if the upload fails.
+func (tp *taskPlugin) reserveSize(size int64) bool {
+	tp.mTotalSize.Lock()
+	defer tp.mTotalSize.Unlock()
+
+	if tp.plugin.maxTotalSize > 0 && tp.totalSize+size > tp.plugin.maxTotalSize {
+		return false
+	}
+	tp.totalSize += size
+	return true
+}
+
+// releaseSize subtracts size reserved with reserveSize from the total size of
+// uploaded artifacts.
+func (tp *taskPlugin) releaseSize(size int64) {
+	tp.mTotalSize.Lock()
+	defer tp.mTotalSize.Unlock()
+
+	tp.totalSize -= size
 }
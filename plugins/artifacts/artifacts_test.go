@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-client-go/tcqueue"
 	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
@@ -15,7 +16,9 @@ import (
 
 type artifactTestCase struct {
 	plugintest.Case
-	Artifacts []string
+	Artifacts      []string
+	BlobArtifacts  []string
+	ErrorArtifacts []string
 }
 
 func (a artifactTestCase) Test() {
@@ -39,6 +42,42 @@ func (a artifactTestCase) Test() {
 			client.PostS3ArtifactRequest,
 		).Return(&resp, nil)
 	}
+	blobresp, _ := json.Marshal(map[string]interface{}{
+		"storageType": "blob",
+		"requests": []map[string]interface{}{
+			{"url": ts.URL, "method": "PUT", "headers": map[string]string{}},
+		},
+	})
+	blobResp := tcqueue.PostArtifactResponse(blobresp)
+	for _, path := range a.BlobArtifacts {
+		mockedQueue.On(
+			"CreateArtifact",
+			taskID,
+			"0",
+			path,
+			client.PostBlobArtifactRequest,
+		).Return(&blobResp, nil)
+		mockedQueue.On(
+			"CompleteArtifact",
+			taskID,
+			"0",
+			path,
+			mock.Anything,
+		).Return(nil)
+	}
+	errorresp, _ := json.Marshal(tcqueue.ErrorArtifactResponse{
+		StorageType: "error",
+	})
+	errorResp := tcqueue.PostArtifactResponse(errorresp)
+	for _, path := range a.ErrorArtifacts {
+		mockedQueue.On(
+			"CreateArtifact",
+			taskID,
+			"0",
+			path,
+			client.PostAnyArtifactRequest,
+		).Return(&errorResp, nil)
+	}
 
 	a.Case.QueueMock = mockedQueue
 	a.Case.TaskID = taskID
@@ -130,3 +169,169 @@ func TestArtifactsDirectory(t *testing.T) {
 		},
 	}.Test()
 }
+
+func TestArtifactsDirectoryExclude(t *testing.T) {
+	artifactTestCase{
+		Artifacts: []string{"public/blah.txt", "public/sub/foo.txt"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt /artifacts/sub/foo.txt /artifacts/bar.log /artifacts/tmp/baz.txt",
+				"artifacts": [
+					{
+						"type": "directory",
+						"path": "/artifacts",
+						"name": "public",
+						"exclude": ["**/*.log", "tmp/**"]
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsGlob(t *testing.T) {
+	artifactTestCase{
+		Artifacts: []string{"public/build/a.txt", "public/build/sub/b.txt"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/a.txt /artifacts/sub/b.txt /artifacts/sub/c.json /artifacts/tmp/d.txt",
+				"artifacts": [
+					{
+						"type": "glob",
+						"path": "/artifacts/**/*.txt",
+						"name": "public/build",
+						"exclude": ["tmp/**"],
+						"contentType": "text/plain; charset=utf-8",
+						"contentEncoding": "gzip"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsGlobNoMatch(t *testing.T) {
+	artifactTestCase{
+		ErrorArtifacts: []string{"public/build"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/a.json",
+				"artifacts": [
+					{
+						"type": "glob",
+						"path": "/artifacts/*.txt",
+						"name": "public/build"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: false,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsOptional(t *testing.T) {
+	artifactTestCase{
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "true",
+				"argument": "whatever",
+				"artifacts": [
+					{
+						"type": "file",
+						"path": "/artifacts/missing.txt",
+						"name": "public/missing.txt",
+						"optional": true
+					},
+					{
+						"type": "glob",
+						"path": "/artifacts/*.txt",
+						"name": "public/build",
+						"optional": true
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsMaxTotalSize(t *testing.T) {
+	artifactTestCase{
+		ErrorArtifacts: []string{"public/blah.txt"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt",
+				"artifacts": [
+					{
+						"type": "file",
+						"path": "/artifacts/blah.txt",
+						"name": "public/blah.txt"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{"maxTotalSize": 5}`,
+			TestStruct:    t,
+			PluginSuccess: false,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsBlob(t *testing.T) {
+	artifactTestCase{
+		BlobArtifacts: []string{"public/blah.txt", "public/build/sub/b.txt"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt /artifacts/sub/b.txt",
+				"artifacts": [
+					{
+						"type": "file",
+						"path": "/artifacts/blah.txt",
+						"name": "public/blah.txt"
+					},
+					{
+						"type": "glob",
+						"path": "/artifacts/sub/*.txt",
+						"name": "public/build/sub",
+						"contentEncoding": "gzip"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{"blobArtifacts": true}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
@@ -1,12 +1,16 @@
 package artifacts
 
 import (
+	"math"
+
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type config struct {
-	PrivateKey string `json:"privateKey"`
+	PrivateKey    string `json:"privateKey"`
+	MaxTotalSize  int64  `json:"maxTotalSize"`
+	BlobArtifacts bool   `json:"blobArtifacts"`
 }
 
 var configSchema = schematypes.Object{
@@ -25,5 +29,28 @@ var configSchema = schematypes.Object{
 				If not given, chain-of-trust signing will be disabled.
 			`),
 		},
+		"maxTotalSize": schematypes.Integer{
+			Title: "Maximum Total Artifact Size",
+			Description: util.Markdown(`
+				Maximum total size of artifacts uploaded by a task in bytes, artifacts
+				exceeding this limit are replaced by error artifacts and the task
+				fails.
+
+				If not given, or zero, the total size of artifacts is not limited.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt64,
+		},
+		"blobArtifacts": schematypes.Boolean{
+			Title: "Upload Blob Artifacts",
+			Description: util.Markdown(`
+				Upload artifacts with the 'blob' storage type, declaring sha256 and
+				size of the content to the queue, such that downloads can be verified.
+				Large blob artifacts are uploaded in parts, see 'artifactUploads' in
+				the worker configuration.
+
+				If not given, or false, artifacts are uploaded as 's3' artifacts.
+			`),
+		},
 	},
 }
@@ -0,0 +1,74 @@
+package artifacts
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// splitGlob splits a glob pattern into the folder preceding the first segment
+// with wildcards, and the remaining slash separated pattern relative to that
+// folder. If the pattern has no folder part, the folder is ".".
+//
+// On Windows '\' is a path separator, elsewhere it escapes wildcards.
+func splitGlob(pattern string) (string, string) {
+	wildcards := "*?["
+	if filepath.Separator != '\\' {
+		wildcards += "\\"
+	}
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, s := range segments {
+		if strings.ContainsAny(s, wildcards) {
+			folder := filepath.FromSlash(strings.Join(segments[:i], "/"))
+			switch {
+			case folder == "" && i > 0: // pattern is absolute
+				folder = string(filepath.Separator)
+			case folder == "":
+				folder = "."
+			case folder == filepath.VolumeName(folder): // pattern is 'C:\...'
+				folder += string(filepath.Separator)
+			}
+			return folder, strings.Join(segments[i:], "/")
+		}
+	}
+	return pattern, ""
+}
+
+// matchGlob returns true, if the slash separated name matches pattern.
+//
+// Segments of the pattern are matched using path.Match, and a '**' segment
+// matches zero or more segments of name.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchAnyGlob returns true, if name matches any of the patterns
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
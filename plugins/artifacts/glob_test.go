@@ -0,0 +1,52 @@
+package artifacts
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitGlob(t *testing.T) {
+	cases := []struct{ pattern, folder, rest string }{
+		{"/build/**/*.zip", "/build", "**/*.zip"},
+		{"/build/dist/*.tar.gz", "/build/dist", "*.tar.gz"},
+		{"/**/*.log", "/", "**/*.log"},
+		{"build/*.txt", "build", "*.txt"},
+		{"/build/output.txt", "/build/output.txt", ""},
+		{"*.txt", ".", "*.txt"},
+		{"**/*.txt", ".", "**/*.txt"},
+	}
+	if filepath.Separator != '\\' {
+		cases = append(cases, struct{ pattern, folder, rest string }{
+			"/build/\\*.txt", "/build", "\\*.txt",
+		})
+	}
+	for _, c := range cases {
+		folder, rest := splitGlob(c.pattern)
+		assert.Equal(t, c.folder, folder, "folder for %s", c.pattern)
+		assert.Equal(t, c.rest, rest, "pattern for %s", c.pattern)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "sub/a.txt", false},
+		{"**/*.txt", "a.txt", true},
+		{"**/*.txt", "sub/dir/a.txt", true},
+		{"**/*.txt", "sub/dir/a.json", false},
+		{"sub/**", "sub/a/b/c", true},
+		{"sub/**", "other/a", false},
+		{"**/test/*.log", "a/test/x.log", true},
+		{"**/test/*.log", "a/test/b/x.log", false},
+		{"file?.bin", "file1.bin", true},
+		{"[", "[", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, matchGlob(c.pattern, c.name), "%s ~ %s", c.pattern, c.name)
+	}
+}
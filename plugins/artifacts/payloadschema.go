@@ -14,15 +14,20 @@ type payload struct {
 }
 
 type artifact struct {
-	Type    string    `json:"type"`
-	Path    string    `json:"path"`
-	Name    string    `json:"name"`
-	Expires time.Time `json:"expires"`
+	Type            string    `json:"type"`
+	Path            string    `json:"path"`
+	Name            string    `json:"name"`
+	Expires         time.Time `json:"expires"`
+	Exclude         []string  `json:"exclude"`
+	ContentType     string    `json:"contentType"`
+	ContentEncoding string    `json:"contentEncoding"`
+	Optional        bool      `json:"optional"`
 }
 
 const (
 	typeFile      = "file"
 	typeDirectory = "directory"
+	typeGlob      = "glob"
 )
 
 var artifactSchema = schematypes.Array{
@@ -33,16 +38,30 @@ var artifactSchema = schematypes.Array{
 			"type": schematypes.StringEnum{
 				Title: "Upload type",
 				Description: util.Markdown(`
-					Artifacts can be either an individual 'file' or a 'directory'
+					Artifacts can be either an individual 'file', a 'directory'
 					containing potentially multiple files with recursively included
-					subdirectories.
+					subdirectories, or a 'glob' pattern matching files.
 				`),
-				Options: []string{typeFile, typeDirectory},
+				Options: []string{typeFile, typeDirectory, typeGlob},
 			},
 			"path": schematypes.String{
-				Title:       "Artifact Path",
-				Description: "File system path of the artifact",
-				Pattern:     `^.*[^/]$`,
+				Title: "Artifact Path",
+				Description: util.Markdown(`
+					File system path of the artifact.
+
+					For 'glob' artifacts this is a pattern, where '*', '?' and '[...]'
+					match within a path segment, and '**' matches zero or more
+					segments. Files are named relative to the folder preceding the
+					first segment with wildcards, e.g. '/build/**/*.zip' with name
+					'public/build' uploads '/build/a/b.zip' as 'public/build/a/b.zip'.
+
+					The entire folder preceding the first wildcard is extracted from
+					the sandbox, and every file in it is read before the pattern and
+					'exclude' are applied. Hence, patterns should start with a
+					specific folder, e.g. '/build/**/*.log' rather than '/**/*.log',
+					which extracts the entire file system.
+				`),
+				Pattern: `^.*[^/]$`,
 			},
 			"name": schematypes.String{
 				Title: "Artifact Name",
@@ -58,6 +77,41 @@ var artifactSchema = schematypes.Array{
 				Title:       "Expiration Date",
 				Description: "",
 			},
+			"exclude": schematypes.Array{
+				Title: "Excluded Files",
+				Description: util.Markdown(`
+					Glob patterns for files to be excluded from 'directory' and 'glob'
+					artifacts. Patterns are matched against the path relative to the
+					folder being uploaded, using the same syntax as 'glob' artifacts.
+					Excluded files are still extracted from the sandbox, they are just
+					not uploaded.
+				`),
+				Items: schematypes.String{},
+			},
+			"contentType": schematypes.String{
+				Title: "Content Type",
+				Description: util.Markdown(`
+					Content-Type for the artifact, if not given the content type is
+					guessed from the file extension.
+				`),
+				MaximumLength: 255,
+			},
+			"contentEncoding": schematypes.StringEnum{
+				Title: "Content Encoding",
+				Description: util.Markdown(`
+					Content-Encoding for the artifact, if 'gzip' the artifact is
+					compressed before upload, reducing storage and transfer size.
+					Defaults to 'identity'.
+				`),
+				Options: []string{"identity", "gzip"},
+			},
+			"optional": schematypes.Boolean{
+				Title: "Optional Artifact",
+				Description: util.Markdown(`
+					If 'true' the task will not fail if the artifact doesn't exist, or
+					if a 'glob' pattern doesn't match any files.
+				`),
+			},
 		},
 		Required: []string{"type", "path", "name"},
 	},
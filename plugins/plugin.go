@@ -77,6 +77,18 @@ type Plugin interface {
 	// strongly to execution time in this method
 	ReportIdle(durationSinceBusy time.Duration)
 
+	// PauseClaiming is called prior to polling for tasks, if any plugin returns
+	// true the worker will not claim tasks in this iteration of the claim loop.
+	// Tasks being processed are not affected, and ReportIdle is still called
+	// while claiming is paused.
+	//
+	// This is useful for plugins implementing maintenance windows, where the
+	// worker shouldn't be stopped, as restarting the worker is expensive.
+	//
+	// Warning: This hook is called before every attempt to claim tasks, so it
+	// must return quickly, slow implementations will delay claiming of tasks.
+	PauseClaiming() bool
+
 	// ReportNonFatalError is called if the worker encountered a non-fatal error.
 	//
 	// Plugins can use this to implement a heuristic for shutting down after
@@ -199,6 +211,11 @@ func (PluginBase) NewTaskPlugin(TaskPluginOptions) (TaskPlugin, error) {
 // ReportIdle does nothing
 func (PluginBase) ReportIdle(time.Duration) {}
 
+// PauseClaiming returns false
+func (PluginBase) PauseClaiming() bool {
+	return false
+}
+
 // ReportNonFatalError does nothing
 func (PluginBase) ReportNonFatalError() {}
 
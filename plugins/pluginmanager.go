@@ -9,6 +9,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
@@ -46,6 +47,7 @@ type taskPluginManager struct {
 	monitor     runtime.Monitor
 	taskPlugins []TaskPlugin
 	monitors    []runtime.Monitor
+	pluginNames []string
 	context     *runtime.TaskContext
 	working     atomics.Bool
 }
@@ -260,6 +262,25 @@ func (pm *PluginManager) ReportIdle(durationSinceBusy time.Duration) {
 	})
 }
 
+// PauseClaiming calls PauseClaiming on all the managed plugins, and returns
+// true if any of them returned true.
+func (pm *PluginManager) PauseClaiming() bool {
+	pause := atomics.NewBool(false)
+	spawn(len(pm.plugins), func(i int) {
+		m := pm.monitors[i].WithTag("hook", "PauseClaiming")
+		incidentID := capturePanicOrTimeout(m, func() {
+			if pm.plugins[i].PauseClaiming() {
+				pause.Set(true)
+			}
+		})
+		if incidentID != "" {
+			m.Errorf("stopping worker now due to panic reported as incidentID=%s", incidentID)
+			pm.environment.Worker.StopNow()
+		}
+	})
+	return pause.Get()
+}
+
 // ReportNonFatalError calls ReportNonFatalError on all the managed plugins.
 func (pm *PluginManager) ReportNonFatalError() {
 	spawn(len(pm.plugins), func(i int) {
@@ -326,6 +347,7 @@ func (pm *PluginManager) NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, e
 		monitor:     options.Monitor.WithPrefix("manager").WithTag("plugin", "manager"),
 		taskPlugins: make([]TaskPlugin, N),
 		monitors:    make([]runtime.Monitor, N),
+		pluginNames: pm.pluginNames,
 		context:     options.TaskContext,
 	}
 
@@ -374,12 +396,23 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 	}
 	defer m.working.Set(false)
 
+	// Trace each hook as child of the current span for the task
+	var parent *tracing.Span
+	if m.context != nil {
+		parent = m.context.Span()
+	}
+
 	errors := make([]error, N)
 	spawn(N, func(i int) {
 		monitor := m.monitors[i].WithTag("hook", hook)
+		span := parent.StartSpan("plugin."+hook, map[string]string{
+			"plugin": m.pluginNames[i],
+		})
+		defer span.End()
 		incidentID := capturePanicOrTimeout(monitor, func() {
 			errors[i] = fn(i)
 		})
+		span.SetError(errors[i])
 		if _, ok := runtime.IsMalformedPayloadError(errors[i]); !ok && errors[i] != nil {
 			// Both of these errors assumes that the error has been logged and recorded
 			if errors[i] != runtime.ErrFatalInternalError && errors[i] != runtime.ErrNonFatalInternalError {
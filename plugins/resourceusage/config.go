@@ -0,0 +1,35 @@
+package resourceusage
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// defaultArtifactName is the artifact resource usage is uploaded to, if not
+// configured.
+const defaultArtifactName = "public/resource-usage.json"
+
+type config struct {
+	ArtifactName string `json:"artifactName"`
+}
+
+var configSchema = schematypes.Object{
+	Title: "`resourceusage` Plugin",
+	Description: util.Markdown(`
+		The resource usage plugin reports CPU time, peak memory, disk I/O and
+		network usage for tasks, if supported by the engine. Resource usage is
+		uploaded as a JSON artifact, and reported as measurements tagged with
+		'workerType'. Values the engine can't measure are 'null' in the artifact
+		and aren't reported as measurements.
+	`),
+	Properties: schematypes.Properties{
+		"artifactName": schematypes.String{
+			Title: "Artifact Name",
+			Description: util.Markdown(`
+				Name of the artifact resource usage is uploaded to, defaults to
+				'` + defaultArtifactName + `'.
+			`),
+			Pattern: `^([\x20-\x2e\x30-\x7e][\x20-\x7e]*)[\x20-\x2e\x30-\x7e]$`,
+		},
+	},
+}
@@ -0,0 +1,12 @@
+// Package resourceusage provides a taskcluster-worker plugin that reports the
+// resources consumed by a task, if the engine supports
+// ResultSet.ResourceUsage().
+//
+// Resource usage is uploaded as a JSON artifact and reported as measurements
+// tagged with the workerType, making it possible to do capacity planning and
+// spot tasks that outgrow their worker type.
+package resourceusage
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("resourceusage")
@@ -0,0 +1,136 @@
+package resourceusage
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	config
+	monitor    runtime.Monitor
+	workerType string
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	parent  *plugin
+	context *runtime.TaskContext
+	monitor runtime.Monitor
+}
+
+// report is the format of the resource usage artifact, values that couldn't
+// be measured are null.
+type report struct {
+	TaskID         string   `json:"taskId"`
+	RunID          int      `json:"runId"`
+	WorkerType     string   `json:"workerType"`
+	Success        bool     `json:"success"`
+	CPUTime        *float64 `json:"cpuTime"` // seconds
+	PeakMemory     *int64   `json:"peakMemory"`
+	DiskReadBytes  *int64   `json:"diskReadBytes"`
+	DiskWriteBytes *int64   `json:"diskWriteBytes"`
+	NetworkRxBytes *int64   `json:"networkRxBytes"`
+	NetworkTxBytes *int64   `json:"networkTxBytes"`
+}
+
+func init() {
+	plugins.Register("resourceusage", provider{})
+}
+
+func (provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	var c config
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if c.ArtifactName == "" {
+		c.ArtifactName = defaultArtifactName
+	}
+
+	return &plugin{
+		config: c,
+		// Measurements are tagged with workerType, but not the taskId, as we're
+		// interested in usage across tasks for the workerType
+		monitor:    options.Monitor.WithTag("workerType", options.Environment.WorkerType),
+		workerType: options.Environment.WorkerType,
+	}, nil
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	return &taskPlugin{
+		parent:  p,
+		context: options.TaskContext,
+		monitor: options.Monitor,
+	}, nil
+}
+
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	usage, err := result.ResourceUsage()
+	if err == engines.ErrFeatureNotSupported {
+		debug("ResourceUsage() isn't supported by the engine")
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "ResultSet.ResourceUsage() failed")
+	}
+
+	r := report{
+		TaskID:     tp.context.TaskID,
+		RunID:      tp.context.RunID,
+		WorkerType: tp.parent.workerType,
+		Success:    result.Success(),
+	}
+	m := tp.parent.monitor
+	if usage.CPUTime >= 0 {
+		seconds := usage.CPUTime.Seconds()
+		r.CPUTime = &seconds
+		m.Measure("cpu-time", seconds)
+	}
+	r.PeakMemory = measureBytes(m, "peak-memory", usage.PeakMemory)
+	r.DiskReadBytes = measureBytes(m, "disk-read-bytes", usage.DiskReadBytes)
+	r.DiskWriteBytes = measureBytes(m, "disk-write-bytes", usage.DiskWriteBytes)
+	r.NetworkRxBytes = measureBytes(m, "network-rx-bytes", usage.NetworkRxBytes)
+	r.NetworkTxBytes = measureBytes(m, "network-tx-bytes", usage.NetworkTxBytes)
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize resource usage report"))
+	}
+
+	debug("uploading '%s'", tp.parent.ArtifactName)
+	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     tp.parent.ArtifactName,
+		Mimetype: "application/json",
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+		Expires:  tp.context.TaskInfo.Expires,
+	})
+	if err != nil {
+		tp.monitor.Error(errors.Wrap(err, "failed to upload resource usage report"))
+		// Upload error isn't fatal, could just be bad network
+		return false, runtime.ErrNonFatalInternalError
+	}
+	return true, nil
+}
+
+// measureBytes reports value as a measurement, if it is available, and
+// returns a pointer to value, or nil if not available.
+func measureBytes(monitor runtime.Monitor, name string, value int64) *int64 {
+	if value < 0 {
+		return nil
+	}
+	monitor.Measure(name, float64(value))
+	return &value
+}
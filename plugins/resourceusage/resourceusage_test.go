@@ -0,0 +1,70 @@
+package resourceusage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/tcqueue"
+	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+)
+
+func TestResourceUsage(t *testing.T) {
+	taskID := slugid.Nice()
+
+	// Simulated S3 server
+	var r report
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&r), "failed to decode report (simulated s3 server)")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s3.Close()
+
+	s3resp, _ := json.Marshal(tcqueue.S3ArtifactResponse{
+		PutURL: s3.URL,
+	})
+	resp := tcqueue.PostArtifactResponse(s3resp)
+	queueMock := &client.MockQueue{}
+	queueMock.On(
+		"CreateArtifact",
+		taskID,
+		"0",
+		"public/usage.json",
+		client.PostS3ArtifactRequest,
+	).Return(&resp, nil)
+
+	plugintest.Case{
+		TaskID:    taskID,
+		QueueMock: queueMock,
+		Payload: `{
+			"delay": 0,
+			"function": "true",
+			"argument": ""
+		}`,
+		Plugin:        "resourceusage",
+		PluginConfig:  `{"artifactName": "public/usage.json"}`,
+		PluginSuccess: true,
+		EngineSuccess: true,
+	}.Test()
+
+	queueMock.AssertExpectations(t)
+
+	// The mock engine reports fixed values, without network usage
+	assert.Equal(t, taskID, r.TaskID)
+	assert.Equal(t, "dummy-worker-type", r.WorkerType)
+	require.NotNil(t, r.CPUTime)
+	assert.Equal(t, 0.25, *r.CPUTime)
+	require.NotNil(t, r.PeakMemory)
+	assert.Equal(t, int64(64*1024*1024), *r.PeakMemory)
+	require.NotNil(t, r.DiskReadBytes)
+	assert.Equal(t, int64(4096), *r.DiskReadBytes)
+	require.NotNil(t, r.DiskWriteBytes)
+	assert.Equal(t, int64(8192), *r.DiskWriteBytes)
+	assert.Nil(t, r.NetworkRxBytes)
+	assert.Nil(t, r.NetworkTxBytes)
+}
@@ -18,12 +18,37 @@ import (
 )
 
 // S3Artifact wraps all of the needed fields to upload an s3 artifact
+//
+// If ContentEncoding is 'gzip' the stream is compressed before upload, leave
+// it empty if the stream is already encoded and given in AdditionalHeaders.
+// S3 artifacts are always uploaded in a single request, use BlobArtifact for
+// large artifacts that should be uploaded in parts.
 type S3Artifact struct {
 	Name              string
 	Mimetype          string
 	Expires           time.Time
 	Stream            ioext.ReadSeekCloser
 	AdditionalHeaders map[string]string
+	ContentEncoding   string // 'gzip' or 'identity' (default)
+}
+
+// BlobArtifact wraps all of the needed fields to upload a blob artifact
+//
+// The sha256 and size of blob artifacts are declared to the queue, allowing
+// downloads to be verified. If ContentEncoding is 'gzip' the stream is
+// compressed before upload.
+type BlobArtifact struct {
+	Name            string
+	Mimetype        string
+	Expires         time.Time
+	Stream          ioext.ReadSeekCloser
+	ContentEncoding string // 'gzip' or 'identity' (default)
+}
+
+// Digests of an artifact, hashes are hex encoded.
+type Digests struct {
+	Sha256 string
+	Size   int64
 }
 
 // ErrorArtifact wraps all of the needed fields to upload an error artifact
@@ -45,6 +70,55 @@ type RedirectArtifact struct {
 // UploadS3Artifact is responsible for creating new artifacts
 // in the queue and then performing the upload to s3.
 func (context *TaskContext) UploadS3Artifact(artifact S3Artifact) error {
+	span := context.Span().StartSpan("artifact.upload", map[string]string{
+		"artifact": artifact.Name,
+		"type":     "s3",
+	})
+	defer span.End()
+
+	err := context.uploadS3Artifact(artifact)
+	span.SetError(err)
+	return err
+}
+
+func (context *TaskContext) uploadS3Artifact(artifact S3Artifact) error {
+	defer artifact.Stream.Close()
+	options := context.getUploadOptions()
+
+	// Copy headers, so we don't modify the artifact given
+	headers := make(map[string]string, len(artifact.AdditionalHeaders)+1)
+	encoding := ""
+	for k, v := range artifact.AdditionalHeaders {
+		if http.CanonicalHeaderKey(k) == "Content-Encoding" {
+			encoding = v
+		}
+		headers[k] = v
+	}
+
+	// Compress the stream, if requested
+	stream := ioext.ReadSeekCloser(artifact.Stream)
+	switch artifact.ContentEncoding {
+	case "", "identity":
+	case "gzip":
+		if encoding != "" {
+			return errors.Errorf(
+				"artifact: %s has ContentEncoding and Content-Encoding header", artifact.Name,
+			)
+		}
+		if _, err := artifact.Stream.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "failed to seek to start of artifact")
+		}
+		compressed, _, err := compressArtifact(artifact.Stream, options.TemporaryStorage)
+		if err != nil {
+			return err
+		}
+		defer compressed.Close()
+		stream = compressed
+		headers["Content-Encoding"] = "gzip"
+	default:
+		panic(errors.Errorf("unsupported ContentEncoding: '%s'", artifact.ContentEncoding))
+	}
+
 	req, err := json.Marshal(tcqueue.S3ArtifactRequest{
 		ContentType: artifact.Mimetype,
 		Expires:     tcclient.Time(artifact.Expires),
@@ -63,7 +137,56 @@ func (context *TaskContext) UploadS3Artifact(artifact S3Artifact) error {
 		panic(errors.Wrap(err, "failed to parse JSON that have been parsed before"))
 	}
 
-	return putArtifact(resp.PutURL, artifact.Mimetype, artifact.Stream, artifact.AdditionalHeaders)
+	return putArtifact(resp.PutURL, artifact.Mimetype, ioext.NopCloser(stream), headers)
+}
+
+// UploadBlobArtifact computes the digests of the artifact, declares them to
+// the queue and uploads the artifact. The digests are returned, such that they
+// can be used without hashing the artifact again.
+func (context *TaskContext) UploadBlobArtifact(artifact BlobArtifact) (Digests, error) {
+	span := context.Span().StartSpan("artifact.upload", map[string]string{
+		"artifact": artifact.Name,
+		"type":     "blob",
+	})
+	defer span.End()
+
+	digests, err := context.uploadBlobArtifact(artifact)
+	span.SetError(err)
+	return digests, err
+}
+
+func (context *TaskContext) uploadBlobArtifact(artifact BlobArtifact) (Digests, error) {
+	defer artifact.Stream.Close()
+	options := context.getUploadOptions()
+
+	if _, err := artifact.Stream.Seek(0, io.SeekStart); err != nil {
+		return Digests{}, errors.Wrap(err, "failed to seek to start of artifact")
+	}
+
+	// Compute digests of the content, compressing in the same pass if requested
+	var digests Digests
+	var err error
+	stream := io.ReadSeeker(artifact.Stream)
+	encoding := ""
+	switch artifact.ContentEncoding {
+	case "", "identity":
+		if digests, err = computeDigests(artifact.Stream); err != nil {
+			return Digests{}, errors.Wrap(err, "failed to hash artifact")
+		}
+	case "gzip":
+		var compressed TemporaryFile
+		if compressed, digests, err = compressArtifact(artifact.Stream, options.TemporaryStorage); err != nil {
+			return Digests{}, err
+		}
+		defer compressed.Close()
+		stream = compressed
+		encoding = "gzip"
+	default:
+		panic(errors.Errorf("unsupported ContentEncoding: '%s'", artifact.ContentEncoding))
+	}
+
+	err = context.uploadBlob(artifact, stream, encoding, digests.Sha256, digests.Size, options)
+	return digests, err
 }
 
 // CreateErrorArtifact is responsible for inserting error
@@ -126,10 +249,6 @@ func (context *TaskContext) createArtifact(name string, req []byte) ([]byte, err
 
 func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArtifacts map[string]string) error {
 	defer stream.Close()
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		panic(errors.Wrap(err, "failed to parse URL"))
-	}
 	contentLength, err := stream.Seek(0, io.SeekEnd)
 	if err != nil {
 		return errors.Wrap(err, "failed to seek end of stream for content-length detection")
@@ -142,6 +261,18 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 		header.Set(k, v)
 	}
 
+	_, err = uploadRequest(http.MethodPut, urlStr, header, stream, contentLength)
+	return err
+}
+
+// uploadRequest sends stream to urlStr using method, retrying on errors and
+// 5xx responses. Returns the response headers, if successful.
+func uploadRequest(method, urlStr string, header http.Header, stream io.ReadSeeker, contentLength int64) (http.Header, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to parse URL"))
+	}
+
 	backoff := got.DefaultBackOff
 	attempts := 0
 	client := &http.Client{
@@ -151,7 +282,7 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 		attempts++
 		_, err := stream.Seek(0, io.SeekStart)
 		if err != nil {
-			return errors.Wrap(err, "Failed to seek start before uploading stream")
+			return nil, errors.Wrap(err, "Failed to seek start before uploading stream")
 		}
 		body := ioutil.NopCloser(stream)
 		if contentLength == 0 {
@@ -161,7 +292,7 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 			body = http.NoBody
 		}
 		req := &http.Request{
-			Method:        "PUT",
+			Method:        method,
 			URL:           u,
 			Proto:         "HTTP/1.1",
 			ProtoMajor:    1,
@@ -184,15 +315,15 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 				time.Sleep(backoff.Delay(attempts))
 				continue
 			}
-			return errors.Wrap(err, "failed send request")
+			return nil, errors.Wrap(err, "failed send request")
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode/100 == 4 {
 			httpErr, err := httputil.DumpResponse(resp, true)
 			if err != nil {
-				return errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
+				return nil, errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
 			}
-			return errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
+			return nil, errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
 		}
 		if resp.StatusCode/100 == 5 {
 			// TODO: Make this configurable
@@ -203,12 +334,12 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 			} else {
 				httpErr, err := httputil.DumpResponse(resp, true)
 				if err != nil {
-					return errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
+					return nil, errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
 				}
-				return errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
+				return nil, errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
 			}
 		}
 		// If we've made it here, the upload has succeeded
-		return nil
+		return resp.Header, nil
 	}
 }
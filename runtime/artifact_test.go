@@ -2,12 +2,16 @@ package runtime
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-client-go/tcqueue"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
@@ -59,6 +63,49 @@ func TestS3Artifact(t *testing.T) {
 	mockedQueue.AssertExpectations(t)
 }
 
+func TestBlobArtifact(t *testing.T) {
+	data := []byte("hello world\n")
+
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("ETag", "etag-0")
+	}))
+	defer ts.Close()
+
+	blobResp, _ := json.Marshal(map[string]interface{}{
+		"storageType": "blob",
+		"requests": []map[string]interface{}{
+			{"url": ts.URL, "method": "PUT", "headers": map[string]string{}},
+		},
+	})
+
+	context, mockedQueue := setupArtifactTest("public/test.txt", blobResp)
+	mockedQueue.On(
+		"CompleteArtifact", context.TaskID, "0", "public/test.txt",
+		&tcqueue.CompleteArtifactRequest{Etags: []string{"etag-0"}},
+	).Return(nil)
+
+	digests, err := context.UploadBlobArtifact(BlobArtifact{
+		Name:     "public/test.txt",
+		Mimetype: "text/plain; charset=utf-8",
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+	require.NoError(t, err)
+	mockedQueue.AssertExpectations(t)
+	require.Equal(t, data, received)
+
+	sum := sha256.Sum256(data)
+	require.Equal(t, hex.EncodeToString(sum[:]), digests.Sha256)
+	require.Equal(t, int64(len(data)), digests.Size)
+
+	req := mockedQueue.Calls[0].Arguments.Get(3).(*tcqueue.PostArtifactRequest)
+	var blobReq blobArtifactRequest
+	require.NoError(t, json.Unmarshal(*req, &blobReq))
+	require.Equal(t, digests.Sha256, blobReq.ContentSha256)
+	require.Equal(t, digests.Size, blobReq.ContentLength)
+}
+
 func TestErrorArtifact(t *testing.T) {
 	errorResp, _ := json.Marshal(tcqueue.ErrorArtifactResponse{
 		StorageType: "error",
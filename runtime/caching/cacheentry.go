@@ -35,6 +35,14 @@ func (e *cacheEntry) LastUsed() time.Time {
 	return e.lastUsed
 }
 
+// CachedResource returns the resource and whether it is in use, this
+// implements gc.CachedResource.
+func (e *cacheEntry) CachedResource() (interface{}, bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.resource, e.refCount > 0
+}
+
 func (e *cacheEntry) Dispose() error {
 	e.m.Lock()
 
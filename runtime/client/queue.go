@@ -32,6 +32,7 @@ type Queue interface {
 	PollTaskUrls(string, string) (*tcqueue.PollTaskUrlsResponse, error)
 	CancelTask(string) (*tcqueue.TaskStatusResponse, error)
 	CreateArtifact(string, string, string, *tcqueue.PostArtifactRequest) (*tcqueue.PostArtifactResponse, error)
+	CompleteArtifact(string, string, string, *tcqueue.CompleteArtifactRequest) error
 	GetArtifact_SignedURL(string, string, string, time.Duration) (*url.URL, error) // nolint
 }
 
@@ -105,6 +106,12 @@ func (m *MockQueue) CreateArtifact(taskID, runID, name string, payload *tcqueue.
 	return args.Get(0).(*tcqueue.PostArtifactResponse), args.Error(1)
 }
 
+// CompleteArtifact is a mock implementation of github.com/taskcluster/taskcluster-client-go/tcqueue.CompleteArtifact
+func (m *MockQueue) CompleteArtifact(taskID, runID, name string, payload *tcqueue.CompleteArtifactRequest) error {
+	args := m.Called(taskID, runID, name, payload)
+	return args.Error(0)
+}
+
 // GetArtifact_SignedURL is a mock implementation of github.com/taskcluster/taskcluster-client-go/tcqueue.GetArtifact_SignedURL
 func (m *MockQueue) GetArtifact_SignedURL(taskID, runID, name string, duration time.Duration) (*url.URL, error) { // nolint
 	args := m.Called(taskID, runID, name, duration)
@@ -131,6 +138,22 @@ var PostS3ArtifactRequest = mock.MatchedBy(func(i interface{}) bool {
 	return s3req.StorageType == "s3"
 })
 
+// PostBlobArtifactRequest matches if tcqueue.PostArtifactRequest is called
+// with a blob artifact
+var PostBlobArtifactRequest = mock.MatchedBy(func(i interface{}) bool {
+	r, ok := i.(*tcqueue.PostArtifactRequest)
+	if !ok {
+		return false
+	}
+	var req struct {
+		StorageType string `json:"storageType"`
+	}
+	if json.Unmarshal(*r, &req) != nil {
+		return false
+	}
+	return req.StorageType == "blob"
+})
+
 // ExpectS3Artifact will setup queue to expect an S3 artifact with given
 // name to be created for taskID and runID using m and returns
 // a channel which will receive the artifact.
@@ -217,7 +240,7 @@ var (
 
 // ServeHTTP handles a queue request by calling the mock implemetation
 func (m *MockQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -246,6 +269,13 @@ func (m *MockQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				result, err = m.ReportException(match[1], match[2], &payload)
 			}
 		case "artifacts":
+			if r.Method == http.MethodPut {
+				var payload tcqueue.CompleteArtifactRequest
+				if err = json.Unmarshal(data, &payload); err == nil {
+					err = m.CompleteArtifact(match[1], match[2], match[4], &payload)
+				}
+				break
+			}
 			var payload tcqueue.PostArtifactRequest
 			if err = json.Unmarshal(data, &payload); err == nil {
 				result, err = m.CreateArtifact(match[1], match[2], match[4], &payload)
@@ -1,9 +1,12 @@
 package fetcher
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	got "github.com/taskcluster/go-got"
@@ -148,8 +151,21 @@ func fetchURL(ctx Context, subject, u string, target io.Writer) (werr, rerr erro
 		close(finishedReporting)
 	}
 
+	// If content hash and length is declared, as done for blob artifacts, we
+	// verify it. If the body wasn't decoded, we verify the transfer instead.
+	sha256Header, lengthHeader := "X-Amz-Meta-Content-Sha256", "X-Amz-Meta-Content-Length"
+	if e := res.Header.Get("Content-Encoding"); !res.Uncompressed && e != "" && e != "identity" {
+		sha256Header, lengthHeader = "X-Amz-Meta-Transfer-Sha256", "X-Amz-Meta-Transfer-Length"
+	}
+	var w io.Writer = target
+	h := sha256.New()
+	expectedSha256 := res.Header.Get(sha256Header)
+	if expectedSha256 != "" {
+		w = io.MultiWriter(target, h)
+	}
+
 	// Copy body to target
-	_, ew, er := ioext.Copy(target, &r)
+	_, ew, er := ioext.Copy(w, &r)
 
 	close(done)         // Stop progress reporting
 	<-finishedReporting // wait for reporting to be finished
@@ -162,6 +178,18 @@ func fetchURL(ctx Context, subject, u string, target io.Writer) (werr, rerr erro
 		return nil, fmt.Errorf("connection broken: %s", er)
 	}
 
+	// Verify length and hash, if declared
+	if l := res.Header.Get(lengthHeader); l != "" {
+		if size, err := strconv.ParseInt(l, 10, 64); err == nil && size != r.Tell() {
+			return nil, fmt.Errorf("length mismatch, expected %d bytes, got %d bytes", size, r.Tell())
+		}
+	}
+	if expectedSha256 != "" {
+		if s := hex.EncodeToString(h.Sum(nil)); s != expectedSha256 {
+			return nil, fmt.Errorf("sha256 mismatch, expected '%s', got '%s'", expectedSha256, s)
+		}
+	}
+
 	// Report download completed
 	ctx.Progress(subject, 1)
 
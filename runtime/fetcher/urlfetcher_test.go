@@ -50,6 +50,19 @@ func TestUrlFetcher(t *testing.T) {
 			}
 			debug("finished slow response")
 
+		case "/verified":
+			// sha256 of "status-ok"
+			w.Header().Set("X-Amz-Meta-Content-Sha256", "a2bb067d1f71a79dcc9fc66cf520c1919ca0d89d31485b67e29e2c564594fb7e")
+			w.Header().Set("X-Amz-Meta-Content-Length", "9")
+			w.WriteHeader(200)
+			w.Write([]byte("status-ok"))
+
+		case "/corrupted":
+			w.Header().Set("X-Amz-Meta-Content-Sha256", "0000000000000000000000000000000000000000000000000000000000000000")
+			w.Header().Set("X-Amz-Meta-Content-Length", "9")
+			w.WriteHeader(200)
+			w.Write([]byte("status-ok"))
+
 		case "/client-error":
 			w.WriteHeader(400)
 			w.Write([]byte("client-error"))
@@ -87,6 +100,29 @@ func TestUrlFetcher(t *testing.T) {
 		require.Equal(t, 1, count)
 	})
 
+	t.Run("verified", func(t *testing.T) {
+		count = 0
+		w := &fakeWriteReseter{}
+		ref, err := URL.NewReference(ctx, s.URL+"/verified")
+		require.NoError(t, err)
+		err = ref.Fetch(ctx, w)
+		require.NoError(t, err)
+		require.Equal(t, "status-ok", w.String())
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		count = 0
+		w := &fakeWriteReseter{}
+		ref, err := URL.NewReference(ctx, s.URL+"/corrupted")
+		require.NoError(t, err)
+		err = ref.Fetch(ctx, w)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "sha256 mismatch")
+		require.Equal(t, "", w.String())
+		require.Equal(t, maxRetries+1, count)
+	})
+
 	t.Run("streaming-ok", func(t *testing.T) {
 		count = 0
 		w := &fakeWriteReseter{}
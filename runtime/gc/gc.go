@@ -1,8 +1,10 @@
 package gc
 
 import (
+	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
@@ -151,6 +153,59 @@ func (gc *GarbageCollector) Collect() error {
 	return nil
 }
 
+// A CachedResource is a Disposable wrapping a resource held by a cache, this
+// allows Resources() to describe the cached resource rather than the wrapper.
+type CachedResource interface {
+	Disposable
+	// CachedResource returns the cached resource and whether it is in use
+	CachedResource() (resource interface{}, inUse bool)
+}
+
+// ResourceInfo describes a resource tracked by the GarbageCollector.
+type ResourceInfo struct {
+	Type       string    `json:"type"`       // Go type of the resource
+	MemorySize int64     `json:"memorySize"` // -1, if not supported
+	DiskSize   int64     `json:"diskSize"`   // -1, if not supported
+	LastUsed   time.Time `json:"lastUsed"`
+	Cached     bool      `json:"cached"` // true, if resource is held by a cache
+	InUse      bool      `json:"inUse"`  // only known for cached resources
+}
+
+// Resources returns information about resources tracked by the
+// GarbageCollector, ordered least-recently-used first.
+func (gc *GarbageCollector) Resources() []ResourceInfo {
+	gc.m.Lock()
+	resources := make([]Disposable, len(gc.resources))
+	copy(resources, gc.resources)
+	gc.m.Unlock()
+
+	// Sort and get sizes without holding the lock, as sizes may be slow
+	sort.Sort(disposableSorter(resources))
+	infos := make([]ResourceInfo, len(resources))
+	for i, r := range resources {
+		info := ResourceInfo{
+			Type:       fmt.Sprintf("%T", r),
+			MemorySize: -1,
+			DiskSize:   -1,
+			LastUsed:   r.LastUsed(),
+		}
+		if size, err := r.MemorySize(); err == nil {
+			info.MemorySize = int64(size)
+		}
+		if size, err := r.DiskSize(); err == nil {
+			info.DiskSize = int64(size)
+		}
+		if c, ok := r.(CachedResource); ok {
+			var resource interface{}
+			resource, info.InUse = c.CachedResource()
+			info.Type = fmt.Sprintf("%T", resource)
+			info.Cached = true
+		}
+		infos[i] = info
+	}
+	return infos
+}
+
 // CollectAll disposes all resources that can be disposed.
 //
 // All resources not returning: ErrDisposableInUse.
@@ -173,19 +228,44 @@ func (gc *GarbageCollector) CollectAll() error {
 	return nil
 }
 
+// AvailableDiskSpace returns the amount of disk space in bytes that can be
+// used before the GarbageCollector has to free disk space. This is negative, if
+// disk space must be freed to satisfy minimumDiskSpace.
+func (gc *GarbageCollector) AvailableDiskSpace() (int64, error) {
+	if gc.storageFolder == "" {
+		return 0, fmt.Errorf("no storage folder given, cannot measure disk space")
+	}
+	stat, err := disk.Usage(gc.storageFolder)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Free) - gc.minimumDiskSpace, nil
+}
+
+// AvailableMemory returns the amount of memory in bytes that can be used
+// before the GarbageCollector has to free memory. This is negative, if memory
+// must be freed to satisfy minimumMemory.
+func (gc *GarbageCollector) AvailableMemory() (int64, error) {
+	stat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Available) - gc.minimumMemory, nil
+}
+
 // needDiskSpace returns true if we need to free diskspace
 func (gc *GarbageCollector) needDiskSpace() bool {
 	// If we have no metrics or minimum diskspace we remove everything
-	if gc.minimumDiskSpace == 0 || gc.storageFolder == "" {
+	if gc.minimumDiskSpace == 0 {
 		return true
 	}
-	stat, err := disk.Usage(gc.storageFolder)
+	available, err := gc.AvailableDiskSpace()
 	if err != nil {
 		// TODO: Write a warning to the log
 		return true
 	}
 
-	return int64(stat.Free) < gc.minimumDiskSpace
+	return available < 0
 }
 
 // needMemory returns true if we need to free memory
@@ -194,11 +274,11 @@ func (gc *GarbageCollector) needMemory() bool {
 	if gc.minimumMemory == 0 {
 		return true
 	}
-	stat, err := mem.VirtualMemory()
+	available, err := gc.AvailableMemory()
 	if err != nil {
 		// TODO: Write a warning to the log
 		return true
 	}
 
-	return int64(stat.Available) < gc.minimumMemory
+	return available < 0
 }
@@ -192,3 +192,48 @@ func TestCollectMemoryOnly(t *testing.T) {
 	assert(r1.disposed, "Expected r1 to be disposed")
 	assert(!r2.disposed, "Didn't expect r2 to be disposed")
 }
+
+type testCachedResource struct {
+	testResource
+	inUse bool
+}
+
+func (t *testCachedResource) CachedResource() (interface{}, bool) {
+	return &myResource{}, t.inUse
+}
+
+func TestResources(t *testing.T) {
+	gc := &GarbageCollector{}
+
+	r1 := &testResource{
+		mem:       10,
+		diskError: ErrDisposableSizeNotSupported,
+		lastUsed:  time.Now(),
+	}
+	gc.Register(r1)
+	r2 := &testCachedResource{
+		testResource: testResource{
+			mem:      0,
+			disk:     20,
+			lastUsed: time.Now().Add(-time.Minute),
+		},
+		inUse: true,
+	}
+	gc.Register(r2)
+
+	infos := gc.Resources()
+	assert(len(infos) == 2, "Expected two resources, got: ", len(infos))
+
+	// Least-recently-used first
+	assert(infos[0].Type == "*gc.myResource", "Expected cached resource type, got: ", infos[0].Type)
+	assert(infos[0].Cached && infos[0].InUse, "Expected cached resource in use")
+	assert(infos[0].DiskSize == 20, "Expected disk size 20, got: ", infos[0].DiskSize)
+
+	assert(infos[1].Type == "*gc.testResource", "Expected resource type, got: ", infos[1].Type)
+	assert(!infos[1].Cached, "Didn't expect resource to be cached")
+	assert(infos[1].MemorySize == 10, "Expected memory size 10, got: ", infos[1].MemorySize)
+	assert(infos[1].DiskSize == -1, "Expected disk size -1, got: ", infos[1].DiskSize)
+
+	// Resources() must not dispose anything
+	assert(!r1.disposed && !r2.disposed, "Didn't expect anything to be disposed")
+}
@@ -0,0 +1,12 @@
+// Package loopbackproxy provides an HTTP server on the loopback device that
+// engines can use to expose proxies attached with AttachProxy to processes
+// running on the host.
+//
+// Requests to <URL>/<name>/<path> are forwarded to the proxy attached with
+// hostname <name>, where the URL includes a per-task secret, as other users on
+// the host can also reach the loopback device.
+package loopbackproxy
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("loopbackproxy")
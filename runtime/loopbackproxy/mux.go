@@ -0,0 +1,116 @@
+package loopbackproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// EnvVar is the environment variable engines should use to expose the URL for
+// the proxies attached to the sandbox, error messages refer to it.
+const EnvVar = "TASKCLUSTER_PROXY_URL"
+
+type proxyErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p proxyErrorPayload) MustMarshalJSON() []byte {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		panic(errors.Wrap(err, "json.MarshalIndent on proxyErrorPayload"))
+	}
+	return data
+}
+
+// proxyMux takes requests where the path is /<secret>/<name>/<path> then
+// forwards it to Proxies[name] with <path> as if <path> had been hit.
+//
+// The listener is on the loopback device and can be reached by other users on
+// the host, hence, requests must be prefixed with a per-task Secret.
+type proxyMux struct {
+	Proxies     map[string]http.Handler
+	Secret      string
+	TaskContext *runtime.TaskContext
+}
+
+func (p *proxyMux) writeInvalidServiceRequest(w http.ResponseWriter, originalPath string) {
+	// Find active services in this sandbox
+	services := []string{}
+	for key := range p.Proxies {
+		services = append(services, key)
+	}
+	servicesJSON, err := json.Marshal(services)
+	if err != nil {
+		panic(errors.Wrap(err, "json.Marshal failed to render list of services"))
+	}
+
+	// Print message to task log, this makes debugging tasks a lot easier
+	p.TaskContext.LogError(fmt.Sprintf("$%s/%s is not a legal service path, "+
+		"must be on the form `$%s/<name>/<path>`; This task has the following services: %s",
+		EnvVar, originalPath, EnvVar, string(servicesJSON)))
+
+	// Write 404 response
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(proxyErrorPayload{
+		Code: "InvalidWorkerRequestError",
+		Message: fmt.Sprintf("Requests to `$%s` must be on the form `$%s/<name>/<path>` "+
+			"where `<name>` is a service you want to hit. This task has the following services: %s",
+			EnvVar, EnvVar, string(servicesJSON)),
+	}.MustMarshalJSON())
+}
+
+func (p *proxyMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Sanity checks and identifiation of secret/name/path
+	var origPath string
+	isRawPath := r.URL.RawPath != ""
+	if isRawPath {
+		origPath = r.URL.RawPath
+	} else {
+		origPath = r.URL.Path
+	}
+
+	// Requests without the secret are rejected without logging, as they don't
+	// originate from the task.
+	prefix := "/" + p.Secret + "/"
+	if !strings.HasPrefix(origPath, prefix) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(proxyErrorPayload{
+			Code:    "InvalidWorkerRequestError",
+			Message: fmt.Sprintf("Requests must be prefixed with `$%s`", EnvVar),
+		}.MustMarshalJSON())
+		return
+	}
+	origPath = origPath[len(prefix):]
+	debug("handling proxy request: %s", origPath)
+
+	parts := strings.SplitN(origPath, "/", 2)
+	if len(parts) != 2 {
+		p.writeInvalidServiceRequest(w, origPath)
+		return
+	}
+	name, path := parts[0], "/"+parts[1]
+
+	// Find the handler in for given name
+	h := p.Proxies[name]
+	if h == nil {
+		p.writeInvalidServiceRequest(w, origPath)
+		return
+	}
+
+	// Rewrite the path
+	if isRawPath {
+		r.URL.Path, _ = url.PathUnescape(path)
+		r.URL.RawPath = path
+	} else {
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,69 @@
+package loopbackproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"gopkg.in/tylerb/graceful.v1"
+)
+
+// Server is a per-task HTTP server listening on the loopback device,
+// forwarding requests to the proxies attached to the sandbox.
+type Server struct {
+	server     *graceful.Server
+	serverDone <-chan struct{}
+	url        string
+}
+
+// New starts a Server on a random port on the loopback device, forwarding
+// requests to proxies. Errors are logged to the task log in context.
+func New(proxies map[string]http.Handler, context *runtime.TaskContext) (*Server, error) {
+	secret := slugid.Nice()
+	s := &Server{}
+	s.server = &graceful.Server{
+		Timeout: 35 * time.Second,
+		Server: &http.Server{
+			Handler: &proxyMux{
+				Proxies:     proxies,
+				Secret:      secret,
+				TaskContext: context,
+			},
+		},
+		NoSignalHandling: true,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on loopback device, error: %s", err)
+	}
+	s.url = fmt.Sprintf("http://%s/%s", listener.Addr().String(), secret)
+
+	// Start serving
+	serverDone := make(chan struct{})
+	s.serverDone = serverDone
+	go func() {
+		defer close(serverDone)
+		// Serve returns an error when the listener is closed by Stop()
+		if err := s.server.Serve(listener); err != nil {
+			debug("proxy server stopped, error: %s", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// URL returns the URL for the proxies, requests to <URL>/<name>/<path> are
+// forwarded to the proxy attached with hostname <name>.
+func (s *Server) URL() string {
+	return s.url
+}
+
+// Stop the proxy server, waiting for pending requests a short while.
+func (s *Server) Stop() {
+	s.server.Stop(100 * time.Millisecond)
+	<-s.serverDone
+}
@@ -45,6 +45,11 @@ var monitorConfigSchema schematypes.Schema = schematypes.Object{
 			Title:       "Syslog Name",
 			Description: "Name to use for process in syslog, leave as empty string to disable syslog forwarding.",
 		},
+		"metrics":   metricsConfigSchema,
+		"logFormat": logFormatSchema,
+		"logFile":   logFileSchema,
+		"journald":  journaldSchema,
+		"incidents": incidentsConfigSchema,
 	},
 	Required: []string{"logLevel"},
 }
@@ -67,16 +72,38 @@ func New(config interface{}, auth client.Auth) runtime.Monitor {
 
 	// try monitor schema
 	var c struct {
-		Project  string            `json:"project"`
-		LogLevel string            `json:"logLevel"`
-		Tags     map[string]string `json:"tags"`
-		Syslog   string            `json:"syslog"`
+		Project   string            `json:"project"`
+		LogLevel  string            `json:"logLevel"`
+		Tags      map[string]string `json:"tags"`
+		Syslog    string            `json:"syslog"`
+		Metrics   []interface{}     `json:"metrics"`
+		LogFormat string            `json:"logFormat"`
+		LogFile   *logFileConfig    `json:"logFile"`
+		Journald  bool              `json:"journald"`
+		Incidents *incidentsConfig  `json:"incidents"`
 	}
 	if schematypes.MustMap(monitorConfigSchema, config, &c) == nil {
+		var m runtime.Monitor
 		if c.Project != "" {
-			return NewMonitor(c.Project, auth, c.LogLevel, c.Tags, c.Syslog)
+			m = NewMonitor(c.Project, auth, c.LogLevel, c.Tags, c.Syslog)
+		} else {
+			m = NewLoggingMonitor(c.LogLevel, c.Tags, c.Syslog)
 		}
-		return NewLoggingMonitor(c.LogLevel, c.Tags, c.Syslog)
+		if err := setupLogOutput(m, c.LogFormat, c.LogFile, c.Journald, c.Syslog); err != nil {
+			m.ReportError(err, "failed to setup log output")
+		}
+		if c.Incidents != nil {
+			store, err := newIncidentStore(*c.Incidents)
+			if err != nil {
+				m.ReportError(err, "failed to setup local incident store")
+			} else {
+				setIncidentStore(m, store)
+			}
+		}
+		if len(c.Metrics) > 0 {
+			setMetricSinks(m, newMetricSinks(c.Metrics, m))
+		}
+		return m
 	}
 
 	// try mock schema
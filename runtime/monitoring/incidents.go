@@ -0,0 +1,228 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	godebug "runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/commands/version"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// defaultMaxIncidents is the number of incidents kept if not configured
+const defaultMaxIncidents = 100
+
+// Incident is an error, warning or panic reported to a runtime.Monitor and
+// kept in the local incident store.
+type Incident struct {
+	IncidentID string            `json:"incidentId"`
+	Time       time.Time         `json:"time"`
+	Level      string            `json:"level"` // error or warning
+	Message    string            `json:"message"`
+	Error      string            `json:"error"`
+	Details    string            `json:"details,omitempty"` // error formatted with %+v, if different from Error
+	Stack      string            `json:"stack"`
+	Prefix     string            `json:"prefix"`
+	Tags       map[string]string `json:"tags"`
+	Version    string            `json:"version"`
+	Revision   string            `json:"revision"`
+}
+
+type incidentsConfig struct {
+	Folder       string `json:"folder"`
+	MaxIncidents int    `json:"maxIncidents"`
+}
+
+var incidentsConfigSchema = schematypes.Object{
+	Title: "Local Incident Store",
+	Description: util.Markdown(`
+		Store incidents reported to the monitor in a local folder, so incident
+		identifiers can be resolved without sentry. Incidents are always stored
+		when no 'project' is given, otherwise they are stored when submission
+		to sentry fails. Use 'taskcluster-worker incidents' to list and dump
+		stored incidents.
+	`),
+	Properties: schematypes.Properties{
+		"folder": schematypes.String{
+			Title:       "Folder",
+			Description: "Folder in which to store incidents, this will be created if it doesn't exist.",
+		},
+		"maxIncidents": schematypes.Integer{
+			Title: "Maximum Incidents",
+			Description: util.Markdown(`
+				Maximum number of incidents to keep, when exceeded the oldest
+				incidents are deleted. Defaults to 100.
+			`),
+			Minimum: 1,
+			Maximum: 100000,
+		},
+	},
+	Required: []string{"folder"},
+}
+
+// incidentStore is a bounded on-disk ring buffer of incidents, stored as a
+// JSON file per incident named '<unix-nano>-<incidentId>.json', such that
+// sorting file names also sorts incidents by time.
+type incidentStore struct {
+	m            sync.Mutex
+	folder       string
+	maxIncidents int
+}
+
+func newIncidentStore(c incidentsConfig) (*incidentStore, error) {
+	if c.MaxIncidents == 0 {
+		c.MaxIncidents = defaultMaxIncidents
+	}
+	if err := os.MkdirAll(c.Folder, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create incident folder '%s', error: %s", c.Folder, err)
+	}
+	return &incidentStore{
+		folder:       c.Folder,
+		maxIncidents: c.MaxIncidents,
+	}, nil
+}
+
+// setIncidentStore sets the incident store for a monitor created by NewMonitor
+// or NewLoggingMonitor, this must be done before monitors are derived from it.
+func setIncidentStore(m runtime.Monitor, store *incidentStore) {
+	switch m := m.(type) {
+	case *monitor:
+		m.incidents = store
+	case *loggingMonitor:
+		m.incidents = store
+	default:
+		panic(fmt.Sprintf("incident store is not supported by monitor of type: %T", m))
+	}
+}
+
+// newIncident creates an Incident with stack trace of the current goroutine
+func newIncident(incidentID, level string, err error, message, prefix string, tags map[string]string) Incident {
+	incident := Incident{
+		IncidentID: incidentID,
+		Time:       time.Now().UTC(),
+		Level:      level,
+		Message:    message,
+		Error:      err.Error(),
+		Stack:      string(godebug.Stack()),
+		Prefix:     prefix,
+		Tags:       tags,
+		Version:    version.Version(),
+		Revision:   version.Revision(),
+	}
+	if details := fmt.Sprintf("%+v", err); details != incident.Error {
+		incident.Details = details
+	}
+	return incident
+}
+
+// Store writes incident to the store and removes the oldest incidents, if
+// there are more than maxIncidents. This is safe to call on a nil store.
+func (s *incidentStore) Store(incident Incident) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(incident, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize incident, error: %s", err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Write to a temporary file and rename, so we never list partial files
+	name := fmt.Sprintf("%019d-%s.json", incident.Time.UnixNano(), incident.IncidentID)
+	tmp := filepath.Join(s.folder, "."+name)
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write incident, error: %s", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.folder, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write incident, error: %s", err)
+	}
+
+	names, err := incidentFiles(s.folder)
+	if err != nil {
+		return err
+	}
+	for len(names) > s.maxIncidents {
+		if err = os.Remove(filepath.Join(s.folder, names[0])); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old incident, error: %s", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// incidentFiles returns the sorted names of incident files in folder
+func incidentFiles(folder string) ([]string, error) {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read incident folder '%s', error: %s", folder, err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Mode().IsRegular() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func loadIncident(file string) (*Incident, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var incident Incident
+	if err = json.Unmarshal(data, &incident); err != nil {
+		return nil, fmt.Errorf("invalid incident file '%s', error: %s", file, err)
+	}
+	return &incident, nil
+}
+
+// ListIncidents returns incidents from the local incident store in folder,
+// ordered oldest first.
+func ListIncidents(folder string) ([]Incident, error) {
+	names, err := incidentFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+	incidents := make([]Incident, 0, len(names))
+	for _, name := range names {
+		incident, err := loadIncident(filepath.Join(folder, name))
+		if os.IsNotExist(err) {
+			continue // removed while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *incident)
+	}
+	return incidents, nil
+}
+
+// LoadIncident returns the incident with incidentID from the local incident
+// store in folder, or nil if not found.
+func LoadIncident(folder, incidentID string) (*Incident, error) {
+	names, err := incidentFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "-"+incidentID+".json") {
+			return loadIncident(filepath.Join(folder, name))
+		}
+	}
+	return nil, nil
+}
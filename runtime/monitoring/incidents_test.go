@@ -0,0 +1,50 @@
+package monitoring
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncidentStore(t *testing.T) {
+	folder, err := ioutil.TempDir("", "monitoring-incidents-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	store, err := newIncidentStore(incidentsConfig{Folder: folder, MaxIncidents: 2})
+	require.NoError(t, err)
+
+	m := NewLoggingMonitor("info", map[string]string{"workerId": "w-1"}, "")
+	setIncidentStore(m, store)
+
+	m.ReportError(errors.New("first error"), "first")
+	second := m.WithPrefix("engine").ReportWarning(errors.New("second error"), "second")
+	third := m.WithTag("taskId", "abc").ReportError(errors.New("third error"), "third")
+
+	incidents, err := ListIncidents(folder)
+	require.NoError(t, err)
+	require.Len(t, incidents, 2, "oldest incident should have been removed")
+	require.Equal(t, second, incidents[0].IncidentID)
+	require.Equal(t, third, incidents[1].IncidentID)
+
+	incident, err := LoadIncident(folder, second)
+	require.NoError(t, err)
+	require.NotNil(t, incident)
+	require.Equal(t, "warning", incident.Level)
+	require.Equal(t, "second", incident.Message)
+	require.Equal(t, "second error", incident.Error)
+	require.Equal(t, "engine", incident.Prefix)
+	require.Equal(t, "w-1", incident.Tags["workerId"])
+	require.Contains(t, incident.Stack, "TestIncidentStore")
+
+	incident, err = LoadIncident(folder, third)
+	require.NoError(t, err)
+	require.Equal(t, "abc", incident.Tags["taskId"])
+
+	incident, err = LoadIncident(folder, "missing")
+	require.NoError(t, err)
+	require.Nil(t, incident)
+}
@@ -0,0 +1,103 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journaldSocket is the socket for the native journald protocol
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldFieldPattern matches characters not permitted in journal field names
+var journaldFieldPattern = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// journaldHook is a logrus.Hook that sends log records to journald using the
+// native protocol, see systemd.journal-fields(7).
+type journaldHook struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+func newJournaldHook(identifier string) (logrus.Hook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald, error: %s", err)
+	}
+	return &journaldHook{conn: conn, identifier: identifier}, nil
+}
+
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	var b bytes.Buffer
+	writeJournaldField(&b, "MESSAGE", entry.Message)
+	writeJournaldField(&b, "PRIORITY", fmt.Sprintf("%d", journaldPriority(entry.Level)))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", h.identifier)
+	for key, value := range entry.Data {
+		name := journaldFieldName(key)
+		if name == "" {
+			continue
+		}
+		writeJournaldField(&b, name, fmt.Sprint(value))
+	}
+	// Records too large for a datagram would have to be passed as a memfd, we
+	// don't do that, so they are dropped with an error from logrus.
+	_, err := h.conn.Write(b.Bytes())
+	return err
+}
+
+// journaldFieldName returns key as a valid journal field name, or empty string
+// if there is no such name.
+func journaldFieldName(key string) string {
+	name := journaldFieldPattern.ReplaceAllString(strings.ToUpper(key), "_")
+	// Fields starting with underscore are trusted fields set by journald
+	name = strings.TrimLeft(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	switch name {
+	case "", "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return ""
+	}
+	return name
+}
+
+// writeJournaldField writes a field in the native protocol format, values
+// containing newlines are written with an explicit length.
+func writeJournaldField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journaldPriority returns the syslog priority for a log level
+func journaldPriority(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3 // err
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
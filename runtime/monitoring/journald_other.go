@@ -0,0 +1,13 @@
+// +build !linux
+
+package monitoring
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newJournaldHook(identifier string) (logrus.Hook, error) {
+	return nil, errors.New("journald is only supported on linux")
+}
@@ -0,0 +1,110 @@
+package monitoring
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an io.Writer that appends to a file, rotating it when the
+// size exceeds maxSize. Rotated files are suffixed '.1', '.2', ..., with '.1'
+// being the most recent, files beyond maxBackups are removed.
+type rotatingFile struct {
+	m          sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file '%s', error: %s", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file '%s', error: %s", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts backups and opens a new file
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	// Remove the oldest backup, then shift the others: .N-1 -> .N, ..., -> .1
+	if err := os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := f.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// Rotate if this write exceeds maxSize, unless the file is empty, in which
+	// case the record is written regardless of size
+	if f.file == nil || (f.size > 0 && f.size+int64(len(p)) > f.maxSize) {
+		if f.file == nil {
+			// A previous rotation failed, try to open the file again
+			if err := f.open(); err != nil {
+				return 0, err
+			}
+		} else if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate log file '%s', error: %s", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file
+func (f *rotatingFile) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
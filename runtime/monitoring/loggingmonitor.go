@@ -13,7 +13,10 @@ import (
 
 type loggingMonitor struct {
 	*logrus.Entry
-	prefix string
+	tags      map[string]string
+	prefix    string
+	sinks     metricSinks
+	incidents *incidentStore
 }
 
 // NewLoggingMonitor creates a monitor that just logs everything. This won't
@@ -46,6 +49,7 @@ func NewLoggingMonitor(logLevel string, tags map[string]string, syslogName strin
 
 	m := &loggingMonitor{
 		Entry: logrus.NewEntry(logger).WithFields(fields),
+		tags:  tags,
 	}
 
 	if syslogName != "" {
@@ -63,10 +67,12 @@ func (m *loggingMonitor) Measure(name string, value ...float64) {
 		strs = append(strs, fmt.Sprintf("%f", v))
 	}
 	m.Debugf("measure: %s%s recorded %s", m.prefix, name, strings.Join(strs, ","))
+	m.sinks.Measure(m.prefix+name, m.tags, value...)
 }
 
 func (m *loggingMonitor) Count(name string, value float64) {
 	m.Debugf("counter: %s%s incremented by %f", m.prefix, name, value)
+	m.sinks.Count(m.prefix+name, m.tags, value)
 }
 
 func (m *loggingMonitor) Time(name string, fn func()) {
@@ -84,6 +90,7 @@ func (m *loggingMonitor) CapturePanic(fn func()) (incidentID string) {
 			m.Entry.WithField("incidentId", incidentID).WithField("panic", crash).Error(
 				"Recovered from panic: ", message, "\nAt:\n", string(trace),
 			)
+			m.storeIncident(fmt.Errorf("PANIC: %s", message), "Recovered from panic", "error", incidentID)
 		}
 	}()
 	fn()
@@ -93,16 +100,37 @@ func (m *loggingMonitor) CapturePanic(fn func()) (incidentID string) {
 func (m *loggingMonitor) ReportError(err error, message ...interface{}) string {
 	incidentID := uuid.NewRandom().String()
 	m.Entry.WithField("incidentId", incidentID).WithError(err).Error(message...)
+	m.storeIncident(err, fmt.Sprint(message...), "error", incidentID)
 	return incidentID
 }
 
 func (m *loggingMonitor) ReportWarning(err error, message ...interface{}) string {
 	incidentID := uuid.NewRandom().String()
 	m.Entry.WithField("incidentId", incidentID).WithError(err).Warn(message...)
+	m.storeIncident(err, fmt.Sprint(message...), "warning", incidentID)
 	return incidentID
 }
 
+// storeIncident stores the error in the local incident store, if configured
+func (m *loggingMonitor) storeIncident(err error, message, level, incidentID string) {
+	if m.incidents == nil {
+		return
+	}
+	incident := newIncident(incidentID, level, err, message, strings.TrimSuffix(m.prefix, "."), m.tags)
+	if serr := m.incidents.Store(incident); serr != nil {
+		m.Error("Failed to store incident locally, error: ", serr)
+	}
+}
+
 func (m *loggingMonitor) WithTags(tags map[string]string) runtime.Monitor {
+	// Merge tags from monitor and tags
+	allTags := make(map[string]string, len(m.tags)+len(tags))
+	for k, v := range m.tags {
+		allTags[k] = v
+	}
+	for k, v := range tags {
+		allTags[k] = v
+	}
 	// Construct fields for logrus (just satisfiying the type system)
 	fields := make(map[string]interface{}, len(tags))
 	for k, v := range tags {
@@ -110,8 +138,11 @@ func (m *loggingMonitor) WithTags(tags map[string]string) runtime.Monitor {
 	}
 	fields["prefix"] = m.prefix // don't allow overwrite "prefix"
 	return &loggingMonitor{
-		Entry:  m.Entry.WithFields(fields),
-		prefix: m.prefix,
+		Entry:     m.Entry.WithFields(fields),
+		tags:      allTags,
+		prefix:    m.prefix,
+		sinks:     m.sinks,
+		incidents: m.incidents,
 	}
 }
 
@@ -122,7 +153,10 @@ func (m *loggingMonitor) WithTag(key, value string) runtime.Monitor {
 func (m *loggingMonitor) WithPrefix(prefix string) runtime.Monitor {
 	prefix = m.prefix + prefix
 	return &loggingMonitor{
-		Entry:  m.Entry.WithField("prefix", prefix),
-		prefix: prefix + ".",
+		Entry:     m.Entry.WithField("prefix", prefix),
+		tags:      m.tags,
+		prefix:    prefix + ".",
+		sinks:     m.sinks,
+		incidents: m.incidents,
 	}
 }
@@ -0,0 +1,122 @@
+package monitoring
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// defaultJournaldIdentifier is the SYSLOG_IDENTIFIER used for journald, if no
+// syslog name is configured.
+const defaultJournaldIdentifier = "taskcluster-worker"
+
+type logFileConfig struct {
+	Path       string `json:"path"`
+	MaxSize    int    `json:"maxSize"`
+	MaxBackups *int   `json:"maxBackups"` // nil, if not given
+}
+
+var logFormatSchema = schematypes.StringEnum{
+	Title: "Log Format",
+	Description: util.Markdown(`
+		Format for log records, defaults to 'text'. If 'json' is given each
+		record is a JSON object on a single line, with tags and prefix from the
+		monitor as keys, this includes 'taskId' and 'runId' for task specific
+		log records.
+	`),
+	Options: []string{logFormatText, logFormatJSON},
+}
+
+var logFileSchema = schematypes.Object{
+	Title: "Log File",
+	Description: util.Markdown(`
+		Write log records to a file instead of stderr. The file is rotated when
+		it exceeds 'maxSize', keeping 'maxBackups' old files suffixed '.1',
+		'.2', etc.
+	`),
+	Properties: schematypes.Properties{
+		"path": schematypes.String{
+			Title:       "Path",
+			Description: "Path of the log file.",
+		},
+		"maxSize": schematypes.Integer{
+			Title:       "Maximum Size",
+			Description: "Maximum size of the log file in MiB before it is rotated, defaults to 100.",
+			Minimum:     1,
+			Maximum:     100 * 1024,
+		},
+		"maxBackups": schematypes.Integer{
+			Title: "Maximum Backups",
+			Description: util.Markdown(`
+				Number of rotated log files to keep, defaults to 5. If zero, the log
+				file is truncated when rotated.
+			`),
+			Minimum: 0,
+			Maximum: 1000,
+		},
+	},
+	Required: []string{"path"},
+}
+
+var journaldSchema = schematypes.Boolean{
+	Title: "Journald",
+	Description: util.Markdown(`
+		Forward log records to journald, with tags and prefix from the monitor
+		as journal fields. Only supported on linux.
+	`),
+}
+
+// setupLogOutput configures format and outputs for the logger used by m, this
+// must be done before monitors are derived from it.
+func setupLogOutput(m runtime.Monitor, format string, file *logFileConfig, journald bool, syslogName string) error {
+	var logger *logrus.Logger
+	switch m := m.(type) {
+	case *monitor:
+		logger = m.Entry.Logger
+	case *loggingMonitor:
+		logger = m.Entry.Logger
+	default:
+		panic(fmt.Sprintf("log output can't be configured for monitor of type: %T", m))
+	}
+
+	if format == logFormatJSON {
+		logger.Formatter = &logrus.JSONFormatter{}
+	}
+
+	if file != nil {
+		maxSize := file.MaxSize
+		if maxSize == 0 {
+			maxSize = 100
+		}
+		maxBackups := 5
+		if file.MaxBackups != nil {
+			maxBackups = *file.MaxBackups
+		}
+		f, err := newRotatingFile(file.Path, int64(maxSize)*1024*1024, maxBackups)
+		if err != nil {
+			return err
+		}
+		logger.Out = f
+	}
+
+	if journald {
+		identifier := syslogName
+		if identifier == "" {
+			identifier = defaultJournaldIdentifier
+		}
+		hook, err := newJournaldHook(identifier)
+		if err != nil {
+			return err
+		}
+		logger.Hooks.Add(hook)
+	}
+	return nil
+}
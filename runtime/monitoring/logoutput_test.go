@@ -0,0 +1,92 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitoring-logfile-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "worker.log")
+	f, err := newRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		data, rerr := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, rerr)
+		return string(data)
+	}
+	require.Equal(t, "fourth\n", read("worker.log"))
+	require.Equal(t, "third\n", read("worker.log.1"))
+	require.Equal(t, "second\n", read("worker.log.2"))
+	_, err = os.Stat(filepath.Join(dir, "worker.log.3"))
+	require.True(t, os.IsNotExist(err), "expected only 2 backups")
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitoring-logfile-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "worker.log")
+	f, err := newRotatingFile(path, 10, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(data))
+	_, err = os.Stat(filepath.Join(dir, "worker.log.1"))
+	require.True(t, os.IsNotExist(err), "expected no backups")
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitoring-logfile-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "worker.log")
+	m := NewLoggingMonitor("info", map[string]string{"workerId": "w-1"}, "")
+	err = setupLogOutput(m, logFormatJSON, &logFileConfig{Path: path}, false, "")
+	require.NoError(t, err)
+
+	m.WithPrefix("task").WithTags(map[string]string{
+		"taskId": "abc",
+		"runId":  "0",
+	}).Info("hello world")
+	m.Debug("not logged")
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	require.Equal(t, "hello world", record["msg"])
+	require.Equal(t, "info", record["level"])
+	require.Equal(t, "task", record["prefix"])
+	require.Equal(t, "abc", record["taskId"])
+	require.Equal(t, "0", record["runId"])
+	require.Equal(t, "w-1", record["workerId"])
+}
@@ -0,0 +1,119 @@
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// A metricSink receives metrics recorded with runtime.Monitor, in addition to
+// statsum and/or the log. The name is the full name including prefix, using
+// dots as separator.
+type metricSink interface {
+	Measure(name string, tags map[string]string, value ...float64)
+	Count(name string, tags map[string]string, value float64)
+}
+
+// metricSinks forwards metrics to a list of sinks
+type metricSinks []metricSink
+
+func (s metricSinks) Measure(name string, tags map[string]string, value ...float64) {
+	for _, sink := range s {
+		sink.Measure(name, tags, value...)
+	}
+}
+
+func (s metricSinks) Count(name string, tags map[string]string, value float64) {
+	for _, sink := range s {
+		sink.Count(name, tags, value)
+	}
+}
+
+// setMetricSinks sets the sinks for a monitor created by NewMonitor or
+// NewLoggingMonitor, this must be done before monitors are derived from it.
+func setMetricSinks(m runtime.Monitor, sinks metricSinks) {
+	switch m := m.(type) {
+	case *monitor:
+		m.sinks = sinks
+	case *loggingMonitor:
+		m.sinks = sinks
+	default:
+		panic(fmt.Sprintf("metric sinks are not supported by monitor of type: %T", m))
+	}
+}
+
+// defaultMetricLabels is the tags used as labels when not configured, tags
+// with high cardinality like taskId are not suitable as labels.
+var defaultMetricLabels = []string{"component", "engine", "plugin", "hook", "stage"}
+
+var metricLabelsSchema = schematypes.Array{
+	Title: "Labels",
+	Description: util.Markdown(`
+		Tags from 'runtime.Monitor.WithTags()' to include as labels, tags with
+		high cardinality such as 'taskId' should not be used as labels.
+		Defaults to 'component', 'engine', 'plugin', 'hook' and 'stage'.
+	`),
+	Items: schematypes.String{},
+}
+
+var metricsConfigSchema = schematypes.Array{
+	Title: "Metric Sinks",
+	Description: util.Markdown(`
+		List of sinks to send metrics to, in addition to statsum if 'project'
+		is given.
+	`),
+	Items: schematypes.OneOf{
+		prometheusConfigSchema,
+		statsdConfigSchema,
+	},
+}
+
+// newMetricSinks creates metricSinks from config matching metricsConfigSchema,
+// errors are reported to monitor and the sink is skipped.
+func newMetricSinks(config []interface{}, monitor runtime.Monitor) metricSinks {
+	var sinks metricSinks
+	for _, c := range config {
+		var (
+			sink metricSink
+			err  error
+		)
+		var pc prometheusConfig
+		var sc statsdConfig
+		if schematypes.MustMap(prometheusConfigSchema, c, &pc) == nil {
+			sink, err = newPrometheusSink(pc, monitor.WithPrefix("prometheus"))
+		} else if schematypes.MustMap(statsdConfigSchema, c, &sc) == nil {
+			sink, err = newStatsdSink(sc)
+		} else {
+			panic("metric sink should have matched one of the options, this should be impossible")
+		}
+		if err != nil {
+			monitor.ReportError(err, "failed to setup metric sink")
+			continue
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// filterLabels returns the tags allowed by labels as a sorted list of pairs
+func filterLabels(tags map[string]string, labels []string) [][2]string {
+	var result [][2]string
+	for _, label := range labels {
+		if value, ok := tags[label]; ok {
+			result = append(result, [2]string{label, value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// joinMetricName joins prefix and name with a dot
+func joinMetricName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", prefix, name)
+}
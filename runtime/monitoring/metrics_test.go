@@ -0,0 +1,71 @@
+package monitoring
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusSink(t *testing.T) {
+	s, err := newPrometheusSink(prometheusConfig{
+		Address: "127.0.0.1:0",
+		Buckets: []float64{10, 100},
+	}, NewLoggingMonitor("debug", nil, ""))
+	require.NoError(t, err)
+
+	m := NewLoggingMonitor("debug", nil, "")
+	setMetricSinks(m, metricSinks{s})
+	m.WithPrefix("engine").WithTag("engine", "native").Measure("start-time", 5, 50, 500)
+	m.WithPrefix("engine").WithTag("taskId", "abc").Count("tasks", 2)
+	m.WithPrefix("engine").Count("tasks", 1)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	t.Log(body)
+
+	require.Contains(t, body, "# TYPE taskcluster_worker_engine_start_time histogram\n")
+	require.Contains(t, body, `taskcluster_worker_engine_start_time_bucket{engine="native",le="10"} 1`)
+	require.Contains(t, body, `taskcluster_worker_engine_start_time_bucket{engine="native",le="100"} 2`)
+	require.Contains(t, body, `taskcluster_worker_engine_start_time_bucket{engine="native",le="+Inf"} 3`)
+	require.Contains(t, body, `taskcluster_worker_engine_start_time_sum{engine="native"} 555`)
+	require.Contains(t, body, `taskcluster_worker_engine_start_time_count{engine="native"} 3`)
+	require.Contains(t, body, "# TYPE taskcluster_worker_engine_tasks_total counter\n")
+	// taskId isn't a label by default, so counters are aggregated
+	require.Contains(t, body, "taskcluster_worker_engine_tasks_total 3\n")
+	require.NotContains(t, body, "taskId")
+}
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := newStatsdSink(statsdConfig{
+		Address:   conn.LocalAddr().String(),
+		Prefix:    "worker",
+		DogStatsD: true,
+	})
+	require.NoError(t, err)
+
+	m := NewLoggingMonitor("debug", nil, "")
+	setMetricSinks(m, metricSinks{s})
+	m.WithPrefix("plugin").WithTag("plugin", "cache").Count("hits", 1)
+	m.WithPrefix("plugin").Measure("duration", 12.5)
+
+	var lines []string
+	buf := make([]byte, 1024)
+	for len(lines) < 2 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		lines = append(lines, string(buf[:n]))
+	}
+	require.Equal(t, "worker.plugin.hits:1|c|#plugin:cache", lines[0])
+	require.Equal(t, "worker.plugin.duration:12.5|ms", lines[1])
+	require.False(t, strings.Contains(lines[1], "#"))
+}
@@ -64,6 +64,7 @@ func NewMonitor(project string, auth client.Auth, logLevel string, tags map[stri
 			OnError: func(err error) { m.ReportWarning(err) },
 		}),
 		Entry: logrus.NewEntry(logger).WithFields(fields),
+		tags:  tags,
 		sentry: &sentry{
 			client:  nil,
 			project: project,
@@ -119,12 +120,26 @@ type monitor struct {
 	*statsum.Statsum
 	*logrus.Entry
 	*sentry
-	tags   map[string]string
-	prefix string
+	tags      map[string]string
+	prefix    string
+	sinks     metricSinks
+	incidents *incidentStore
+}
+
+func (m *monitor) Measure(name string, value ...float64) {
+	m.Statsum.Measure(name, value...)
+	m.sinks.Measure(joinMetricName(m.prefix, name), m.tags, value...)
+}
+
+func (m *monitor) Count(name string, value float64) {
+	m.Statsum.Count(name, value)
+	m.sinks.Count(joinMetricName(m.prefix, name), m.tags, value)
 }
 
 func (m *monitor) Time(name string, fn func()) {
-	m.Statsum.Time(name, fn)
+	start := time.Now()
+	fn()
+	m.Measure(name, time.Since(start).Seconds()*1000)
 }
 
 func (m *monitor) CapturePanic(fn func()) (incidentID string) {
@@ -188,12 +203,27 @@ func (m *monitor) submitError(err error, message string, level raven.Severity, i
 	if rerr != nil {
 		m.Error("Failed to obtain sentry DSN, error: ", rerr)
 		m.Error("Failed to send error: ", err)
+		m.storeIncident(err, message, level, incidentID)
 		return
 	}
 
 	// Send packet
 	_, done := client.Capture(packet, tags)
-	<-done
+	if serr := <-done; serr != nil {
+		m.Error("Failed to send error to sentry, error: ", serr)
+		m.storeIncident(err, message, level, incidentID)
+	}
+}
+
+// storeIncident stores the error in the local incident store, if configured
+func (m *monitor) storeIncident(err error, message string, level raven.Severity, incidentID uuid.UUID) {
+	if m.incidents == nil {
+		return
+	}
+	incident := newIncident(incidentID.String(), string(level), err, message, m.prefix, m.tags)
+	if serr := m.incidents.Store(incident); serr != nil {
+		m.Error("Failed to store incident locally, error: ", serr)
+	}
 }
 
 func (m *monitor) WithTags(tags map[string]string) runtime.Monitor {
@@ -212,11 +242,13 @@ func (m *monitor) WithTags(tags map[string]string) runtime.Monitor {
 	}
 	fields["prefix"] = m.prefix // don't allow overwrite "prefix"
 	return &monitor{
-		Statsum: m.Statsum,
-		Entry:   m.Entry.WithFields(fields),
-		sentry:  m.sentry,
-		tags:    allTags,
-		prefix:  m.prefix,
+		Statsum:   m.Statsum,
+		Entry:     m.Entry.WithFields(fields),
+		sentry:    m.sentry,
+		tags:      allTags,
+		prefix:    m.prefix,
+		sinks:     m.sinks,
+		incidents: m.incidents,
 	}
 }
 
@@ -230,10 +262,12 @@ func (m *monitor) WithPrefix(prefix string) runtime.Monitor {
 		completePrefix = m.prefix + "." + prefix
 	}
 	return &monitor{
-		Statsum: m.Statsum.WithPrefix(prefix),
-		Entry:   m.Entry.WithField("prefix", completePrefix),
-		sentry:  m.sentry,
-		tags:    m.tags,
-		prefix:  completePrefix,
+		Statsum:   m.Statsum.WithPrefix(prefix),
+		Entry:     m.Entry.WithField("prefix", completePrefix),
+		sentry:    m.sentry,
+		tags:      m.tags,
+		prefix:    completePrefix,
+		sinks:     m.sinks,
+		incidents: m.incidents,
 	}
 }
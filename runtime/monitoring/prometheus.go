@@ -0,0 +1,278 @@
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// defaultPrometheusBuckets are histogram buckets used if not configured, as
+// measures are arbitrary values, mostly milliseconds, the range is wide.
+var defaultPrometheusBuckets = []float64{
+	1, 5, 10, 50, 100, 500, 1000, 5000, 10000, 50000, 100000, 500000, 1000000,
+}
+
+type prometheusConfig struct {
+	Type      string    `json:"type"`
+	Address   string    `json:"address"`
+	Namespace string    `json:"namespace"`
+	Labels    []string  `json:"labels"`
+	Buckets   []float64 `json:"buckets"`
+}
+
+var prometheusConfigSchema = schematypes.Object{
+	Title: "Prometheus Exporter",
+	Description: util.Markdown(`
+		Export metrics for Prometheus at '/metrics' on the given address.
+		'Measure' and 'Time' are exported as histograms, and 'Count' is exported
+		as counters. Metric names are the prefix and name with characters not
+		permitted by Prometheus replaced by underscore.
+	`),
+	Properties: schematypes.Properties{
+		"type": schematypes.StringEnum{Options: []string{"prometheus"}},
+		"address": schematypes.String{
+			Title:       "Listen Address",
+			Description: "Address to listen on, such as ':9102' or '127.0.0.1:9102'.",
+		},
+		"namespace": schematypes.String{
+			Title:       "Namespace",
+			Description: "Namespace to prefix all metric names with, defaults to 'taskcluster_worker'.",
+			Pattern:     `^[a-zA-Z_][a-zA-Z0-9_]*$`,
+		},
+		"labels": metricLabelsSchema,
+		"buckets": schematypes.Array{
+			Title: "Histogram Buckets",
+			Description: util.Markdown(`
+				Upper bounds for histogram buckets in increasing order, defaults to
+				buckets from 1 to 1000000 suitable for milliseconds.
+			`),
+			Items: schematypes.Number{},
+		},
+	},
+	Required: []string{"type", "address"},
+}
+
+// prometheusNamePattern matches characters not permitted in metric names
+var prometheusNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+type prometheusSink struct {
+	m          sync.Mutex
+	namespace  string
+	labels     []string
+	buckets    []float64
+	types      map[string]string // metric name -> counter or histogram
+	counters   map[string]*prometheusCounter
+	histograms map[string]*prometheusHistogram
+}
+
+type prometheusCounter struct {
+	name   string
+	labels string
+	value  float64
+}
+
+type prometheusHistogram struct {
+	name   string
+	labels [][2]string
+	counts []uint64 // count for each bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newPrometheusSink(c prometheusConfig, monitor runtime.Monitor) (*prometheusSink, error) {
+	s := &prometheusSink{
+		namespace:  c.Namespace,
+		labels:     c.Labels,
+		buckets:    c.Buckets,
+		types:      make(map[string]string),
+		counters:   make(map[string]*prometheusCounter),
+		histograms: make(map[string]*prometheusHistogram),
+	}
+	if s.namespace == "" {
+		s.namespace = "taskcluster_worker"
+	}
+	if s.labels == nil {
+		s.labels = defaultMetricLabels
+	}
+	if len(s.buckets) == 0 {
+		s.buckets = defaultPrometheusBuckets
+	}
+	if !sort.Float64sAreSorted(s.buckets) {
+		return nil, fmt.Errorf("prometheus histogram buckets must be in increasing order")
+	}
+
+	listener, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s' for prometheus exporter, error: %s", c.Address, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			monitor.ReportError(err, "prometheus exporter stopped")
+		}
+	}()
+	return s, nil
+}
+
+// metricName returns the prometheus name for a metric
+func (s *prometheusSink) metricName(name string) string {
+	return s.namespace + "_" + prometheusNamePattern.ReplaceAllString(name, "_")
+}
+
+// setType records the type of name, returning false if it has another type,
+// in which case the metric is ignored.
+func (s *prometheusSink) setType(name, kind string) bool {
+	if t, ok := s.types[name]; ok && t != kind {
+		return false
+	}
+	s.types[name] = kind
+	return true
+}
+
+func (s *prometheusSink) Measure(name string, tags map[string]string, value ...float64) {
+	name = s.metricName(name)
+	labels := filterLabels(tags, s.labels)
+	key := name + formatPrometheusLabels(labels)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.setType(name, "histogram") {
+		return
+	}
+	h, ok := s.histograms[key]
+	if !ok {
+		h = &prometheusHistogram{
+			name:   name,
+			labels: labels,
+			counts: make([]uint64, len(s.buckets)),
+		}
+		s.histograms[key] = h
+	}
+	for _, v := range value {
+		i := sort.SearchFloat64s(s.buckets, v) // first bucket with v <= bound
+		if i < len(s.buckets) {
+			h.counts[i]++
+		}
+		h.sum += v
+		h.count++
+	}
+}
+
+func (s *prometheusSink) Count(name string, tags map[string]string, value float64) {
+	name = s.metricName(name) + "_total"
+	labels := formatPrometheusLabels(filterLabels(tags, s.labels))
+	key := name + labels
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.setType(name, "counter") {
+		return
+	}
+	c, ok := s.counters[key]
+	if !ok {
+		c = &prometheusCounter{name: name, labels: labels}
+		s.counters[key] = c
+	}
+	c.value += value
+}
+
+// ServeHTTP writes metrics in the prometheus text exposition format
+func (s *prometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+
+	s.m.Lock()
+	names := make([]string, 0, len(s.types))
+	for name := range s.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		kind := s.types[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, kind)
+		if kind == "counter" {
+			for _, key := range sortedKeys(s.counters, name) {
+				c := s.counters[key]
+				fmt.Fprintf(&b, "%s%s %s\n", c.name, c.labels, formatPrometheusValue(c.value))
+			}
+			continue
+		}
+		for _, key := range sortedKeys(s.histograms, name) {
+			h := s.histograms[key]
+			var cumulative uint64
+			for i, bound := range s.buckets {
+				cumulative += h.counts[i]
+				le := [2]string{"le", formatPrometheusValue(bound)}
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, formatPrometheusLabels(append(h.labels[:len(h.labels):len(h.labels)], le)), cumulative)
+			}
+			inf := [2]string{"le", "+Inf"}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, formatPrometheusLabels(append(h.labels[:len(h.labels):len(h.labels)], inf)), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", h.name, formatPrometheusLabels(h.labels), formatPrometheusValue(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", h.name, formatPrometheusLabels(h.labels), h.count)
+		}
+	}
+	s.m.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// sortedKeys returns the sorted keys for series of the metric called name,
+// m must be a map of counters or histograms.
+func sortedKeys(m interface{}, name string) []string {
+	var keys []string
+	switch series := m.(type) {
+	case map[string]*prometheusCounter:
+		for key, c := range series {
+			if c.name == name {
+				keys = append(keys, key)
+			}
+		}
+	case map[string]*prometheusHistogram:
+		for key, h := range series {
+			if h.name == name {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatPrometheusLabels formats labels as {key="value",...}
+func formatPrometheusLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(l[1])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, prometheusNamePattern.ReplaceAllString(l[0], "_"), value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatPrometheusValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,107 @@
+package monitoring
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type statsdConfig struct {
+	Type      string   `json:"type"`
+	Address   string   `json:"address"`
+	Prefix    string   `json:"prefix"`
+	DogStatsD bool     `json:"dogstatsd"`
+	Labels    []string `json:"labels"`
+}
+
+var statsdConfigSchema = schematypes.Object{
+	Title: "StatsD Sink",
+	Description: util.Markdown(`
+		Send metrics to a StatsD server over UDP. 'Measure' and 'Time' are sent
+		as timers, and 'Count' is sent as counters. Metrics are sent
+		immediately, and metrics that can't be sent are dropped.
+	`),
+	Properties: schematypes.Properties{
+		"type": schematypes.StringEnum{Options: []string{"statsd"}},
+		"address": schematypes.String{
+			Title:       "Server Address",
+			Description: "Address of the StatsD server, such as 'localhost:8125'.",
+		},
+		"prefix": schematypes.String{
+			Title:       "Prefix",
+			Description: "Prefix for all metric names, a dot is added as separator.",
+			Pattern:     `^[a-zA-Z0-9_.-]*$`,
+		},
+		"dogstatsd": schematypes.Boolean{
+			Title: "DogStatsD Tags",
+			Description: util.Markdown(`
+				Send tags in the DogStatsD format, if not enabled tags are not sent,
+				as plain StatsD doesn't support tags.
+			`),
+		},
+		"labels": metricLabelsSchema,
+	},
+	Required: []string{"type", "address"},
+}
+
+// statsdNamePattern matches characters not permitted in StatsD names
+var statsdNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+type statsdSink struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+	labels    []string
+}
+
+func newStatsdSink(c statsdConfig) (*statsdSink, error) {
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup StatsD sink for '%s', error: %s", c.Address, err)
+	}
+	s := &statsdSink{
+		conn:      conn,
+		prefix:    c.Prefix,
+		dogstatsd: c.DogStatsD,
+		labels:    c.Labels,
+	}
+	if s.labels == nil {
+		s.labels = defaultMetricLabels
+	}
+	return s, nil
+}
+
+func (s *statsdSink) Measure(name string, tags map[string]string, value ...float64) {
+	for _, v := range value {
+		s.send(name, strconv.FormatFloat(v, 'f', -1, 64), "ms", tags)
+	}
+}
+
+func (s *statsdSink) Count(name string, tags map[string]string, value float64) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "c", tags)
+}
+
+func (s *statsdSink) send(name, value, kind string, tags map[string]string) {
+	name = statsdNamePattern.ReplaceAllString(joinMetricName(s.prefix, name), "_")
+	line := fmt.Sprintf("%s:%s|%s", name, value, kind)
+	if s.dogstatsd {
+		labels := filterLabels(tags, s.labels)
+		if len(labels) > 0 {
+			pairs := make([]string, len(labels))
+			for i, l := range labels {
+				pairs[i] = statsdTagReplacer.Replace(l[0]) + ":" + statsdTagReplacer.Replace(l[1])
+			}
+			line += "|#" + strings.Join(pairs, ",")
+		}
+	}
+	// UDP writes don't block, errors are ignored as metrics are best-effort
+	_, _ = s.conn.Write([]byte(line))
+}
+
+// statsdTagReplacer replaces characters with special meaning in DogStatsD tags
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", ":", "_", "\n", "_")
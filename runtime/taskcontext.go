@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 
 	"gopkg.in/djherbis/stream.v1"
 )
@@ -61,17 +62,19 @@ type TaskInfo struct {
 // properties, and abortion notifications.
 type TaskContext struct {
 	TaskInfo
-	logStream   *stream.Stream
-	logLocation string // Absolute path to log file
-	logClosed   bool
-	mu          sync.RWMutex
-	queue       client.Queue
-	status      TaskStatus
-	done        chan struct{}
-	authorizer  client.Authorizer
-	clientID    string
-	accessToken string
-	certificate string
+	logStream     *stream.Stream
+	logLocation   string // Absolute path to log file
+	logClosed     bool
+	mu            sync.RWMutex
+	queue         client.Queue
+	status        TaskStatus
+	done          chan struct{}
+	authorizer    client.Authorizer
+	clientID      string
+	accessToken   string
+	certificate   string
+	span          *tracing.Span
+	uploadOptions UploadOptions
 }
 
 // TaskContextController exposes logic for controlling the TaskContext.
@@ -119,6 +122,13 @@ func (c *TaskContextController) CloseLog() error {
 	return c.logStream.Close()
 }
 
+// LogLocation returns the path to the file in which the task log is stored.
+//
+// This allows the log to be recovered, if the worker crashes.
+func (c *TaskContextController) LogLocation() string {
+	return c.logLocation
+}
+
 // Dispose will clean-up all resources held by the TaskContext
 func (c *TaskContextController) Dispose() error {
 	debug("disposing TaskContext")
@@ -135,6 +145,14 @@ func (c *TaskContextController) SetQueueClient(client client.Queue) {
 	c.queue = client
 }
 
+// SetSpan sets the current span for tracing, returned by TaskContext.Span().
+func (c *TaskContextController) SetSpan(span *tracing.Span) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.span = span
+}
+
 // Queue will return a client for the TaskCluster Queue.  This client
 // is useful for plugins that require interactions with the queue, such as creating
 // artifacts.
@@ -195,11 +213,25 @@ func (c *TaskContext) Err() error {
 	return nil
 }
 
-// Value returns nil, this is implemented to satisfy context.Context
+// Value returns the current span for tracing.ContextKey and nil for other
+// keys, this is implemented to satisfy context.Context
 func (c *TaskContext) Value(key interface{}) interface{} {
+	if key == tracing.ContextKey {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.span
+	}
 	return nil
 }
 
+// Span returns the current span for tracing, this is the span for the stage
+// the task is currently in, nil if tracing isn't enabled.
+func (c *TaskContext) Span() *tracing.Span {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.span
+}
+
 // Abort sets the status to aborted
 func (c *TaskContext) Abort() {
 	// TODO: (jonasfj): Remove this method TaskContext
@@ -0,0 +1,15 @@
+// Package tracing provides span-based tracing of task processing.
+//
+// A Tracer creates spans and forwards them to an exporter when they end,
+// spans are either sent to an OTLP/HTTP endpoint or written to a local file as
+// JSON. All methods on Tracer and Span are safe to call on nil, such that code
+// can create spans unconditionally, even if tracing isn't configured.
+//
+// The current span is propagated through context.Context using NewContext()
+// and FromContext(), the runtime.TaskContext returns the span for the current
+// TaskRun stage, such that engines and plugins can create child spans.
+package tracing
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("tracing")
@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fileConfig struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// fileExporter appends spans to a file as JSON, one span per line
+type fileExporter struct {
+	file *os.File
+}
+
+func newFileExporter(c fileConfig) (*fileExporter, error) {
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file '%s', error: %s", c.Path, err)
+	}
+	return &fileExporter{file: f}, nil
+}
+
+func (e *fileExporter) Export(spans []SpanData) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	_, err := e.file.Write(b.Bytes())
+	return err
+}
+
+func (e *fileExporter) Close() error {
+	return e.file.Close()
+}
+
+type otlpConfig struct {
+	Type        string            `json:"type"`
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"serviceName"`
+}
+
+// otlpExporter posts spans to an OTLP/HTTP endpoint with JSON encoding
+type otlpExporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpKeyValue
+	client   *http.Client
+}
+
+// Types for the OTLP JSON encoding, see opentelemetry-proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		result[i] = otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attributes[k]}}
+	}
+	return result
+}
+
+func newOTLPExporter(c otlpConfig, resource map[string]string) *otlpExporter {
+	attributes := copyAttributes(resource)
+	attributes["service.name"] = c.ServiceName
+	if c.ServiceName == "" {
+		attributes["service.name"] = "taskcluster-worker"
+	}
+	url := strings.TrimSuffix(c.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &otlpExporter{
+		url:      url,
+		headers:  c.Headers,
+		resource: otlpAttributes(attributes),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (e *otlpExporter) Export(spans []SpanData) error {
+	result := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		result[i] = otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusCodeOK},
+		}
+		if s.Error != "" {
+			result[i].Status = otlpStatus{Code: otlpStatusCodeError, Message: s.Error}
+		}
+	}
+	data, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: e.resource},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "taskcluster-worker"},
+				Spans: result,
+			}},
+		}},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to serialize OTLP request, error: %s", err))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("OTLP endpoint responded with status: %d, body: %s", res.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (e *otlpExporter) Close() error {
+	return nil
+}
@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// A Span represents a timed operation, spans form a tree within a trace.
+type Span struct {
+	tracer     *Tracer
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte // zero, if root span
+	name       string
+	start      time.Time
+	m          sync.Mutex
+	end        time.Time
+	attributes map[string]string
+	err        string
+	ended      bool
+}
+
+// SpanData is a snapshot of an ended span, as given to exporters.
+type SpanData struct {
+	TraceID      string            `json:"traceId"`
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Name         string            `json:"name"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Duration     float64           `json:"duration"` // milliseconds
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to read random bytes for span identifier")
+	}
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+	result := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		result[k] = v
+	}
+	return result
+}
+
+func (t *Tracer) newSpan(name string, start time.Time, attributes map[string]string) *Span {
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		start:      start,
+		attributes: copyAttributes(attributes),
+	}
+	randomID(s.spanID[:])
+	return s
+}
+
+// StartSpan starts a child span of s. Returns nil, if s is nil.
+func (s *Span) StartSpan(name string, attributes map[string]string) *Span {
+	return s.StartSpanAt(name, time.Now(), attributes)
+}
+
+// StartSpanAt starts a child span of s with a given start time. Returns nil,
+// if s is nil.
+func (s *Span) StartSpanAt(name string, start time.Time, attributes map[string]string) *Span {
+	if s == nil {
+		return nil
+	}
+	child := s.tracer.newSpan(name, start, attributes)
+	child.traceID = s.traceID
+	child.parentID = s.spanID
+	return child
+}
+
+// RecordSpan records an already completed child span of s.
+func (s *Span) RecordSpan(name string, start, end time.Time, attributes map[string]string) {
+	s.StartSpanAt(name, start, attributes).EndAt(end)
+}
+
+// SetAttribute sets an attribute on s.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks s as failed with err, this does nothing if err is nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.err = err.Error()
+}
+
+// End ends s and sends it to the exporter, calling End more than once has
+// no effect.
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt ends s at the given time, see End().
+func (s *Span) EndAt(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	if s.ended {
+		s.m.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = end
+	data := s.data()
+	s.m.Unlock()
+
+	s.tracer.export(data)
+}
+
+// TraceID returns the trace identifier as hex, or empty string if s is nil.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// data returns SpanData for s, must be called with s.m locked
+func (s *Span) data() SpanData {
+	d := SpanData{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       s.name,
+		Start:      s.start,
+		End:        s.end,
+		Duration:   float64(s.end.Sub(s.start)) / float64(time.Millisecond),
+		Attributes: copyAttributes(s.attributes),
+		Error:      s.err,
+	}
+	if s.parentID != [8]byte{} {
+		d.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	return d
+}
+
+type contextKey struct{}
+
+// ContextKey is the key for which a context.Context should return the current
+// span from Value(), this is exported so that context implementations such as
+// runtime.TaskContext can return a span.
+var ContextKey interface{} = contextKey{}
+
+// NewContext returns a context.Context that carries span.
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, ContextKey, span)
+}
+
+// FromContext returns the span carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(ContextKey).(*Span)
+	return span
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const (
+	// maxPendingSpans is the number of ended spans buffered for export, spans
+	// are dropped if the exporter can't keep up.
+	maxPendingSpans = 10000
+	// maxBatchSize is the maximum number of spans exported in one batch
+	maxBatchSize = 512
+	// exportInterval is the maximum time a span is buffered before export
+	exportInterval = 5 * time.Second
+)
+
+// An exporter sends ended spans somewhere
+type exporter interface {
+	Export(spans []SpanData) error
+	Close() error
+}
+
+// ConfigSchema for configuration given to New()
+var ConfigSchema schematypes.Schema = schematypes.OneOf{
+	otlpConfigSchema,
+	fileConfigSchema,
+}
+
+// A Tracer creates spans and exports them when they end.
+type Tracer struct {
+	exporter exporter
+	onError  func(error)
+	m        sync.Mutex
+	closed   bool
+	dropped  int
+	spans    chan SpanData
+	done     chan struct{}
+}
+
+// New creates a Tracer from config matching ConfigSchema. The resource
+// attributes are added to all spans exported by OTLP, and onError is called
+// with errors from exporting spans.
+func New(config interface{}, resource map[string]string, onError func(error)) (*Tracer, error) {
+	schematypes.MustValidate(ConfigSchema, config)
+
+	var (
+		e   exporter
+		err error
+	)
+	var oc otlpConfig
+	var fc fileConfig
+	if schematypes.MustMap(otlpConfigSchema, config, &oc) == nil {
+		e = newOTLPExporter(oc, resource)
+	} else if schematypes.MustMap(fileConfigSchema, config, &fc) == nil {
+		e, err = newFileExporter(fc)
+	} else {
+		panic("tracing config should have matched one of the options, this should be impossible")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(e, onError), nil
+}
+
+func newTracer(e exporter, onError func(error)) *Tracer {
+	t := &Tracer{
+		exporter: e,
+		onError:  onError,
+		spans:    make(chan SpanData, maxPendingSpans),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// StartSpan starts a new trace with a root span. Returns nil, if t is nil.
+func (t *Tracer) StartSpan(name string, attributes map[string]string) *Span {
+	return t.StartSpanAt(name, time.Now(), attributes)
+}
+
+// StartSpanAt starts a new trace with a root span with a given start time.
+// Returns nil, if t is nil.
+func (t *Tracer) StartSpanAt(name string, start time.Time, attributes map[string]string) *Span {
+	if t == nil {
+		return nil
+	}
+	s := t.newSpan(name, start, attributes)
+	randomID(s.traceID[:])
+	return s
+}
+
+func (t *Tracer) export(data SpanData) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.closed {
+		debug("dropping span '%s' ended after tracer was closed", data.Name)
+		return
+	}
+	select {
+	case t.spans <- data:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	flush := func() {
+		t.m.Lock()
+		dropped := t.dropped
+		t.dropped = 0
+		t.m.Unlock()
+		if dropped > 0 {
+			t.onError(fmt.Errorf("dropped %d spans, as the exporter is not keeping up", dropped))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			t.onError(fmt.Errorf("failed to export %d spans, error: %s", len(batch), err))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case data, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close exports all pending spans and closes the exporter, spans ended after
+// Close() are dropped. This is safe to call on nil.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.m.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.spans)
+	}
+	t.m.Unlock()
+
+	<-t.done
+	return t.exporter.Close()
+}
+
+var fileConfigSchema = schematypes.Object{
+	Title: "File Exporter",
+	Description: util.Markdown(`
+		Append spans to a local file as JSON, one span per line.
+	`),
+	Properties: schematypes.Properties{
+		"type": schematypes.StringEnum{Options: []string{"file"}},
+		"path": schematypes.String{
+			Title:       "Path",
+			Description: "Path of the file to append spans to.",
+		},
+	},
+	Required: []string{"type", "path"},
+}
+
+var otlpConfigSchema = schematypes.Object{
+	Title: "OTLP Exporter",
+	Description: util.Markdown(`
+		Send spans to an OpenTelemetry collector using OTLP over HTTP with JSON
+		encoding.
+	`),
+	Properties: schematypes.Properties{
+		"type": schematypes.StringEnum{Options: []string{"otlp"}},
+		"endpoint": schematypes.URI{
+			Title: "Endpoint",
+			Description: util.Markdown(`
+				Base URL of the collector, such as 'http://localhost:4318', spans
+				are posted to '/v1/traces' under this URL.
+			`),
+		},
+		"headers": schematypes.Map{
+			Title:       "Headers",
+			Description: "Additional HTTP headers for requests to the collector, such as authorization.",
+			Values:      schematypes.String{},
+		},
+		"serviceName": schematypes.String{
+			Title:       "Service Name",
+			Description: "Value of the 'service.name' resource attribute, defaults to 'taskcluster-worker'.",
+		},
+	},
+	Required: []string{"type", "endpoint"},
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.StartSpan("task", nil)
+	require.Nil(t, span)
+	child := span.StartSpan("stage", map[string]string{"k": "v"})
+	require.Nil(t, child)
+	child.SetAttribute("k", "v")
+	child.SetError(errors.New("failed"))
+	child.End()
+	require.Equal(t, "", span.TraceID())
+	require.NoError(t, tracer.Close())
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spans.json")
+	tracer, err := New(map[string]interface{}{
+		"type": "file",
+		"path": path,
+	}, nil, func(err error) {
+		t.Error("unexpected error: ", err)
+	})
+	require.NoError(t, err)
+
+	root := tracer.StartSpan("task", map[string]string{"taskId": "abc"})
+	child := root.StartSpan("stage", nil)
+	child.SetError(errors.New("stage failed"))
+	child.End()
+	child.End() // no effect
+	root.End()
+	require.NoError(t, tracer.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var spans []SpanData
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s SpanData
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &s))
+		spans = append(spans, s)
+	}
+	require.Len(t, spans, 2)
+	require.Equal(t, "stage", spans[0].Name)
+	require.Equal(t, "stage failed", spans[0].Error)
+	require.Equal(t, "task", spans[1].Name)
+	require.Equal(t, "abc", spans[1].Attributes["taskId"])
+	require.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, "", spans[1].ParentSpanID)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var requests []otlpRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req otlpRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+	defer s.Close()
+
+	tracer, err := New(map[string]interface{}{
+		"type":     "otlp",
+		"endpoint": s.URL,
+		"headers":  map[string]interface{}{"Authorization": "Bearer secret"},
+	}, map[string]string{"workerId": "w-1"}, func(err error) {
+		t.Error("unexpected error: ", err)
+	})
+	require.NoError(t, err)
+
+	root := tracer.StartSpan("task", nil)
+	root.StartSpan("stage", nil).End()
+	root.End()
+	require.NoError(t, tracer.Close())
+
+	require.Len(t, requests, 1)
+	rs := requests[0].ResourceSpans[0]
+	require.Contains(t, rs.Resource.Attributes, otlpKeyValue{"service.name", otlpAnyValue{"taskcluster-worker"}})
+	require.Contains(t, rs.Resource.Attributes, otlpKeyValue{"workerId", otlpAnyValue{"w-1"}})
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	require.Len(t, spans[0].TraceID, 32)
+	require.Len(t, spans[0].SpanID, 16)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, otlpStatusCodeOK, spans[0].Status.Code)
+}
@@ -0,0 +1,338 @@
+package runtime
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/tcqueue"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// UploadOptions controls how artifacts are uploaded by TaskContext.
+//
+// Zero values are replaced with values from DefaultUploadOptions.
+type UploadOptions struct {
+	// Blob artifacts larger than MultipartThreshold bytes are uploaded in parts
+	MultipartThreshold int64
+	// Size of parts in bytes, S3 requires at-least 5 MiB
+	PartSize int64
+	// Maximum number of parts to upload in parallel for each artifact
+	Parallelism int
+	// TemporaryStorage for compressing artifacts, if nil the system temporary
+	// folder is used.
+	TemporaryStorage TemporaryStorage
+}
+
+// DefaultUploadOptions are used when UploadOptions isn't set on TaskContext
+var DefaultUploadOptions = UploadOptions{
+	MultipartThreshold: 128 * 1024 * 1024,
+	PartSize:           64 * 1024 * 1024,
+	Parallelism:        4,
+}
+
+// minimumPartSize is the smallest part size allowed by S3
+const minimumPartSize = 5 * 1024 * 1024
+
+func (o UploadOptions) withDefaults() UploadOptions {
+	if o.MultipartThreshold <= 0 {
+		o.MultipartThreshold = DefaultUploadOptions.MultipartThreshold
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultUploadOptions.PartSize
+	}
+	if o.PartSize < minimumPartSize {
+		o.PartSize = minimumPartSize
+	}
+	if o.Parallelism <= 0 {
+		o.Parallelism = DefaultUploadOptions.Parallelism
+	}
+	return o
+}
+
+// SetUploadOptions sets the UploadOptions used when uploading artifacts.
+func (c *TaskContextController) SetUploadOptions(options UploadOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploadOptions = options
+}
+
+func (c *TaskContext) getUploadOptions() UploadOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.uploadOptions.withDefaults()
+}
+
+// compressArtifact gzips stream into a temporary file, returning the file
+// positioned at start, and the Digests of the uncompressed content.
+func compressArtifact(stream io.Reader, storage TemporaryStorage) (TemporaryFile, Digests, error) {
+	var err error
+	if storage == nil {
+		if storage, err = NewTemporaryStorage(os.TempDir()); err != nil {
+			return nil, Digests{}, errors.Wrap(err, "failed to create temporary storage")
+		}
+	}
+	file, err := storage.NewFile()
+	if err != nil {
+		return nil, Digests{}, errors.Wrap(err, "failed to create temporary file for compressing artifact")
+	}
+
+	d := newDigester()
+	zip := gzip.NewWriter(file)
+	_, err = io.Copy(zip, io.TeeReader(stream, d))
+	if err == nil {
+		err = zip.Close()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, Digests{}, errors.Wrap(err, "failed to compress artifact")
+	}
+	return file, d.Digests(), nil
+}
+
+// blobPart is a part in blobArtifactRequest
+type blobPart struct {
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// blobArtifactRequest is the request for creating an artifact with storageType
+// 'blob', which allows for multipart uploads.
+type blobArtifactRequest struct {
+	StorageType     string        `json:"storageType"`
+	Expires         tcclient.Time `json:"expires"`
+	ContentType     string        `json:"contentType"`
+	ContentEncoding string        `json:"contentEncoding,omitempty"`
+	ContentSha256   string        `json:"contentSha256"`
+	ContentLength   int64         `json:"contentLength"`
+	TransferSha256  string        `json:"transferSha256,omitempty"`
+	TransferLength  int64         `json:"transferLength,omitempty"`
+	Parts           []blobPart    `json:"parts,omitempty"`
+}
+
+// blobArtifactResponse is the response from creating a 'blob' artifact
+type blobArtifactResponse struct {
+	StorageType string `json:"storageType"`
+	Requests    []struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+	} `json:"requests"`
+}
+
+// hashParts reads r and returns sha256 and size of r, as well as of each part
+// of partSize bytes.
+func hashParts(r io.Reader, partSize int64) (string, int64, []blobPart, error) {
+	var parts []blobPart
+	var size int64
+	h := sha256.New()
+	for {
+		ph := sha256.New()
+		n, err := io.CopyN(io.MultiWriter(h, ph), r, partSize)
+		if n > 0 {
+			parts = append(parts, blobPart{
+				Sha256: hex.EncodeToString(ph.Sum(nil)),
+				Size:   n,
+			})
+			size += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, nil, err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, parts, nil
+}
+
+// hashContent returns the sha256 and size of the decoded content of r
+func hashContent(r io.Reader, encoding string) (string, int64, error) {
+	if encoding == "gzip" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return "", 0, errors.Wrap(err, "failed to decode gzip encoded artifact")
+		}
+		defer zr.Close()
+		r = zr
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// digester is an io.Writer that computes Digests of everything written
+type digester struct {
+	sha256 hash.Hash
+	size   int64
+}
+
+func newDigester() *digester {
+	return &digester{sha256: sha256.New()}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.sha256.Write(p)
+	d.size += int64(len(p))
+	return len(p), nil
+}
+
+// Digests returns the Digests of data written so far
+func (d *digester) Digests() Digests {
+	return Digests{
+		Sha256: hex.EncodeToString(d.sha256.Sum(nil)),
+		Size:   d.size,
+	}
+}
+
+// computeDigests returns the Digests of r
+func computeDigests(r io.Reader) (Digests, error) {
+	d := newDigester()
+	if _, err := io.Copy(d, r); err != nil {
+		return Digests{}, err
+	}
+	return d.Digests(), nil
+}
+
+// readerAt returns r as an io.ReaderAt, wrapping it with a lock if needed
+func readerAt(r io.ReadSeeker) io.ReaderAt {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra
+	}
+	return &lockedReaderAt{r: r}
+}
+
+// lockedReaderAt implements io.ReaderAt by seeking under a lock
+type lockedReaderAt struct {
+	m sync.Mutex
+	r io.ReadSeeker
+}
+
+func (l *lockedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, err := l.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(l.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// uploadBlob uploads stream as a blob artifact, if stream is larger than
+// options.MultipartThreshold it is uploaded in parts. Parts are uploaded in
+// parallel and each part is retried on failure.
+//
+// If stream is encoded and contentSha256 is empty, the content hash and size
+// is computed by decoding stream.
+func (context *TaskContext) uploadBlob(
+	artifact BlobArtifact, stream io.ReadSeeker, encoding string,
+	contentSha256 string, contentLength int64, options UploadOptions,
+) error {
+	// Compute hashes of the transfer and each part
+	if _, err := stream.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start of artifact")
+	}
+	transferSha256, transferLength, parts, err := hashParts(stream, options.PartSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash artifact")
+	}
+
+	req := blobArtifactRequest{
+		StorageType:   "blob",
+		Expires:       tcclient.Time(artifact.Expires),
+		ContentType:   artifact.Mimetype,
+		ContentSha256: transferSha256,
+		ContentLength: transferLength,
+	}
+	if encoding != "" && encoding != "identity" {
+		if contentSha256 == "" {
+			if _, err = stream.Seek(0, io.SeekStart); err != nil {
+				return errors.Wrap(err, "failed to seek to start of artifact")
+			}
+			if contentSha256, contentLength, err = hashContent(stream, encoding); err != nil {
+				return err
+			}
+		}
+		req.ContentEncoding = encoding
+		req.ContentSha256 = contentSha256
+		req.ContentLength = contentLength
+		req.TransferSha256 = transferSha256
+		req.TransferLength = transferLength
+	}
+	if transferLength > options.MultipartThreshold {
+		req.Parts = parts
+	} else {
+		// Upload as a single part, if not multipart
+		parts = []blobPart{{Sha256: transferSha256, Size: transferLength}}
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
+	}
+	parsed, err := context.createArtifact(artifact.Name, data)
+	if err != nil {
+		return err
+	}
+	var resp blobArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		return errors.Wrap(err, "failed to parse response from createArtifact")
+	}
+	if len(resp.Requests) != len(parts) {
+		return errors.Errorf(
+			"expected %d requests from createArtifact, got %d", len(parts), len(resp.Requests),
+		)
+	}
+
+	// Upload parts in parallel
+	ra := readerAt(stream)
+	etags := make([]string, len(parts))
+	errs := make([]error, len(parts))
+	util.SpawnWithLimit(len(parts), options.Parallelism, func(i int) {
+		r := resp.Requests[i]
+		header := make(http.Header)
+		for k, v := range r.Headers {
+			header.Set(k, v)
+		}
+		offset := int64(i) * options.PartSize
+		part := io.NewSectionReader(ra, offset, parts[i].Size)
+		debug("uploading part %d of %d for artifact: %s", i+1, len(parts), artifact.Name)
+		var h http.Header
+		h, errs[i] = uploadRequest(r.Method, r.URL, header, part, parts[i].Size)
+		if errs[i] == nil {
+			etags[i] = h.Get("ETag")
+		}
+	})
+	for i, err := range errs {
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload part %d of %d", i+1, len(parts))
+		}
+	}
+
+	// Complete the artifact
+	return context.Queue().CompleteArtifact(
+		context.TaskID, strconv.Itoa(context.RunID), artifact.Name,
+		&tcqueue.CompleteArtifactRequest{Etags: etags},
+	)
+}
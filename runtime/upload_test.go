@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-client-go/tcqueue"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestHashParts(t *testing.T) {
+	data := []byte("hello world!")
+	sha, size, parts, err := hashParts(bytes.NewReader(data), 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), size)
+	sum := sha256.Sum256(data)
+	require.Equal(t, hex.EncodeToString(sum[:]), sha)
+	require.Len(t, parts, 3)
+	for i, p := range parts {
+		end := (i + 1) * 5
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[i*5 : end])
+		require.Equal(t, hex.EncodeToString(sum[:]), p.Sha256)
+		require.Equal(t, int64(end-i*5), p.Size)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	// Create 11 MiB of data, giving 3 parts of 5 MiB
+	data := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+
+	var m sync.Mutex
+	received := make(map[string][]byte)
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		m.Lock()
+		defer m.Unlock()
+		// Fail the second part once, to test that parts are retried
+		if r.URL.Path == "/part/1" && !failed {
+			failed = true
+			w.WriteHeader(500)
+			return
+		}
+		received[r.URL.Path] = body
+		w.Header().Set("ETag", "etag-"+strings.TrimPrefix(r.URL.Path, "/part/"))
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	resp := blobArtifactResponse{StorageType: "blob"}
+	for i := 0; i < 3; i++ {
+		resp.Requests = append(resp.Requests, struct {
+			URL     string            `json:"url"`
+			Method  string            `json:"method"`
+			Headers map[string]string `json:"headers"`
+		}{
+			URL:     fmt.Sprintf("%s/part/%d", ts.URL, i),
+			Method:  "PUT",
+			Headers: map[string]string{"Content-Type": "application/octet-stream"},
+		})
+	}
+	respData, _ := json.Marshal(resp)
+
+	context, mockedQueue := setupArtifactTest("public/large.bin", respData)
+	controller := &TaskContextController{context}
+	controller.SetUploadOptions(UploadOptions{
+		MultipartThreshold: 1024,
+		PartSize:           5 * 1024 * 1024,
+		Parallelism:        2,
+	})
+	mockedQueue.On(
+		"CompleteArtifact", context.TaskID, "0", "public/large.bin",
+		&tcqueue.CompleteArtifactRequest{Etags: []string{"etag-0", "etag-1", "etag-2"}},
+	).Return(nil)
+
+	_, err := context.UploadBlobArtifact(BlobArtifact{
+		Name:     "public/large.bin",
+		Mimetype: "application/octet-stream",
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+	require.NoError(t, err)
+	mockedQueue.AssertExpectations(t)
+
+	// Check that the blob request declared the parts
+	req := mockedQueue.Calls[0].Arguments.Get(3).(*tcqueue.PostArtifactRequest)
+	var blobReq blobArtifactRequest
+	require.NoError(t, json.Unmarshal(*req, &blobReq))
+	require.Equal(t, "blob", blobReq.StorageType)
+	require.Equal(t, int64(len(data)), blobReq.ContentLength)
+	require.Len(t, blobReq.Parts, 3)
+
+	uploaded := bytes.Join([][]byte{
+		received["/part/0"], received["/part/1"], received["/part/2"],
+	}, nil)
+	require.True(t, bytes.Equal(data, uploaded), "uploaded data doesn't match")
+}
+
+func TestLargeS3ArtifactHeaders(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+
+	var received []byte
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	s3resp, _ := json.Marshal(tcqueue.S3ArtifactResponse{
+		StorageType: "s3",
+		PutURL:      ts.URL,
+	})
+	context, mockedQueue := setupArtifactTest("public/large.txt", s3resp)
+	controller := &TaskContextController{context}
+	controller.SetUploadOptions(UploadOptions{
+		MultipartThreshold: 1024,
+	})
+
+	err := context.UploadS3Artifact(S3Artifact{
+		Name:     "public/large.txt",
+		Mimetype: "text/plain; charset=utf-8",
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+		AdditionalHeaders: map[string]string{
+			"Content-Disposition": "attachment; filename=large.txt",
+			"X-Custom-Header":     "custom-value",
+		},
+	})
+	require.NoError(t, err)
+	mockedQueue.AssertExpectations(t)
+
+	// Check that the artifact wasn't turned into a blob artifact
+	req := mockedQueue.Calls[0].Arguments.Get(3).(*tcqueue.PostArtifactRequest)
+	var s3req tcqueue.S3ArtifactRequest
+	require.NoError(t, json.Unmarshal(*req, &s3req))
+	require.Equal(t, "s3", s3req.StorageType)
+
+	require.Equal(t, data, received)
+	require.Equal(t, "attachment; filename=large.txt", header.Get("Content-Disposition"))
+	require.Equal(t, "custom-value", header.Get("X-Custom-Header"))
+}
+
+func TestGzipEncodedArtifact(t *testing.T) {
+	data := []byte(strings.Repeat("hello world\n", 1000))
+
+	var received []byte
+	var encoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		encoding = r.Header.Get("Content-Encoding")
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	s3resp, _ := json.Marshal(tcqueue.S3ArtifactResponse{
+		PutURL: ts.URL,
+	})
+	context, mockedQueue := setupArtifactTest("public/hello.txt", s3resp)
+
+	err := context.UploadS3Artifact(S3Artifact{
+		Name:            "public/hello.txt",
+		Mimetype:        "text/plain; charset=utf-8",
+		Stream:          ioext.NopCloser(bytes.NewReader(data)),
+		ContentEncoding: "gzip",
+	})
+	require.NoError(t, err)
+	mockedQueue.AssertExpectations(t)
+
+	require.Equal(t, "gzip", encoding)
+	require.True(t, len(received) < len(data), "expected data to be compressed")
+	zr, err := gzip.NewReader(bytes.NewReader(received))
+	require.NoError(t, err)
+	decoded, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+}
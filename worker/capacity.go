@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"math"
+	goruntime "runtime"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type taskSize struct {
+	Memory    int64   `json:"memory"`
+	DiskSpace int64   `json:"diskSpace"`
+	CPUs      float64 `json:"cpus"`
+}
+
+type capacityConfig struct {
+	TaskSize    taskSize            `json:"taskSize"`
+	WorkerTypes map[string]taskSize `json:"workerTypes"`
+}
+
+var taskSizeSchema = schematypes.Object{
+	Title: "Task Size",
+	Description: util.Markdown(`
+		Resources a task is expected to use, properties that are omitted or
+		zero are not used to limit capacity.
+	`),
+	Properties: schematypes.Properties{
+		"memory": schematypes.Integer{
+			Title:       "Memory",
+			Description: "Memory in bytes a task is expected to use.",
+			Minimum:     0,
+			Maximum:     math.MaxInt64,
+		},
+		"diskSpace": schematypes.Integer{
+			Title:       "Disk Space",
+			Description: "Disk space in bytes a task is expected to use.",
+			Minimum:     0,
+			Maximum:     math.MaxInt64,
+		},
+		"cpus": schematypes.Number{
+			Title:       "CPUs",
+			Description: "Number of CPUs a task is expected to use, this may be a fraction.",
+			Minimum:     0,
+			Maximum:     1024,
+		},
+	},
+}
+
+var capacityConfigSchema = schematypes.Object{
+	Title: "Capacity Policy",
+	Description: util.Markdown(`
+		Policy for deciding how many tasks to claim, when given the worker will
+		only claim as many tasks as it has resources available for.
+
+		Each time the worker claims tasks, the number of tasks claimed is
+		limited by 'worker.concurrency', the 'MaxConcurrency' of the engine, the
+		number of CPUs, and the disk space and memory available beyond
+		'minimumDiskSpace' and 'minimumMemory', divided by the expected task size.
+		Resources used by tasks already running are reflected in available disk
+		space and memory, hence, the task size should be estimated generously.
+		When no tasks are running, one task is claimed, unless disk space or
+		memory is below the minimum.
+	`),
+	Properties: schematypes.Properties{
+		"taskSize": taskSizeSchema,
+		"workerTypes": schematypes.Map{
+			Title: "Task Size by WorkerType",
+			Description: util.Markdown(`
+				Mapping from workerType to expected task size, this overrides
+				'taskSize' for the given workerType. This allows the same
+				configuration to be used for multiple workerTypes.
+			`),
+			Values: taskSizeSchema,
+		},
+	},
+	Required: []string{"taskSize"},
+}
+
+// capacityPolicy decides how many tasks to claim given available resources
+type capacityPolicy struct {
+	maxConcurrency int // upper limit on number of active tasks
+	size           taskSize
+	cpus           int
+	resources      availableResources
+	monitor        runtime.Monitor
+}
+
+// availableResources is the interface needed to measure and free resources,
+// this is satisfied by *gc.GarbageCollector.
+type availableResources interface {
+	AvailableDiskSpace() (int64, error)
+	AvailableMemory() (int64, error)
+	Collect() error
+}
+
+// newCapacityPolicy creates a capacityPolicy for workerType, limited by
+// concurrency and engineMaxConcurrency (0, if unlimited).
+func newCapacityPolicy(
+	c capacityConfig, workerType string, concurrency, engineMaxConcurrency int,
+	resources availableResources, monitor runtime.Monitor,
+) *capacityPolicy {
+	size := c.TaskSize
+	if s, ok := c.WorkerTypes[workerType]; ok {
+		size = s
+	}
+	max := concurrency
+	if engineMaxConcurrency > 0 && engineMaxConcurrency < max {
+		max = engineMaxConcurrency
+	}
+	return &capacityPolicy{
+		maxConcurrency: max,
+		size:           size,
+		cpus:           goruntime.NumCPU(),
+		resources:      resources,
+		monitor:        monitor,
+	}
+}
+
+// Capacity returns the number of tasks that should be claimed, given the
+// number of tasks currently active.
+func (p *capacityPolicy) Capacity(active int) int {
+	N := p.maxConcurrency - active
+	if p.size.CPUs > 0 {
+		if n := int(float64(p.cpus)/p.size.CPUs) - active; n < N {
+			debug("capacity limited by CPUs to %d", n)
+			N = n
+		}
+	}
+	if N <= 0 {
+		return 0
+	}
+
+	// If available resources are below the minimum required by the garbage
+	// collector, or don't allow for a single task, we run it to reclaim
+	// resources and measure again.
+	n, belowMinimum, err := p.resourceCapacity()
+	if err == nil && (belowMinimum || n < 1) {
+		debug("resources below minimum or task size, running garbage collector")
+		if err = p.resources.Collect(); err != nil {
+			p.monitor.ReportWarning(err, "garbage collection failed")
+		}
+		n, belowMinimum, err = p.resourceCapacity()
+	}
+	if err != nil {
+		p.monitor.ReportWarning(err, "failed to measure available resources")
+		return 0
+	}
+	// The garbage collector only frees resources down to the minimum, so an
+	// idle worker may never have resources for a task while cached resources
+	// hold the space. Hence, we always allow one task when none are running,
+	// unless resources are below the minimum.
+	if n < 1 && active == 0 && !belowMinimum {
+		debug("resources below task size, allowing one task as none are running")
+		n = 1
+	}
+	if n < N {
+		N = n
+	}
+	if N < 0 {
+		N = 0
+	}
+	return N
+}
+
+// resourceCapacity returns the number of tasks that available memory and disk
+// space allows for, math.MaxInt32 if task size doesn't limit either. Returns
+// true, if available memory or disk space is below the minimum.
+func (p *capacityPolicy) resourceCapacity() (int, bool, error) {
+	N := math.MaxInt32
+	belowMinimum := false
+	if p.size.Memory > 0 {
+		available, err := p.resources.AvailableMemory()
+		if err != nil {
+			return 0, false, err
+		}
+		if n := int(available / p.size.Memory); n < N {
+			N = n
+		}
+		belowMinimum = belowMinimum || available < 0
+	}
+	if p.size.DiskSpace > 0 {
+		available, err := p.resources.AvailableDiskSpace()
+		if err != nil {
+			return 0, false, err
+		}
+		if n := int(available / p.size.DiskSpace); n < N {
+			N = n
+		}
+		belowMinimum = belowMinimum || available < 0
+	}
+	return N, belowMinimum, nil
+}
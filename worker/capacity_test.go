@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+type fakeResources struct {
+	disk      int64
+	memory    int64
+	reclaim   int64 // memory freed by Collect()
+	collected int
+}
+
+func (r *fakeResources) AvailableDiskSpace() (int64, error) {
+	return r.disk, nil
+}
+
+func (r *fakeResources) AvailableMemory() (int64, error) {
+	return r.memory, nil
+}
+
+func (r *fakeResources) Collect() error {
+	r.collected++
+	r.memory += r.reclaim
+	r.reclaim = 0
+	return nil
+}
+
+func TestCapacityPolicy(t *testing.T) {
+	const GB = 1024 * 1024 * 1024
+	r := &fakeResources{disk: 100 * GB, memory: 10 * GB}
+	c := capacityConfig{
+		TaskSize: taskSize{Memory: 2 * GB, DiskSpace: 10 * GB},
+		WorkerTypes: map[string]taskSize{
+			"small": {Memory: 1 * GB},
+		},
+	}
+	monitor := mocks.NewMockMonitor(true)
+
+	t.Run("limited by memory", func(t *testing.T) {
+		p := newCapacityPolicy(c, "default", 10, 0, r, monitor)
+		require.Equal(t, 5, p.Capacity(0))
+		require.Equal(t, 0, r.collected, "expected no garbage collection above minimum")
+	})
+
+	t.Run("limited by concurrency", func(t *testing.T) {
+		p := newCapacityPolicy(c, "small", 4, 0, r, monitor)
+		require.Equal(t, 3, p.Capacity(1))
+	})
+
+	t.Run("limited by engine", func(t *testing.T) {
+		p := newCapacityPolicy(c, "small", 10, 2, r, monitor)
+		require.Equal(t, 2, p.Capacity(0))
+		require.Equal(t, 0, p.Capacity(2))
+	})
+
+	t.Run("limited by CPUs", func(t *testing.T) {
+		p := newCapacityPolicy(capacityConfig{
+			TaskSize: taskSize{CPUs: 2},
+		}, "default", 100, 0, r, monitor)
+		p.cpus = 8
+		require.Equal(t, 4, p.Capacity(0))
+		require.Equal(t, 1, p.Capacity(3))
+	})
+
+	t.Run("reclaim memory", func(t *testing.T) {
+		r := &fakeResources{disk: 100 * GB, memory: -1 * GB, reclaim: 5 * GB}
+		p := newCapacityPolicy(c, "default", 10, 0, r, monitor)
+		require.Equal(t, 2, p.Capacity(0))
+		require.Equal(t, 1, r.collected)
+	})
+
+	t.Run("idle below task size", func(t *testing.T) {
+		r := &fakeResources{disk: 100 * GB, memory: 3 * GB / 2}
+		p := newCapacityPolicy(c, "default", 10, 0, r, monitor)
+		require.Equal(t, 1, p.Capacity(0), "expected one task when idle")
+		require.Equal(t, 1, r.collected)
+		require.Equal(t, 0, p.Capacity(1), "expected no tasks when busy")
+	})
+
+	t.Run("out of disk space", func(t *testing.T) {
+		r := &fakeResources{disk: -GB, memory: 10 * GB}
+		p := newCapacityPolicy(c, "default", 10, 0, r, monitor)
+		require.Equal(t, 0, p.Capacity(0))
+	})
+}
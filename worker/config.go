@@ -8,6 +8,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
 )
@@ -22,6 +23,8 @@ type options struct {
 	MinimumReclaimDelay int    `json:"minimumReclaimDelay"`
 	Concurrency         int    `json:"concurrency"`
 	EnableSuperseding   bool   `json:"enableSuperseding"`
+	PauseFile           string `json:"pauseFile"`
+	ClaimsJournal       string `json:"claimsJournal"`
 }
 
 type configType struct {
@@ -33,6 +36,10 @@ type configType struct {
 	MinimumDiskSpace int64                  `json:"minimumDiskSpace"`
 	MinimumMemory    int64                  `json:"minimumMemory"`
 	Monitor          interface{}            `json:"monitor"`
+	Tracing          interface{}            `json:"tracing"`
+	StatusAPI        *statusAPIConfig       `json:"statusApi"`
+	Capacity         *capacityConfig        `json:"capacity"`
+	ArtifactUploads  *artifactUploadsConfig `json:"artifactUploads"`
 	Credentials      tcclient.Credentials   `json:"credentials"`
 	QueueBaseURL     string                 `json:"queueBaseUrl"`
 	AuthBaseURL      string                 `json:"authBaseUrl"`
@@ -105,10 +112,36 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 			Maximum: 10 * 60,
 		},
 		"concurrency": schematypes.Integer{
-			Title:       "Concurrency",
-			Description: "The number of tasks that this worker supports running in parallel.",
-			Minimum:     1,
-			Maximum:     1000,
+			Title: "Concurrency",
+			Description: util.Markdown(`
+				The number of tasks that this worker supports running in parallel.
+				If a capacity policy is configured, this is the upper limit.
+			`),
+			Minimum: 1,
+			Maximum: 1000,
+		},
+		"pauseFile": schematypes.String{
+			Title: "Pause File",
+			Description: util.Markdown(`
+				Path to a file which pauses claiming of tasks while it exists.
+				Tasks being processed are not affected, this is useful for host
+				maintenance without restarting the worker. Claiming can also be
+				paused with 'SIGUSR1' and resumed with 'SIGUSR2', or through the
+				status API.
+			`),
+		},
+		"claimsJournal": schematypes.String{
+			Title: "Claims Journal",
+			Description: util.Markdown(`
+				Path to a file in which active claims are recorded. If the worker
+				crashes or the host reboots, claims found in this file on startup
+				are resolved as 'worker-shutdown' and task logs are uploaded, if
+				they can be recovered. This way tasks are retried promptly, rather
+				than when the claim expires. Claims that can't be resolved are kept
+				in the file until a later startup, or until they expire. The file
+				must be on persistent storage, and task logs can only be recovered
+				if 'temporaryFolder' is too.
+			`),
 		},
 		"enableSuperseding": schematypes.Boolean{
 			Title: "Enable Superseding",
@@ -133,6 +166,45 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 	},
 }
 
+type artifactUploadsConfig struct {
+	MultipartThreshold int64 `json:"multipartThreshold"`
+	PartSize           int64 `json:"partSize"`
+	Parallelism        int   `json:"parallelism"`
+}
+
+var artifactUploadsConfigSchema = schematypes.Object{
+	Title: "Artifact Uploads",
+	Description: util.Markdown(`
+		Options for uploading blob artifacts. Large blob artifacts are uploaded
+		in parts, each part is retried individually, and parts are uploaded in
+		parallel. Artifacts with the 's3' storage type are always uploaded in a
+		single request.
+	`),
+	Properties: schematypes.Properties{
+		"multipartThreshold": schematypes.Integer{
+			Title: "Multipart Threshold",
+			Description: util.Markdown(`
+				Blob artifacts larger than this number of bytes are uploaded in
+				parts, defaults to 128 MiB.
+			`),
+			Minimum: 5 * 1024 * 1024,
+			Maximum: math.MaxInt64,
+		},
+		"partSize": schematypes.Integer{
+			Title:       "Part Size",
+			Description: "Size of parts in bytes, defaults to 64 MiB.",
+			Minimum:     5 * 1024 * 1024,
+			Maximum:     5 * 1024 * 1024 * 1024,
+		},
+		"parallelism": schematypes.Integer{
+			Title:       "Parallelism",
+			Description: "Number of parts to upload in parallel for each artifact, defaults to 4.",
+			Minimum:     1,
+			Maximum:     64,
+		},
+	},
+}
+
 var credentialsSchema schematypes.Schema = schematypes.Object{
 	Title: "TaskCluster Credentials",
 	Description: util.Markdown(`
@@ -224,11 +296,15 @@ func ConfigSchema() schematypes.Object {
 				Minimum: 0,
 				Maximum: math.MaxInt64,
 			},
-			"monitor":      monitoring.ConfigSchema,
-			"credentials":  credentialsSchema,
-			"queueBaseUrl": schematypes.String{},
-			"authBaseUrl":  schematypes.String{},
-			"worker":       optionsSchema,
+			"monitor":         monitoring.ConfigSchema,
+			"tracing":         tracing.ConfigSchema,
+			"statusApi":       statusAPIConfigSchema,
+			"capacity":        capacityConfigSchema,
+			"artifactUploads": artifactUploadsConfigSchema,
+			"credentials":     credentialsSchema,
+			"queueBaseUrl":    schematypes.String{},
+			"authBaseUrl":     schematypes.String{},
+			"worker":          optionsSchema,
 		},
 		Required: []string{
 			"engine",
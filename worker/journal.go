@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+)
+
+// journalEntry is an active claim recorded in the claimJournal
+type journalEntry struct {
+	TaskID      string               `json:"taskId"`
+	RunID       int                  `json:"runId"`
+	TakenUntil  time.Time            `json:"takenUntil"`
+	Expires     time.Time            `json:"expires"` // when the task expires
+	Credentials tcclient.Credentials `json:"credentials"`
+	LogFile     string               `json:"logFile"` // empty, if there is no log
+}
+
+// claimJournal is an on-disk journal of active claims, such that claims can be
+// resolved if the worker is restarted after a crash.
+//
+// The journal is rewritten atomically whenever it changes, all methods are
+// no-ops on a nil claimJournal.
+type claimJournal struct {
+	m       sync.Mutex
+	path    string
+	entries []journalEntry
+}
+
+// openClaimJournal opens the journal at path, and returns entries left in the
+// journal from a previous run. These entries are kept in the journal until they
+// are removed, such that they aren't lost if resolving them fails.
+func openClaimJournal(path string) (*claimJournal, []journalEntry, error) {
+	j := &claimJournal{path: path}
+
+	var orphans []journalEntry
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "failed to read claims journal")
+	}
+	if err == nil && len(data) > 0 {
+		if err = json.Unmarshal(data, &orphans); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse claims journal")
+		}
+	}
+
+	// Write the journal, this ensures that we can write the journal
+	j.entries = append(j.entries, orphans...)
+	if err = j.write(); err != nil {
+		return nil, nil, err
+	}
+	return j, orphans, nil
+}
+
+// Add an entry to the journal
+func (j *claimJournal) Add(entry journalEntry) error {
+	if j == nil {
+		return nil
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.entries = append(j.entries, entry)
+	return j.write()
+}
+
+// Update takenUntil and credentials for the entry given by taskID and runID
+func (j *claimJournal) Update(taskID string, runID int, takenUntil time.Time, creds tcclient.Credentials) error {
+	if j == nil {
+		return nil
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	for i, e := range j.entries {
+		if e.TaskID == taskID && e.RunID == runID {
+			j.entries[i].TakenUntil = takenUntil
+			j.entries[i].Credentials = creds
+		}
+	}
+	return j.write()
+}
+
+// Remove the entry given by taskID and runID
+func (j *claimJournal) Remove(taskID string, runID int) error {
+	if j == nil {
+		return nil
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	entries := j.entries[:0]
+	for _, e := range j.entries {
+		if e.TaskID != taskID || e.RunID != runID {
+			entries = append(entries, e)
+		}
+	}
+	j.entries = entries
+	return j.write()
+}
+
+// write the journal to disk, caller must hold the lock
+func (j *claimJournal) write() error {
+	entries := j.entries
+	if entries == nil {
+		entries = []journalEntry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize claims journal"))
+	}
+
+	// Write to a temporary file, sync and rename to replace atomically, the
+	// journal holds credentials so only the owner may read it.
+	tmp := filepath.Join(filepath.Dir(j.path), "."+filepath.Base(j.path)+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create claims journal")
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, j.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to write claims journal")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+)
+
+func TestClaimJournal(t *testing.T) {
+	folder := filepath.Join(os.TempDir(), slugid.Nice())
+	require.NoError(t, os.MkdirAll(folder, 0700))
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "claims.json")
+
+	t.Log("open empty journal")
+	j, orphans, err := openClaimJournal(path)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+
+	t.Log("add, update and remove entries")
+	takenUntil := time.Now().Add(20 * time.Minute).Round(time.Second).UTC()
+	require.NoError(t, j.Add(journalEntry{
+		TaskID:      "task-1",
+		RunID:       0,
+		TakenUntil:  time.Now().UTC(),
+		Credentials: tcclient.Credentials{ClientID: "client-1", AccessToken: "token-1"},
+		LogFile:     "/tmp/log-1",
+	}))
+	require.NoError(t, j.Add(journalEntry{
+		TaskID: "task-2",
+		RunID:  1,
+	}))
+	require.NoError(t, j.Update("task-1", 0, takenUntil, tcclient.Credentials{
+		ClientID:    "client-1",
+		AccessToken: "token-2",
+	}))
+	require.NoError(t, j.Remove("task-2", 1))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm(), "journal holds credentials")
+
+	t.Log("reopen journal to find orphaned claims")
+	j, orphans, err = openClaimJournal(path)
+	require.NoError(t, err)
+	require.Len(t, orphans, 1)
+	require.Equal(t, "task-1", orphans[0].TaskID)
+	require.Equal(t, "token-2", orphans[0].Credentials.AccessToken)
+	require.Equal(t, "/tmp/log-1", orphans[0].LogFile)
+	require.True(t, takenUntil.Equal(orphans[0].TakenUntil))
+
+	t.Log("orphans are kept until removed")
+	j, orphans, err = openClaimJournal(path)
+	require.NoError(t, err)
+	require.Len(t, orphans, 1)
+	require.NoError(t, j.Remove("task-1", 0))
+	_, orphans, err = openClaimJournal(path)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+
+	t.Log("nil journal is a no-op")
+	j = nil
+	require.NoError(t, j.Add(journalEntry{TaskID: "task-3"}))
+	require.NoError(t, j.Remove("task-3", 0))
+}
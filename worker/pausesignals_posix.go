@@ -0,0 +1,35 @@
+// +build !windows
+
+package worker
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handlePauseSignals pauses claiming on SIGUSR1 and resumes claiming on
+// SIGUSR2, until the returned function is called.
+func (w *Worker) handlePauseSignals() func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-c:
+				if s == syscall.SIGUSR1 {
+					w.Pause()
+				} else {
+					w.Resume()
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
@@ -0,0 +1,6 @@
+package worker
+
+// handlePauseSignals does nothing, as windows doesn't have SIGUSR1 and SIGUSR2
+func (w *Worker) handlePauseSignals() func() {
+	return func() {}
+}
@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type statusAPIConfig struct {
+	Address string `json:"address"`
+	Token   string `json:"token"`
+}
+
+var statusAPIConfigSchema = schematypes.Object{
+	Title: "Status API",
+	Description: util.Markdown(`
+		Local HTTP API for inspecting and controlling the worker. All requests
+		must carry the header 'Authorization: Bearer <token>'.
+
+		 * 'GET /status' returns active tasks, uptime, resources tracked by the
+		   garbage collector and cache contents,
+		 * 'POST /stop-gracefully' stops claiming tasks and exits when active
+		   tasks are resolved,
+		 * 'POST /stop-now' aborts active tasks and exits,
+		 * 'POST /pause' stops claiming tasks until resumed, and
+		 * 'POST /resume' resumes claiming tasks.
+
+		Actions return the status after the action has been applied.
+	`),
+	Properties: schematypes.Properties{
+		"address": schematypes.String{
+			Title: "Listen Address",
+			Description: util.Markdown(`
+				Address to listen on, such as '127.0.0.1:60024'. This API is not
+				intended to be exposed to the internet.
+			`),
+		},
+		"token": schematypes.String{
+			Title:       "Token",
+			Description: "Secret token required to access the API.",
+			Pattern:     `^.{16,}$`,
+		},
+	},
+	Required: []string{"address", "token"},
+}
+
+type taskStatus struct {
+	TaskID   string    `json:"taskId"`
+	RunID    int       `json:"runId"`
+	Stage    string    `json:"stage"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"` // seconds
+}
+
+type workerStatus struct {
+	ProvisionerID      string            `json:"provisionerId"`
+	WorkerType         string            `json:"workerType"`
+	WorkerGroup        string            `json:"workerGroup"`
+	WorkerID           string            `json:"workerId"`
+	Started            time.Time         `json:"started"`
+	Uptime             float64           `json:"uptime"`   // seconds
+	IdleTime           float64           `json:"idleTime"` // seconds
+	Concurrency        int               `json:"concurrency"`
+	Paused             bool              `json:"paused"`
+	StoppingGracefully bool              `json:"stoppingGracefully"`
+	StoppingNow        bool              `json:"stoppingNow"`
+	Tasks              []taskStatus      `json:"tasks"`
+	Resources          []gc.ResourceInfo `json:"resources"`
+}
+
+// statusAPI implements the status API as an http.Handler
+type statusAPI struct {
+	worker *Worker
+	token  string
+	mux    *http.ServeMux
+}
+
+func newStatusAPI(w *Worker, token string) *statusAPI {
+	a := &statusAPI{
+		worker: w,
+		token:  token,
+		mux:    http.NewServeMux(),
+	}
+	a.mux.HandleFunc("/status", a.handleStatus)
+	a.mux.HandleFunc("/stop-gracefully", a.action(w.StopGracefully))
+	a.mux.HandleFunc("/stop-now", a.action(w.StopNow))
+	a.mux.HandleFunc("/pause", a.action(w.Pause))
+	a.mux.HandleFunc("/resume", a.action(w.Resume))
+	return a
+}
+
+func (a *statusAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(a.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *statusAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.reply(w)
+}
+
+// action returns a handler that calls fn for POST requests
+func (a *statusAPI) action(fn func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		debug("status API: %s", r.URL.Path)
+		fn()
+		a.reply(w)
+	}
+}
+
+func (a *statusAPI) reply(w http.ResponseWriter) {
+	data, err := json.MarshalIndent(a.status(), "", "  ")
+	if err != nil {
+		panic(err) // status is always serializable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (a *statusAPI) status() workerStatus {
+	w := a.worker
+	now := time.Now()
+	s := workerStatus{
+		ProvisionerID:      w.options.ProvisionerID,
+		WorkerType:         w.options.WorkerType,
+		WorkerGroup:        w.options.WorkerGroup,
+		WorkerID:           w.options.WorkerID,
+		Started:            w.startTime,
+		Uptime:             now.Sub(w.startTime).Seconds(),
+		IdleTime:           w.activeTasks.IdleTime().Seconds(),
+		Concurrency:        w.options.Concurrency,
+		Paused:             w.Paused(),
+		StoppingGracefully: w.lifeCycleTracker.StoppingGracefully.IsDone(),
+		StoppingNow:        w.lifeCycleTracker.StoppingNow.IsDone(),
+		Tasks:              []taskStatus{},
+		Resources:          w.garbageCollector.Resources(),
+	}
+	for _, t := range w.activeTasks.Tasks() {
+		stage := ""
+		if t.Run != nil {
+			stage = t.Run.Stage()
+		}
+		s.Tasks = append(s.Tasks, taskStatus{
+			TaskID:   t.TaskID,
+			RunID:    t.RunID,
+			Stage:    stage,
+			Started:  t.Started,
+			Duration: now.Sub(t.Started).Seconds(),
+		})
+	}
+	return s
+}
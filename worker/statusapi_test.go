@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusAPI(t *testing.T) {
+	w := setupTestWorker(t, "http://localhost:0", 1)
+	defer w.dispose()
+
+	const token = "my-secret-status-api-token"
+	api := newStatusAPI(w, token)
+	request := func(method, path, token string) (int, workerStatus) {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, r)
+		var s workerStatus
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+		}
+		return rec.Code, s
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		code, _ := request("GET", "/status", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = request("POST", "/stop-now", "wrong-token")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.False(t, w.lifeCycleTracker.StoppingNow.IsDone())
+	})
+
+	t.Run("status", func(t *testing.T) {
+		task := &activeTask{TaskID: "my-task-id", RunID: 2}
+		w.activeTasks.Track(task)
+		defer w.activeTasks.Untrack(task)
+
+		code, s := request("GET", "/status", token)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "test-worker-id", s.WorkerID)
+		assert.Equal(t, 1, s.Concurrency)
+		assert.False(t, s.Paused)
+		require.Len(t, s.Tasks, 1)
+		assert.Equal(t, "my-task-id", s.Tasks[0].TaskID)
+		assert.Equal(t, 2, s.Tasks[0].RunID)
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		code, _ := request("GET", "/pause", token)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+		assert.False(t, w.Paused())
+
+		code, s := request("POST", "/pause", token)
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, s.Paused)
+		assert.True(t, w.Paused())
+
+		code, s = request("POST", "/resume", token)
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, s.Paused)
+		assert.False(t, w.Paused())
+	})
+
+	t.Run("stop gracefully", func(t *testing.T) {
+		code, s := request("POST", "/stop-gracefully", token)
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, s.StoppingGracefully)
+		assert.False(t, s.StoppingNow)
+	})
+}
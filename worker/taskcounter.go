@@ -3,14 +3,28 @@ package worker
 import (
 	"sync"
 	"time"
+
+	"github.com/taskcluster/taskcluster-worker/worker/taskrun"
 )
 
 // taskCounter keeps count of number of active tasks as well as idle time.
+//
+// Tasks being run can also be tracked, such that they can be listed by the
+// status API, tracking is independent of the count.
 type taskCounter struct {
 	m         sync.Mutex
 	c         sync.Cond
 	value     int
 	idleSince time.Time
+	tasks     []*activeTask
+}
+
+// activeTask is a task tracked by taskCounter
+type activeTask struct {
+	TaskID  string
+	RunID   int
+	Started time.Time
+	Run     *taskrun.TaskRun
 }
 
 // initialize the taskCounter and lock it, if not already initialized
@@ -85,3 +99,35 @@ func (c *taskCounter) Value() int {
 
 	return c.value
 }
+
+// Track adds task to the list of tracked tasks
+func (c *taskCounter) Track(task *activeTask) {
+	c.initAndLock()
+	defer c.m.Unlock()
+
+	c.tasks = append(c.tasks, task)
+}
+
+// Untrack removes task from the list of tracked tasks
+func (c *taskCounter) Untrack(task *activeTask) {
+	c.initAndLock()
+	defer c.m.Unlock()
+
+	tasks := c.tasks[:0]
+	for _, t := range c.tasks {
+		if t != task {
+			tasks = append(tasks, t)
+		}
+	}
+	c.tasks = tasks
+}
+
+// Tasks returns the tracked tasks, in the order they were tracked
+func (c *taskCounter) Tasks() []*activeTask {
+	c.initAndLock()
+	defer c.m.Unlock()
+
+	tasks := make([]*activeTask, len(c.tasks))
+	copy(tasks, c.tasks)
+	return tasks
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 )
 
 // Options required to create a TaskRun
@@ -16,6 +17,8 @@ type Options struct {
 	TaskInfo      runtime.TaskInfo
 	Payload       map[string]interface{}
 	Queue         client.Queue
+	Span          *tracing.Span // optional span for the task, stages are traced as child spans
+	UploadOptions runtime.UploadOptions
 }
 
 // mustBeValid panics if Options contains empty values, this allows us to catch
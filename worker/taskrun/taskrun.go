@@ -10,6 +10,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 )
 
 // A TaskRun holds the state of a running task.
@@ -24,6 +25,7 @@ type TaskRun struct {
 	monitor       runtime.Monitor
 	taskInfo      runtime.TaskInfo
 	payload       map[string]interface{}
+	span          *tracing.Span
 
 	// TaskContext
 	taskContext *runtime.TaskContext
@@ -61,6 +63,7 @@ func New(options Options) *TaskRun {
 		monitor:       options.Monitor,
 		taskInfo:      options.TaskInfo,
 		payload:       options.Payload,
+		span:          options.Span,
 	}
 	t.c.L = &t.m
 
@@ -80,6 +83,11 @@ func New(options Options) *TaskRun {
 		t.fatalErr.Set(true)
 	} else {
 		t.controller.SetQueueClient(options.Queue)
+		uploadOptions := options.UploadOptions
+		if uploadOptions.TemporaryStorage == nil {
+			uploadOptions.TemporaryStorage = t.environment.TemporaryStorage
+		}
+		t.controller.SetUploadOptions(uploadOptions)
 	}
 	return t
 }
@@ -165,10 +173,18 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 		t.m.Unlock()
 		monitor := t.monitor.WithTag("stage", stage.String())
 		monitor.Debug("running stage: ", stage.String())
+		span := t.span.StartSpan("taskrun."+stage.String(), nil)
+		t.controller.SetSpan(span)
 		var err error
 		incidentID := monitor.CapturePanic(func() {
 			err = stages[stage](t)
 		})
+		if incidentID != "" {
+			span.SetAttribute("incidentId", incidentID)
+		}
+		span.SetError(err)
+		span.End()
+		t.controller.SetSpan(t.span)
 		t.m.Lock()
 
 		// Handle errors
@@ -229,6 +245,28 @@ func (t *TaskRun) WaitForResult() (success bool, exception bool, reason runtime.
 	return
 }
 
+// Stage returns the name of the stage currently running, or the next stage to
+// run, if no stage is running. Returns "resolved" when all stages are done.
+// This is intended for status reporting and may be called from other threads.
+func (t *TaskRun) Stage() string {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.stage == stageResolved {
+		return "resolved"
+	}
+	return t.stage.String()
+}
+
+// LogLocation returns the path to the file in which the task log is stored,
+// or empty string, if the TaskContext could not be created.
+func (t *TaskRun) LogLocation() string {
+	if t.controller == nil {
+		return ""
+	}
+	return t.controller.LogLocation()
+}
+
 func (t *TaskRun) capturePanicAndError(stage string, fn func() error) {
 	monitor := t.monitor.WithTag("stage", stage)
 	var err error
@@ -259,8 +297,11 @@ func (t *TaskRun) capturePanicAndError(stage string, fn func() error) {
 // returned instead.
 func (t *TaskRun) Dispose() error {
 	t.monitor.WithTag("stage", "dispose").Debug("running stage: dispose")
+	span := t.span.StartSpan("taskrun.dispose", nil)
+	defer span.End()
 
 	if t.controller != nil {
+		t.controller.SetSpan(span)
 		debug("canceling TaskContext and closing log")
 		t.controller.Cancel()
 		t.capturePanicAndError("dispose", t.controller.CloseLog)
@@ -325,9 +366,11 @@ func (t *TaskRun) Dispose() error {
 	// We report any errors, so they'll be in sentry and logs, hence, we just
 	// notify caller about the fact that there was an unhandled error.
 	if t.fatalErr.Get() {
+		span.SetError(runtime.ErrFatalInternalError)
 		return runtime.ErrFatalInternalError
 	}
 	if t.nonFatalErr.Get() {
+		span.SetError(runtime.ErrNonFatalInternalError)
 		return runtime.ErrNonFatalInternalError
 	}
 	return nil
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,6 +25,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
 	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/runtime/tracing"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
 	"github.com/taskcluster/taskcluster-worker/worker/taskrun"
@@ -41,9 +45,19 @@ type Worker struct {
 	queueBaseURL     string
 	options          options
 	monitor          runtime.Monitor
+	tracer           *tracing.Tracer // nil, if tracing isn't configured
+	statusServer     *http.Server    // nil, if status API isn't configured
+	capacity         *capacityPolicy // nil, if capacity policy isn't configured
+	journal          *claimJournal   // nil, if claims journal isn't configured
+	orphans          []journalEntry  // claims left in journal from previous run
+	uploadOptions    runtime.UploadOptions
 	// State
+	startTime   time.Time
 	started     atomics.Once
 	activeTasks taskCounter
+	mPaused     sync.Mutex
+	resumed     chan struct{} // closed when resumed, nil if not paused by Pause()
+	claimPaused atomics.Bool  // true, if claiming was paused in the claim loop
 }
 
 // New creates a new Worker
@@ -60,11 +74,19 @@ func New(config interface{}) (w *Worker, err error) {
 
 	// Create worker
 	w = &Worker{
+		startTime:        time.Now(),
 		monitor:          monitor.WithPrefix("worker"),
 		garbageCollector: gc.New(c.TemporaryFolder, c.MinimumDiskSpace, c.MinimumMemory),
 		queueBaseURL:     c.QueueBaseURL,
 		options:          c.WorkerOptions,
 	}
+	if c.ArtifactUploads != nil {
+		w.uploadOptions = runtime.UploadOptions{
+			MultipartThreshold: c.ArtifactUploads.MultipartThreshold,
+			PartSize:           c.ArtifactUploads.PartSize,
+			Parallelism:        c.ArtifactUploads.Parallelism,
+		}
+	}
 
 	w.monitor.Info("starting up")
 
@@ -81,6 +103,16 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Open claims journal
+	if c.WorkerOptions.ClaimsJournal != "" {
+		w.journal, w.orphans, err = openClaimJournal(c.WorkerOptions.ClaimsJournal)
+		if err != nil {
+			w.monitor.ReportError(err, "worker.New() failed to open claims journal")
+			err = runtime.ErrFatalInternalError
+			return
+		}
+	}
+
 	// Create webhookserver
 	if c.WebHookServer != nil {
 		w.webhookserver, err = webhookserver.NewServer(c.WebHookServer, &c.Credentials)
@@ -104,6 +136,24 @@ func New(config interface{}) (w *Worker, err error) {
 		WorkerType:       c.WorkerOptions.WorkerType,
 	}
 
+	// Create tracer
+	if c.Tracing != nil {
+		tracingMonitor := monitor.WithPrefix("tracing")
+		w.tracer, err = tracing.New(c.Tracing, map[string]string{
+			"provisionerId": c.WorkerOptions.ProvisionerID,
+			"workerType":    c.WorkerOptions.WorkerType,
+			"workerGroup":   c.WorkerOptions.WorkerGroup,
+			"workerId":      c.WorkerOptions.WorkerID,
+		}, func(err error) {
+			tracingMonitor.Warn(err)
+		})
+		if err != nil {
+			w.monitor.ReportError(err, "worker.New() failed to setup tracing")
+			err = runtime.ErrFatalInternalError
+			return
+		}
+	}
+
 	// Create engine
 	provider := engines.Engines()[c.Engine]
 	if _, ok := c.EngineConfig[c.Engine]; !ok {
@@ -133,6 +183,15 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Create capacity policy
+	if c.Capacity != nil {
+		w.capacity = newCapacityPolicy(
+			*c.Capacity, c.WorkerOptions.WorkerType, c.WorkerOptions.Concurrency,
+			w.engine.Capabilities().MaxConcurrency, w.garbageCollector,
+			monitor.WithPrefix("capacity"),
+		)
+	}
+
 	// Check payload schema conflicts
 	_, err = schematypes.Merge(
 		w.engine.PayloadSchema(),
@@ -144,6 +203,24 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Create status API, this is done last, such that a half-built worker is
+	// never served
+	if c.StatusAPI != nil {
+		var listener net.Listener
+		listener, err = net.Listen("tcp", c.StatusAPI.Address)
+		if err != nil {
+			w.monitor.ReportError(err, "worker.New() failed to listen for status API")
+			err = runtime.ErrFatalInternalError
+			return
+		}
+		w.statusServer = &http.Server{Handler: newStatusAPI(w, c.StatusAPI.Token)}
+		go func() {
+			if serr := w.statusServer.Serve(listener); serr != http.ErrServerClosed {
+				w.monitor.ReportError(serr, "status API stopped")
+			}
+		}()
+	}
+
 	return
 }
 
@@ -184,6 +261,9 @@ func (w *Worker) Start() error {
 		panic("Worker.Start() cannot be called twice, worker cannot restart")
 	}
 
+	// Pause and resume claiming on signals
+	defer w.handlePauseSignals()()
+
 	// When StoppingNow is called, we give the worker 5 min to stop, or exit 1
 	// StoppingNow typically happens due to an internal error, it's no unlikely
 	// that this internal error caused a livelock by failing to release a lock, etc.
@@ -203,15 +283,25 @@ func (w *Worker) Start() error {
 		}
 	}()
 
+	// Resolve claims left in the journal, if the worker crashed
+	w.resolveOrphanedClaims()
+
 	for !w.lifeCycleTracker.StoppingGracefully.IsDone() {
-		// Claim tasks
-		N := w.options.Concurrency - w.activeTasks.Value()
-		debug("queue.claimWork(%s, %s) with capacity: %d", w.options.ProvisionerID, w.options.WorkerType, N)
-		claims, err := w.queue.ClaimWork(w.options.ProvisionerID, w.options.WorkerType, &tcqueue.ClaimWorkRequest{
-			WorkerGroup: w.options.WorkerGroup,
-			WorkerID:    w.options.WorkerID,
-			Tasks:       int64(N),
-		})
+		// Claim tasks, unless paused
+		var claims *tcqueue.ClaimWorkResponse
+		var err error
+		resumed := w.pausedChannel()
+		claimStarted := time.Now()
+		if !w.checkPaused(resumed != nil) {
+			if N := w.claimCapacity(); N > 0 {
+				debug("queue.claimWork(%s, %s) with capacity: %d", w.options.ProvisionerID, w.options.WorkerType, N)
+				claims, err = w.queue.ClaimWork(w.options.ProvisionerID, w.options.WorkerType, &tcqueue.ClaimWorkRequest{
+					WorkerGroup: w.options.WorkerGroup,
+					WorkerID:    w.options.WorkerID,
+					Tasks:       int64(N),
+				})
+			}
+		}
 		if err != nil && w.lifeCycleTracker.StoppingGracefully.IsDone() {
 			// NOTE: err == context.Canceled || err == context.DeadlineExceeded
 			//       Should also work once taskcluster-client-go returns the context.Err()
@@ -225,11 +315,15 @@ func (w *Worker) Start() error {
 
 		// If we have claims we MUST always handle, even if we have stopNow!
 		if claims != nil {
+			claimDone := time.Now()
 			for _, claim := range claims.Tasks {
 				// Start processing tasks
 				debug("starting to process task: %s/%d", claim.Status.TaskID, claim.RunID)
 				w.activeTasks.Increment()
-				go w.processClaim(claim)
+				// Trace the task from when we started claiming it
+				span := w.tracer.StartSpanAt("task", claimStarted, nil)
+				span.RecordSpan("claim", claimStarted, claimDone, nil)
+				go w.processClaim(claim, span)
 			}
 		}
 
@@ -250,11 +344,12 @@ func (w *Worker) Start() error {
 		debug("waiting for activeTasks: %d < concurrency: %d", w.activeTasks.Value(), w.options.Concurrency)
 		w.activeTasks.WaitForLessThan(w.options.Concurrency)
 
-		// Wait for delay or stopGracefully
+		// Wait for delay, stopGracefully or resume, if paused
 		debug("sleep before reclaiming, unless stopping gracefully")
 		select {
 		case <-delay:
 		case <-w.lifeCycleTracker.StoppingGracefully.Done():
+		case <-resumed:
 		}
 
 		// Report idle time to plugins (so they can manage life-cycle)
@@ -317,10 +412,11 @@ func (w *Worker) reclaimDelay(takenUntil time.Time) time.Duration {
 
 // processClaim is responsible for processing a task, reclaiming the task and
 // aborting it with worker-shutdown with w.stopNow is unblocked, and decrements
-// activeTasks when done
-func (w *Worker) processClaim(claim taskClaim) {
+// activeTasks when done. The span for the task is ended when done.
+func (w *Worker) processClaim(claim taskClaim, span *tracing.Span) {
 	// Decrement number of active tasks when we're done processing the task
 	defer w.activeTasks.Decrement()
+	defer span.End()
 
 	// If superseding is enabled, find superseding if one is available
 	// NOTE: This can be removed when superseding is implemented in the queue
@@ -337,6 +433,8 @@ func (w *Worker) processClaim(claim taskClaim) {
 	})
 	monitor.Info("starting to process task")
 	defer monitor.Info("done processing task")
+	span.SetAttribute("taskId", claim.Status.TaskID)
+	span.SetAttribute("runId", strconv.Itoa(int(claim.RunID)))
 
 	// Create task client
 	q := w.newQueueClient(context.Background(), &tcclient.Credentials{
@@ -362,6 +460,8 @@ func (w *Worker) processClaim(claim taskClaim) {
 		Monitor:       monitor.WithPrefix("taskrun"),
 		Queue:         q,
 		Payload:       payload,
+		Span:          span,
+		UploadOptions: w.uploadOptions,
 		TaskInfo: runtime.TaskInfo{
 			TaskID:   claim.Status.TaskID,
 			RunID:    int(claim.RunID),
@@ -378,6 +478,29 @@ func (w *Worker) processClaim(claim taskClaim) {
 		claim.Credentials.Certificate,
 	)
 
+	// Record the claim in the journal, so it can be resolved after a crash
+	err := w.journal.Add(journalEntry{
+		TaskID:      claim.Status.TaskID,
+		RunID:       int(claim.RunID),
+		TakenUntil:  time.Time(claim.TakenUntil),
+		Expires:     time.Time(claim.Task.Expires),
+		Credentials: *asClientCredentials(claim.Credentials),
+		LogFile:     run.LogLocation(),
+	})
+	if err != nil {
+		monitor.ReportWarning(err, "failed to add claim to journal")
+	}
+
+	// Track the task, so it can be listed by the status API
+	task := &activeTask{
+		TaskID:  claim.Status.TaskID,
+		RunID:   int(claim.RunID),
+		Started: time.Now(),
+		Run:     run,
+	}
+	w.activeTasks.Track(task)
+	defer w.activeTasks.Untrack(task)
+
 	// runId as string for use in requests
 	runID := strconv.Itoa(int(claim.RunID))
 
@@ -420,6 +543,10 @@ func (w *Worker) processClaim(claim taskClaim) {
 				result.Credentials.AccessToken,
 				result.Credentials.Certificate,
 			)
+			err = w.journal.Update(claim.Status.TaskID, int(claim.RunID), takenUntil, *asClientCredentials(result.Credentials))
+			if err != nil {
+				monitor.ReportWarning(err, "failed to update claim in journal")
+			}
 		}
 	}()
 
@@ -434,8 +561,10 @@ func (w *Worker) processClaim(claim taskClaim) {
 
 	// Report task resolution
 	debug("reporting task %s/%d resolved", claim.Status.TaskID, claim.RunID)
-	var err error
+	resolveSpan := span.StartSpan("resolve", nil)
 	if exception {
+		span.SetAttribute("resolution", "exception")
+		span.SetAttribute("reason", reason.String())
 		if reason != runtime.ReasonCanceled {
 			_, err = q.ReportException(claim.Status.TaskID, runID, &tcqueue.TaskExceptionRequest{
 				Reason: reason.String(),
@@ -443,11 +572,15 @@ func (w *Worker) processClaim(claim taskClaim) {
 		}
 	} else {
 		if success {
+			span.SetAttribute("resolution", "completed")
 			_, err = q.ReportCompleted(claim.Status.TaskID, runID)
 		} else {
+			span.SetAttribute("resolution", "failed")
 			_, err = q.ReportFailed(claim.Status.TaskID, runID)
 		}
 	}
+	resolveSpan.SetError(err)
+	resolveSpan.End()
 	if e, ok := err.(httpbackoff.BadHttpResponseCode); ok && e.HttpResponseCode == 409 {
 		monitor.Info("request conflict reporting task resolution, task was probably cancelled")
 		err = nil // ignore error
@@ -457,6 +590,11 @@ func (w *Worker) processClaim(claim taskClaim) {
 		w.plugin.ReportNonFatalError() // This is bad, but no need for it to be fatal
 	}
 
+	// Remove claim from journal, as the task has been resolved
+	if err = w.journal.Remove(claim.Status.TaskID, int(claim.RunID)); err != nil {
+		monitor.ReportWarning(err, "failed to remove claim from journal")
+	}
+
 	// Dispose all resources
 	err = run.Dispose()
 	if err == runtime.ErrNonFatalInternalError {
@@ -472,6 +610,103 @@ func (w *Worker) processClaim(claim taskClaim) {
 	}
 }
 
+// resolveOrphanedClaims resolves claims left in the claims journal by a
+// previous run of the worker, as worker-shutdown. Task logs are uploaded if
+// they can be recovered, so tasks are retried without waiting for claims to
+// expire.
+func (w *Worker) resolveOrphanedClaims() {
+	orphans := w.orphans
+	w.orphans = nil
+
+	for _, e := range orphans {
+		monitor := w.monitor.WithTags(map[string]string{
+			"taskId": e.TaskID,
+			"runId":  strconv.Itoa(e.RunID),
+		})
+
+		if time.Now().After(e.TakenUntil) {
+			monitor.Info("claim from previous run expired, leaving task to be resolved by the queue")
+		} else {
+			monitor.Info("resolving claim from previous run as worker-shutdown")
+			creds := e.Credentials
+			q := w.newQueueClient(&lifeCycleContext{LifeCycle: &w.lifeCycleTracker}, &creds)
+			if e.LogFile != "" {
+				if err := w.uploadOrphanedLog(q, e); err != nil {
+					monitor.ReportWarning(err, "failed to upload log recovered from previous run")
+				}
+			}
+			_, err := q.ReportException(e.TaskID, strconv.Itoa(e.RunID), &tcqueue.TaskExceptionRequest{
+				Reason: runtime.ReasonWorkerShutdown.String(),
+			})
+			if rerr, ok := err.(httpbackoff.BadHttpResponseCode); ok && rerr.HttpResponseCode == 409 {
+				monitor.Info("request conflict reporting task resolution, task was probably resolved")
+				err = nil // ignore error
+			}
+			if err != nil {
+				// Leave the claim in the journal, so we try again after a restart
+				monitor.ReportError(err, "failed to resolve claim from previous run")
+				continue
+			}
+		}
+
+		if e.LogFile != "" {
+			if err := os.Remove(e.LogFile); err != nil && !os.IsNotExist(err) {
+				monitor.ReportWarning(err, "failed to remove log file from previous run")
+			}
+		}
+		if err := w.journal.Remove(e.TaskID, e.RunID); err != nil {
+			monitor.ReportWarning(err, "failed to remove resolved claim from journal")
+		}
+	}
+}
+
+// uploadOrphanedLog uploads the task log left by a previous run
+func (w *Worker) uploadOrphanedLog(q client.Queue, e journalEntry) error {
+	file, err := os.Open(e.LogFile)
+	if os.IsNotExist(err) {
+		return nil // nothing to recover
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create TaskContext to upload artifacts with
+	ctx, controller, err := runtime.NewTaskContext(w.temporaryStorage.NewFilePath(), runtime.TaskInfo{
+		TaskID:  e.TaskID,
+		RunID:   e.RunID,
+		Expires: e.Expires,
+	})
+	if err != nil {
+		return err
+	}
+	defer controller.Dispose()
+	controller.SetQueueClient(q)
+
+	err = ctx.UploadS3Artifact(runtime.S3Artifact{
+		Name:     "public/logs/live_backing.log",
+		Mimetype: "text/plain; charset=utf-8",
+		Expires:  e.Expires,
+		Stream:   file,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to upload live_backing.log")
+	}
+
+	// Point live.log at the uploaded log, as the livelog is gone
+	baseURL := w.queueBaseURL
+	if baseURL == "" {
+		baseURL = tcqueue.New(nil).BaseURL
+	}
+	return ctx.CreateRedirectArtifact(runtime.RedirectArtifact{
+		Name:     "public/logs/live.log",
+		Mimetype: "text/plain; charset=utf-8",
+		URL: fmt.Sprintf("%s/task/%s/runs/%d/artifacts/public/logs/live_backing.log",
+			baseURL, e.TaskID, e.RunID),
+		Expires: e.Expires,
+	})
+}
+
 // superseding returns any superseding task, and a function to be called when
 // processed to resolve other superseded tasks.
 func (w *Worker) superseding(claim taskClaim) (taskClaim, func()) {
@@ -659,6 +894,88 @@ func (w *Worker) StopGracefully() {
 	w.lifeCycleTracker.StopGracefully()
 }
 
+// Pause stops claiming new tasks until Resume() is called, tasks that are
+// being processed are not affected.
+func (w *Worker) Pause() {
+	w.mPaused.Lock()
+	defer w.mPaused.Unlock()
+
+	if w.resumed == nil {
+		debug("Worker.Pause() called")
+		w.resumed = make(chan struct{})
+	}
+}
+
+// Resume claiming tasks after Pause()
+func (w *Worker) Resume() {
+	w.mPaused.Lock()
+	defer w.mPaused.Unlock()
+
+	if w.resumed != nil {
+		debug("Worker.Resume() called")
+		close(w.resumed)
+		w.resumed = nil
+	}
+}
+
+// Paused returns true, if claiming is paused by Pause(), the pause file or a
+// plugin.
+func (w *Worker) Paused() bool {
+	return w.pausedChannel() != nil || w.claimPaused.Get()
+}
+
+// checkPaused returns true, if claiming should be paused in this iteration of
+// the claim loop, because Pause() was called, the pause file exists or a plugin
+// returned true from PauseClaiming().
+func (w *Worker) checkPaused(paused bool) bool {
+	reason := ""
+	if paused {
+		reason = "Pause() was called"
+	} else if w.options.PauseFile != "" {
+		if _, err := os.Stat(w.options.PauseFile); err == nil {
+			reason = fmt.Sprintf("pause file '%s' exists", w.options.PauseFile)
+		} else if !os.IsNotExist(err) {
+			w.monitor.ReportWarning(err, "failed to check pause file")
+		}
+	}
+	if reason == "" && w.plugin.PauseClaiming() {
+		reason = "paused by plugin"
+	}
+
+	paused = reason != ""
+	if w.claimPaused.Swap(paused) != paused {
+		if paused {
+			w.monitor.Infof("claiming paused, %s", reason)
+		} else {
+			w.monitor.Info("claiming resumed")
+		}
+	}
+	return paused
+}
+
+// claimCapacity returns the number of tasks to claim
+func (w *Worker) claimCapacity() int {
+	active := w.activeTasks.Value()
+	if w.capacity == nil {
+		return w.options.Concurrency - active
+	}
+	N := w.capacity.Capacity(active)
+	w.monitor.Measure("capacity", float64(N))
+	return N
+}
+
+// pausedChannel returns a channel that is closed when resumed, or nil if not
+// paused.
+func (w *Worker) pausedChannel() <-chan struct{} {
+	w.mPaused.Lock()
+	defer w.mPaused.Unlock()
+
+	if w.resumed == nil {
+		return nil
+	}
+	return w.resumed
+}
+
 // dispose all resources
 func (w *Worker) dispose() {
 	hasErr := false
@@ -698,6 +1015,16 @@ func (w *Worker) dispose() {
 		w.webhookserver.Stop()
 	}
 
+	// Stop status API
+	if w.statusServer != nil {
+		w.statusServer.Close()
+	}
+
+	// Export pending spans
+	if err := w.tracer.Close(); err != nil {
+		w.monitor.ReportWarning(err, "error while closing tracer")
+	}
+
 	// Remove temporary storage
 	switch err := w.temporaryStorage.Remove(); err {
 	case runtime.ErrFatalInternalError, runtime.ErrNonFatalInternalError:
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net/http/httptest"
 	"os"
 	"path"
@@ -366,3 +367,26 @@ func TestWorkerStopNow(t *testing.T) {
 		Reason: "worker-shutdown",
 	}).Once().Return(&tcqueue.TaskStatusResponse{}, nil)
 }
+
+func TestWorkerPauseFile(t *testing.T) {
+	q := client.MockQueue{}
+	s := httptest.NewServer(&q)
+	defer s.Close()
+	w := setupTestWorker(t, s.URL, 1)
+	defer w.dispose()
+
+	pauseFile := path.Join(os.TempDir(), slugid.Nice())
+	w.options.PauseFile = pauseFile
+	require.False(t, w.checkPaused(false), "expected not paused without pause file")
+
+	require.NoError(t, ioutil.WriteFile(pauseFile, []byte{}, 0600))
+	defer os.Remove(pauseFile)
+	require.True(t, w.checkPaused(false), "expected paused when pause file exists")
+	require.True(t, w.Paused())
+
+	require.NoError(t, os.Remove(pauseFile))
+	require.False(t, w.checkPaused(false), "expected resumed when pause file is removed")
+	require.False(t, w.Paused())
+
+	require.True(t, w.checkPaused(true), "expected paused when Pause() was called")
+}